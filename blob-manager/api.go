@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"mime/multipart"
+	"strings"
+	"time"
 )
 
 type File interface {
@@ -14,10 +16,129 @@ type File interface {
 	Size() int64
 }
 
+// ObjectInfo describes a stored object without its content. ContentType is
+// left empty by providers that don't return it when listing.
+type ObjectInfo struct {
+	Name         string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Metadata     *Metadata
+}
+
+// ObjectPage is one page of a listing, NextPageToken is empty on the last page.
+type ObjectPage struct {
+	Objects       []*ObjectInfo
+	NextPageToken string
+}
+
+const ListPageSize = 1000
+
+// Metadata is stored with an object on Upload and handed back on Download.
+// UserMetadata keys are case-insensitive, providers return them lower-cased.
+type Metadata struct {
+	CacheControl       string
+	ContentDisposition string
+	UserMetadata       map[string]string
+}
+
+// MetadataFile is implemented by files that carry Metadata beyond their
+// content type, both on upload and on the files returned by Download.
+type MetadataFile interface {
+	File
+	Metadata() *Metadata
+}
+
+// GetMetadata returns the metadata of file, or empty metadata when it has none.
+func GetMetadata(file File) *Metadata {
+	if metadataFile, ok := file.(MetadataFile); ok && metadataFile.Metadata() != nil {
+		return metadataFile.Metadata()
+	}
+	return &Metadata{}
+}
+
+func (m *Metadata) Get(key string) string {
+	if m == nil {
+		return ""
+	}
+	return m.UserMetadata[strings.ToLower(key)]
+}
+
+func (m *Metadata) Set(key, value string) {
+	if m.UserMetadata == nil {
+		m.UserMetadata = map[string]string{}
+	}
+	m.UserMetadata[strings.ToLower(key)] = value
+}
+
+// Clone returns a deep copy, so decorators can add metadata without
+// modifying the caller's.
+func (m *Metadata) Clone() *Metadata {
+	if m == nil {
+		return &Metadata{}
+	}
+	clone := *m
+	clone.UserMetadata = make(map[string]string, len(m.UserMetadata))
+	for key, value := range m.UserMetadata {
+		clone.UserMetadata[key] = value
+	}
+	return &clone
+}
+
+// NormalizeUserMetadata lower-cases keys as returned by a provider.
+func NormalizeUserMetadata(userMetadata map[string]string) map[string]string {
+	normalized := make(map[string]string, len(userMetadata))
+	for key, value := range userMetadata {
+		normalized[strings.ToLower(key)] = value
+	}
+	return normalized
+}
+
 type BlobStore interface {
 	Upload(ctx *context.Context, file File) error
 	Download(ctx *context.Context, fileName string) (File, error)
 	Delete(ctx *context.Context, fileName string) error
+	Stat(ctx *context.Context, fileName string) (*ObjectInfo, error)
+	Exists(ctx *context.Context, fileName string) (bool, error)
+	List(ctx *context.Context, prefix string, pageToken string) (*ObjectPage, error)
+}
+
+// RangeReader is implemented by blob stores that can serve part of an object.
+// A negative length reads from offset to the end of the object.
+type RangeReader interface {
+	DownloadRange(ctx *context.Context, fileName string, offset int64, length int64) (File, error)
+}
+
+// SignOptions constrains a signed URL. Expiry defaults to
+// DefaultSignedURLExpiry, ContentType is the Content-Type an upload must be
+// sent with, or the Content-Type a download is served with.
+type SignOptions struct {
+	Expiry      time.Duration
+	ContentType string
+}
+
+const DefaultSignedURLExpiry = 15 * time.Minute
+
+func (o *SignOptions) GetExpiry() time.Duration {
+	if o == nil || o.Expiry <= 0 {
+		return DefaultSignedURLExpiry
+	}
+	return o.Expiry
+}
+
+func (o *SignOptions) GetContentType() string {
+	if o == nil {
+		return ""
+	}
+	return o.ContentType
+}
+
+// URLSigner is implemented by blob stores that let clients upload and
+// download objects directly, without the content passing through our servers.
+type URLSigner interface {
+	SignedUploadURL(ctx *context.Context, fileName string, options *SignOptions) (string, error)
+	SignedDownloadURL(ctx *context.Context, fileName string, options *SignOptions) (string, error)
 }
 
 type UploadableFile struct {
@@ -25,6 +146,7 @@ type UploadableFile struct {
 	file        multipart.File
 	fileSize    int64
 	contentType string
+	metadata    *Metadata
 }
 
 func NewUploadableFile(
@@ -59,3 +181,12 @@ func (u *UploadableFile) Size() int64 {
 func (u *UploadableFile) Type() string {
 	return u.contentType
 }
+
+func (u *UploadableFile) Metadata() *Metadata {
+	return u.metadata
+}
+
+func (u *UploadableFile) WithMetadata(metadata *Metadata) *UploadableFile {
+	u.metadata = metadata
+	return u
+}
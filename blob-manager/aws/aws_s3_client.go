@@ -1,11 +1,14 @@
 package aws
 
 import (
+	"context"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"time"
 )
 
 type S3Client struct {
@@ -15,8 +18,11 @@ type S3Client struct {
 	config     *AWSConfig
 }
 
-func CreateS3Client(config *AWSConfig) *S3Client {
-	sess := CreateSession(config)
+func CreateS3Client(config *AWSConfig) (*S3Client, error) {
+	sess, err := CreateSession(config)
+	if err != nil {
+		return nil, err
+	}
 	uploader := s3manager.NewUploader(sess)
 	downloader := s3manager.NewDownloader(sess)
 	client := s3.New(sess)
@@ -26,7 +32,7 @@ func CreateS3Client(config *AWSConfig) *S3Client {
 		config:     config,
 		downloader: downloader,
 		client:     client,
-	}
+	}, nil
 }
 
 func CreateS3Session(sess *session.Session) *s3.S3 {
@@ -34,25 +40,54 @@ func CreateS3Session(sess *session.Session) *s3.S3 {
 	return s3Session
 }
 
-func CreateSession(awsConfig *AWSConfig) *session.Session {
-	sess := session.Must(session.NewSession(
-		&aws.Config{
-			Region: aws.String(awsConfig.Region),
-			Credentials: credentials.NewStaticCredentials(
-				awsConfig.AccessKeyID,
-				awsConfig.AccessKeySecret,
-				"",
-			),
-		},
-	))
-	return sess
+// operationContext bounds ctx by timeout milliseconds.
+func operationContext(ctx *context.Context, timeout int) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(*ctx)
+	}
+	return context.WithTimeout(*ctx, time.Duration(timeout)*time.Millisecond)
+}
+
+// CreateSession uses the static keys of awsConfig when they are set and the
+// default credential chain otherwise: environment, shared config and
+// credentials files, then the container or instance role.
+func CreateSession(awsConfig *AWSConfig) (*session.Session, error) {
+	config := &aws.Config{
+		Region:           aws.String(awsConfig.Region),
+		S3ForcePathStyle: aws.Bool(awsConfig.ForcePathStyle),
+	}
+	if len(awsConfig.AccessKeyID) > 0 || len(awsConfig.AccessKeySecret) > 0 {
+		config.Credentials = credentials.NewStaticCredentials(
+			awsConfig.AccessKeyID,
+			awsConfig.AccessKeySecret,
+			"",
+		)
+	}
+	if len(awsConfig.Endpoint) > 0 {
+		config.Endpoint = aws.String(awsConfig.Endpoint)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aws session, reason: %w", err)
+	}
+	return sess, nil
 }
 
+// AWSConfig configures the S3 client. Endpoint points it at an S3 compatible
+// service such as MinIO or LocalStack, which usually also need
+// ForcePathStyle, since they don't serve buckets as subdomains.
 type AWSConfig struct {
 	AccessKeyID     string
 	AccessKeySecret string
 	Region          string
 	BucketName      string
-	UploadTimeout   int
-	BaseURL         string
+	// UploadTimeout and OperationTimeout are in milliseconds, 0 leaves
+	// uploads or the other operations bounded only by the caller's context.
+	UploadTimeout    int
+	OperationTimeout int
+	Endpoint         string
+	ForcePathStyle   bool
 }
@@ -1,18 +1,32 @@
 package aws
 
 import (
+	common "blob-manager/common"
 	"context"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"log"
 )
 
+// Delete looks the object up first, S3 deletes missing keys without an
+// error and the other stores report them as ObjectNotFound.
 func (s *S3Client) Delete(ctx *context.Context, fileName string) error {
-	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+	deleteCtx, cancel := operationContext(ctx, s.config.OperationTimeout)
+	defer cancel()
+	_, err := s.client.HeadObjectWithContext(deleteCtx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.config.BucketName),
 		Key:    aws.String(fileName),
 	})
+	if err == nil {
+		_, err = s.client.DeleteObjectWithContext(deleteCtx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.config.BucketName),
+			Key:    aws.String(fileName),
+		})
+	}
 	if err != nil {
+		if isNotFound(err) {
+			return &common.ObjectNotFound{ObjectId: fileName}
+		}
 		log.Printf("Error deleting file %s: %s", fileName, err)
 		return err
 	}
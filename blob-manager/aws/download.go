@@ -3,7 +3,6 @@ package aws
 import (
 	blob_manager "blob-manager"
 	common "blob-manager/common"
-	"bytes"
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
@@ -17,47 +16,76 @@ func (s *S3Client) Download(ctx *context.Context, fileName string) (blob_manager
 		Bucket: aws.String(s.config.BucketName),
 		Key:    aws.String(fileName),
 	}
+	file, err := s.getObject(ctx, fileName, input)
+	if err != nil {
+		return nil, err
+	}
+	return blob_manager.VerifyingFile(file), nil
+}
 
-	// Call the S3 GetObject API
-	output, err := s.client.GetObject(input)
+func (s *S3Client) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (blob_manager.File, error) {
+	if offset < 0 || length == 0 {
+		return nil, &common.DownloadError{
+			Message: fmt.Sprintf("invalid range offset: %d, length: %d for file with id: %s",
+				offset, length, fileName)}
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.config.BucketName),
+		Key:    aws.String(fileName),
+		Range:  aws.String(byteRange(offset, length)),
+	}
+	return s.getObject(ctx, fileName, input)
+}
+
+// getObject returns a file streaming straight from the GetObject body, the
+// caller owns the returned file and must Close it to release the connection.
+// The operation timeout covers reading the body, so it ends on Close.
+func (s *S3Client) getObject(ctx *context.Context, fileName string,
+	input *s3.GetObjectInput) (blob_manager.File, error) {
+	getCtx, cancel := operationContext(ctx, s.config.OperationTimeout)
+	output, err := s.client.GetObjectWithContext(getCtx, input)
 	if err != nil {
+		cancel()
+		if isNotFound(err) {
+			return nil, &common.ObjectNotFound{ObjectId: fileName}
+		}
 		log.Printf("failed to download file: %v", err)
 		return nil, &common.DownloadError{
 			Message: fmt.Sprintf("failed to download file with id: %s, reason: %s",
 				fileName, err.Error())}
 	}
 
-	//defer output.Body.Close()
-
-	// Read the content into a buffer
-	buffer := new(bytes.Buffer)
-	fileSize, err := io.Copy(buffer, output.Body)
-	if err != nil {
-		log.Printf("failed to read file content: %v", err)
-		return nil, err
-	}
-
 	s3File := &S3File{
-		content:  bytes.NewReader(buffer.Bytes()),
+		content:  output.Body,
+		cancel:   cancel,
 		fileName: fileName,
-		fileType: output.ContentType,
-		fileSize: fileSize,
+		fileType: aws.StringValue(output.ContentType),
+		fileSize: aws.Int64Value(output.ContentLength),
+		metadata: toMetadata(output.CacheControl, output.ContentDisposition, output.Metadata),
 	}
 
 	return s3File, nil
+}
 
+func byteRange(offset int64, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
 }
 
 type S3File struct {
-	content     *bytes.Reader
-	fileName    string
-	fileType    *string
-	fileSize    int64
-	closeCalled bool
+	content  io.ReadCloser
+	cancel   context.CancelFunc
+	fileName string
+	fileType string
+	fileSize int64
+	metadata *blob_manager.Metadata
 }
 
 func (o *S3File) Type() string {
-	return *o.fileType
+	return o.fileType
 }
 
 func (o *S3File) Size() int64 {
@@ -72,6 +100,11 @@ func (o *S3File) Name() string {
 	return o.fileName
 }
 
+func (o *S3File) Metadata() *blob_manager.Metadata {
+	return o.metadata
+}
+
 func (o *S3File) Close() error {
-	return nil
+	defer o.cancel()
+	return o.content.Close()
 }
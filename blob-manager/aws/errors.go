@@ -0,0 +1,23 @@
+package aws
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/http"
+)
+
+// isNotFound reports whether err is S3 telling us the key doesn't exist.
+// GetObject answers with NoSuchKey while HeadObject has no body and only
+// carries the 404 status.
+func isNotFound(err error) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) && requestFailure.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound"
+	}
+	return false
+}
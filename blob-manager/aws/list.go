@@ -0,0 +1,49 @@
+package aws
+
+import (
+	blobmanager "blob-manager"
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"log"
+	"strings"
+)
+
+func (s *S3Client) List(ctx *context.Context, prefix string, pageToken string) (*blobmanager.ObjectPage, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.config.BucketName),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(blobmanager.ListPageSize),
+	}
+	if len(pageToken) > 0 {
+		input.ContinuationToken = aws.String(pageToken)
+	}
+
+	listCtx, cancel := operationContext(ctx, s.config.OperationTimeout)
+	defer cancel()
+	output, err := s.client.ListObjectsV2WithContext(listCtx, input)
+	if err != nil {
+		log.Printf("failed to list objects with prefix %s: %v", prefix, err)
+		return nil, err
+	}
+
+	page := &blobmanager.ObjectPage{
+		Objects: make([]*blobmanager.ObjectInfo, 0, len(output.Contents)),
+	}
+	for _, object := range output.Contents {
+		// staged uploads aren't objects yet
+		if strings.HasPrefix(aws.StringValue(object.Key), blobmanager.StagingPrefix) {
+			continue
+		}
+		page.Objects = append(page.Objects, &blobmanager.ObjectInfo{
+			Name:         aws.StringValue(object.Key),
+			Size:         aws.Int64Value(object.Size),
+			ETag:         trimETag(object.ETag),
+			LastModified: aws.TimeValue(object.LastModified),
+		})
+	}
+	if aws.BoolValue(output.IsTruncated) {
+		page.NextPageToken = aws.StringValue(output.NextContinuationToken)
+	}
+	return page, nil
+}
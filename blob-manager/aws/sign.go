@@ -0,0 +1,48 @@
+package aws
+
+import (
+	blobmanager "blob-manager"
+	common "blob-manager/common"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func (s *S3Client) SignedUploadURL(ctx *context.Context, fileName string,
+	options *blobmanager.SignOptions) (string, error) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.config.BucketName),
+		Key:    aws.String(fileName),
+	}
+	if contentType := options.GetContentType(); len(contentType) > 0 {
+		input.ContentType = aws.String(contentType)
+	}
+	request, _ := s.client.PutObjectRequest(input)
+	signedURL, err := request.Presign(options.GetExpiry())
+	if err != nil {
+		return "", &common.SigningError{
+			Message: fmt.Sprintf("failed to presign upload for file with id: %s, reason: %s",
+				fileName, err.Error())}
+	}
+	return signedURL, nil
+}
+
+func (s *S3Client) SignedDownloadURL(ctx *context.Context, fileName string,
+	options *blobmanager.SignOptions) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.config.BucketName),
+		Key:    aws.String(fileName),
+	}
+	if contentType := options.GetContentType(); len(contentType) > 0 {
+		input.ResponseContentType = aws.String(contentType)
+	}
+	request, _ := s.client.GetObjectRequest(input)
+	signedURL, err := request.Presign(options.GetExpiry())
+	if err != nil {
+		return "", &common.SigningError{
+			Message: fmt.Sprintf("failed to presign download for file with id: %s, reason: %s",
+				fileName, err.Error())}
+	}
+	return signedURL, nil
+}
@@ -0,0 +1,54 @@
+package aws
+
+import (
+	blobmanager "blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"log"
+	"strings"
+)
+
+func (s *S3Client) Stat(ctx *context.Context, fileName string) (*blobmanager.ObjectInfo, error) {
+	statCtx, cancel := operationContext(ctx, s.config.OperationTimeout)
+	defer cancel()
+	output, err := s.client.HeadObjectWithContext(statCtx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.config.BucketName),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, &common.ObjectNotFound{ObjectId: fileName}
+		}
+		log.Printf("failed to stat file %s: %v", fileName, err)
+		return nil, err
+	}
+
+	return &blobmanager.ObjectInfo{
+		Name:         fileName,
+		Size:         aws.Int64Value(output.ContentLength),
+		ContentType:  aws.StringValue(output.ContentType),
+		ETag:         trimETag(output.ETag),
+		LastModified: aws.TimeValue(output.LastModified),
+		Metadata:     toMetadata(output.CacheControl, output.ContentDisposition, output.Metadata),
+	}, nil
+}
+
+func (s *S3Client) Exists(ctx *context.Context, fileName string) (bool, error) {
+	_, err := s.Stat(ctx, fileName)
+	if err != nil {
+		var notFound *common.ObjectNotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// trimETag drops the quotes S3 wraps around ETags.
+func trimETag(eTag *string) string {
+	return strings.Trim(aws.StringValue(eTag), `"`)
+}
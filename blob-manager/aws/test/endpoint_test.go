@@ -0,0 +1,364 @@
+package test
+
+import (
+	"blob-manager"
+	"blob-manager/aws"
+	common "blob-manager/common"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeObject struct {
+	content []byte
+	header  http.Header
+	parts   map[int][]byte
+}
+
+// fakeS3 serves path-style object requests and multipart uploads for a single
+// bucket from memory, and copies within it. A body that doesn't match its Content-MD5 is rejected,
+// partsWithoutMD5 counts the parts that came without one.
+type fakeS3 struct {
+	bucket          string
+	mutex           sync.Mutex
+	objects         map[string]*fakeObject
+	uploads         map[string]*fakeObject
+	partsWithoutMD5 int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "expected a path-style request", http.StatusBadRequest)
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		if f.uploads == nil {
+			f.uploads = map[string]*fakeObject{}
+		}
+		f.uploads[key] = &fakeObject{header: objectHeader(r), parts: map[int][]byte{}}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key>"+
+			"<UploadId>%s</UploadId></InitiateMultipartUploadResult>", f.bucket, key, key)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		content, ok := readVerified(w, r)
+		if !ok {
+			return
+		}
+		if len(r.Header.Get("Content-MD5")) == 0 {
+			f.partsWithoutMD5++
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		f.uploads[query.Get("uploadId")].parts[number] = content
+		w.Header().Set("ETag", `"part-`+query.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		upload := f.uploads[query.Get("uploadId")]
+		for number := 1; number <= len(upload.parts); number++ {
+			upload.content = append(upload.content, upload.parts[number]...)
+		}
+		f.objects[key] = upload
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key>"+
+			"<ETag>\"etag\"</ETag></CompleteMultipartUploadResult>", f.bucket, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && len(r.Header.Get("X-Amz-Copy-Source")) > 0:
+		source, ok := f.objects[strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), f.bucket+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>")
+			return
+		}
+		header := source.header
+		if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+			header = objectHeader(r)
+		}
+		f.objects[key] = &fakeObject{content: source.content, header: header}
+		io.WriteString(w, "<CopyObjectResult><ETag>\"etag\"</ETag></CopyObjectResult>")
+	case r.Method == http.MethodPut:
+		content, ok := readVerified(w, r)
+		if !ok {
+			return
+		}
+		f.objects[key] = &fakeObject{content: content, header: objectHeader(r)}
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>")
+			}
+			return
+		}
+		for name, values := range object.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Write(object.content)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func readVerified(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	content, _ := io.ReadAll(r.Body)
+	sum := md5.Sum(content)
+	if contentMD5 := r.Header.Get("Content-MD5"); len(contentMD5) > 0 &&
+		contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "<Error><Code>BadDigest</Code><Message>digest mismatch</Message></Error>")
+		return nil, false
+	}
+	return content, true
+}
+
+func objectHeader(r *http.Request) http.Header {
+	header := http.Header{}
+	for name, values := range r.Header {
+		if name == "Content-Type" || strings.HasPrefix(name, "X-Amz-Meta-") {
+			header[name] = values
+		}
+	}
+	return header
+}
+
+func TestS3Client_CustomEndpoint(t *testing.T) {
+	var ctx = context.Background()
+	server := httptest.NewServer(&fakeS3{bucket: "profiles", objects: map[string]*fakeObject{}})
+	defer server.Close()
+
+	b := &blobmanager.BlobManager{BlobStore: getS3Client(t, &aws.AWSConfig{
+		AccessKeyID:     "minio",
+		AccessKeySecret: "minio-secret",
+		Region:          "us-east-1",
+		BucketName:      "profiles",
+		Endpoint:        server.URL,
+		ForcePathStyle:  true,
+	})}
+
+	metadata := &blobmanager.Metadata{}
+	metadata.Set("user-id", "674c9d65361369da5c4710d6")
+	file := blobmanager.NewUploadableFile("users/avatar", getReadCloserFromByteArray([]byte("profile picture")),
+		15, "image/png").WithMetadata(metadata)
+	if err := b.Upload(&ctx, file); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	got, err := b.Download(&ctx, "users/avatar")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	defer got.Close()
+	content, _ := io.ReadAll(got)
+	if string(content) != "profile picture" || got.Type() != "image/png" {
+		t.Errorf("Download() got = %q (%s)", content, got.Type())
+	}
+	if blobmanager.GetMetadata(got).Get("user-id") != "674c9d65361369da5c4710d6" {
+		t.Errorf("Download() metadata = %+v", blobmanager.GetMetadata(got))
+	}
+
+	if err := b.Delete(&ctx, "users/avatar"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	var notFound *common.ObjectNotFound
+	if _, err := b.Download(&ctx, "users/avatar"); !errors.As(err, &notFound) {
+		t.Errorf("Download() after Delete() error = %v, want ObjectNotFound", err)
+	}
+	if exists, err := b.Exists(&ctx, "users/avatar"); err != nil || exists {
+		t.Errorf("Exists() after Delete() = %v, %v", exists, err)
+	}
+	if err := b.Delete(&ctx, "users/avatar"); !errors.As(err, &notFound) {
+		t.Errorf("Delete() of a missing object error = %v, want ObjectNotFound", err)
+	}
+}
+
+func TestS3Client_Integrity(t *testing.T) {
+	var ctx = context.Background()
+	fake := &fakeS3{bucket: "profiles", objects: map[string]*fakeObject{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	b := &blobmanager.BlobManager{BlobStore: getS3Client(t, &aws.AWSConfig{
+		AccessKeyID:     "minio",
+		AccessKeySecret: "minio-secret",
+		Region:          "us-east-1",
+		BucketName:      "profiles",
+		Endpoint:        server.URL,
+		ForcePathStyle:  true,
+	})}
+	if err := b.Upload(&ctx, blobmanager.NewUploadableFile("users/avatar",
+		getReadCloserFromByteArray([]byte("profile picture")), 15, "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	sum := sha256.Sum256([]byte("profile picture"))
+	if got := fake.objects["users/avatar"].header.Get("X-Amz-Meta-Blob-Sha256"); got !=
+		base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Upload() stored checksum = %q", got)
+	}
+
+	fake.objects["users/avatar"].content = []byte("profile pictur3")
+	got, err := b.Download(&ctx, "users/avatar")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	defer got.Close()
+	var integrityError *common.IntegrityError
+	if _, err := io.ReadAll(got); !errors.As(err, &integrityError) {
+		t.Errorf("Download() of corrupted object error = %v, want IntegrityError", err)
+	}
+}
+
+func TestS3Client_MultipartIntegrity(t *testing.T) {
+	var ctx = context.Background()
+	content := bytes.Repeat([]byte("profile picture "), 400*1024)
+	sum := sha256.Sum256(content)
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{name: "without checksum"},
+		{name: "matching checksum", checksum: base64.StdEncoding.EncodeToString(sum[:])},
+		{name: "mismatched checksum", checksum: base64.StdEncoding.EncodeToString(make([]byte, 32)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{bucket: "profiles", objects: map[string]*fakeObject{}}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			client := getS3Client(t, &aws.AWSConfig{
+				AccessKeyID:     "minio",
+				AccessKeySecret: "minio-secret",
+				Region:          "us-east-1",
+				BucketName:      "profiles",
+				Endpoint:        server.URL,
+				ForcePathStyle:  true,
+			})
+
+			metadata := &blobmanager.Metadata{}
+			if len(tt.checksum) > 0 {
+				metadata.Set(blobmanager.ChecksumMetadataKey, tt.checksum)
+			}
+			previous := &fakeObject{content: []byte("previous video")}
+			fake.objects["users/video"] = previous
+			err := client.Upload(&ctx, blobmanager.NewUploadableFile("users/video",
+				getReadCloserFromByteArray(content), -1, "video/mp4").WithMetadata(metadata))
+			for key := range fake.objects {
+				if strings.HasPrefix(key, blobmanager.StagingPrefix) {
+					t.Errorf("Upload() left the staged upload: %s", key)
+				}
+			}
+			var integrityError *common.IntegrityError
+			if tt.wantErr {
+				if !errors.As(err, &integrityError) {
+					t.Fatalf("Upload() error = %v, want IntegrityError", err)
+				}
+				if fake.objects["users/video"] != previous {
+					t.Errorf("Upload() replaced the object with one that doesn't match its checksum")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+			if fake.partsWithoutMD5 > 0 {
+				t.Errorf("Upload() sent %d parts without Content-MD5", fake.partsWithoutMD5)
+			}
+			stored := fake.objects["users/video"]
+			if stored == nil || !bytes.Equal(stored.content, content) {
+				t.Fatalf("Upload() didn't store the whole content")
+			}
+			if got := stored.header.Get("X-Amz-Meta-Blob-Sha256"); got != base64.StdEncoding.EncodeToString(sum[:]) {
+				t.Errorf("Upload() stored checksum = %q", got)
+			}
+			if got := stored.header.Get("Content-Type"); got != "video/mp4" {
+				t.Errorf("Upload() stored content type = %q", got)
+			}
+		})
+	}
+}
+
+func TestCreateSession_Credentials(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	t.Setenv("AWS_CONFIG_FILE", missing)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", missing)
+	t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+
+	tests := []struct {
+		name      string
+		config    *aws.AWSConfig
+		wantKeyId string
+	}{
+		{
+			name:      "static keys",
+			config:    &aws.AWSConfig{AccessKeyID: "static-key", AccessKeySecret: "static-secret", Region: "ap-south-1"},
+			wantKeyId: "static-key",
+		},
+		{
+			name:      "default chain",
+			config:    &aws.AWSConfig{Region: "ap-south-1"},
+			wantKeyId: "env-key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess, err := aws.CreateSession(tt.config)
+			if err != nil {
+				t.Fatalf("CreateSession() error = %v", err)
+			}
+			value, err := sess.Config.Credentials.Get()
+			if err != nil || value.AccessKeyID != tt.wantKeyId {
+				t.Errorf("Credentials.Get() = %s, %v, want %s", value.AccessKeyID, err, tt.wantKeyId)
+			}
+		})
+	}
+}
+
+func TestS3Client_OperationTimeout(t *testing.T) {
+	var ctx = context.Background()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := getS3Client(t, &aws.AWSConfig{
+		AccessKeyID:      "minio",
+		AccessKeySecret:  "minio-secret",
+		Region:           "us-east-1",
+		BucketName:       "profiles",
+		Endpoint:         server.URL,
+		ForcePathStyle:   true,
+		OperationTimeout: 50,
+	})
+	start := time.Now()
+	if _, err := client.Stat(&ctx, "users/avatar"); err == nil {
+		t.Fatalf("Stat() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Stat() took %s, want it cut off by the operation timeout", elapsed)
+	}
+}
@@ -3,26 +3,178 @@ package aws
 import (
 	blobmanager "blob-manager"
 	common "blob-manager/common"
+	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"log"
 )
 
+// Upload sends files of up to a part as a single request with their checksum
+// in the metadata. Larger files are streamed in parts to a staging key, the
+// SDK has S3 check the Content-MD5 of every part, and are only copied over the
+// object with their checksum once they match the caller's checksum, if any. A
+// failed upload leaves the object as it was.
 func (s *S3Client) Upload(ctx *context.Context, file blobmanager.File) error {
-	_, err := s.uploader.Upload(&s3manager.UploadInput{
+	defer file.Close()
+	content, checksums, stream, err := blobmanager.ReadWithChecksums(file, s.uploader.PartSize)
+	if err != nil {
+		return err
+	}
+	uploadCtx, cancel := operationContext(ctx, s.config.UploadTimeout)
+	defer cancel()
+	if stream != nil {
+		return s.uploadStreamed(uploadCtx, file, stream)
+	}
+	input := uploadInput(s.config.BucketName, file.Name(), file.Type(),
+		blobmanager.WithChecksum(blobmanager.GetMetadata(file), checksums))
+	input.Body = bytes.NewReader(content)
+	input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(checksums.MD5))
+	if _, err := s.uploader.UploadWithContext(uploadCtx, input, withPartSize(file.Size())); err != nil {
+		return uploadError(file.Name(), err)
+	}
+	return nil
+}
+
+func (s *S3Client) uploadStreamed(ctx context.Context, file blobmanager.File,
+	stream *blobmanager.ChecksumReader) error {
+	stagingKey, err := blobmanager.NewStagingKey()
+	if err != nil {
+		return uploadError(file.Name(), err)
+	}
+	input := &s3manager.UploadInput{
 		Bucket: aws.String(s.config.BucketName),
-		Key:    aws.String(file.Name()),
-		Body:   file,
-	})
+		Key:    aws.String(stagingKey),
+		Body:   stream,
+	}
+	if _, err := s.uploader.UploadWithContext(ctx, input, withPartSize(file.Size())); err != nil {
+		return uploadError(file.Name(), err)
+	}
+	defer s.deleteStaged(ctx, stagingKey)
+	checksums := stream.Checksums()
+	if err := blobmanager.VerifyUploadChecksum(file, checksums); err != nil {
+		return err
+	}
+	metadata := blobmanager.WithChecksum(blobmanager.GetMetadata(file), checksums)
+	if err := s.copyStaged(ctx, stagingKey, file, metadata, stream.Size()); err != nil {
+		return uploadError(file.Name(), err)
+	}
+	return nil
+}
 
+// copyStaged copies a staged upload over the object with its final metadata,
+// objects larger than a single CopyObject allows are copied in parts.
+func (s *S3Client) copyStaged(ctx context.Context, stagingKey string, file blobmanager.File,
+	metadata *blobmanager.Metadata, size int64) error {
+	input := uploadInput(s.config.BucketName, file.Name(), file.Type(), metadata)
+	copySource := aws.String(s.config.BucketName + "/" + stagingKey)
+	if size <= maxCopyObjectSize {
+		_, err := s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:             input.Bucket,
+			Key:                input.Key,
+			CopySource:         copySource,
+			MetadataDirective:  aws.String(s3.MetadataDirectiveReplace),
+			ContentType:        input.ContentType,
+			CacheControl:       input.CacheControl,
+			ContentDisposition: input.ContentDisposition,
+			Metadata:           input.Metadata,
+		})
+		return err
+	}
+
+	created, err := s.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             input.Bucket,
+		Key:                input.Key,
+		ContentType:        input.ContentType,
+		CacheControl:       input.CacheControl,
+		ContentDisposition: input.ContentDisposition,
+		Metadata:           input.Metadata,
+	})
 	if err != nil {
-		fmt.Printf("failed to upload object, %v\n", err)
-		return &common.UploadError{
-			Message: fmt.Sprintf("failed to upload object: %s,reason: %v\n",
-				file.Name(), err.Error())}
+		return err
 	}
+	var parts []*s3.CompletedPart
+	for offset, number := int64(0), int64(1); offset < size; offset, number = offset+copyPartSize, number+1 {
+		part, err := s.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          input.Bucket,
+			Key:             input.Key,
+			UploadId:        created.UploadId,
+			PartNumber:      aws.Int64(number),
+			CopySource:      copySource,
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, min(offset+copyPartSize, size)-1)),
+		})
+		if err != nil {
+			s.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+				Bucket: input.Bucket, Key: input.Key, UploadId: created.UploadId})
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int64(number)})
+	}
+	_, err = s.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          input.Bucket,
+		Key:             input.Key,
+		UploadId:        created.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
 
-	fmt.Printf("Successfully uploaded %q to %q\n", file.Name(), s.config.BucketName)
-	return nil
+func (s *S3Client) deleteStaged(ctx context.Context, stagingKey string) {
+	if _, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.config.BucketName),
+		Key:    aws.String(stagingKey),
+	}); err != nil {
+		log.Printf("failed to delete staged upload: %s, reason: %v", stagingKey, err)
+	}
+}
+
+func uploadError(fileName string, err error) error {
+	return &common.UploadError{
+		Message: fmt.Sprintf("failed to upload object: %s,reason: %v", fileName, err.Error())}
+}
+
+const (
+	// maxCopyObjectSize is the largest object a single CopyObject copies.
+	maxCopyObjectSize = 5 << 30
+	copyPartSize      = 512 << 20
+)
+
+func uploadInput(bucketName string, fileName string, contentType string,
+	metadata *blobmanager.Metadata) *s3manager.UploadInput {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(fileName),
+	}
+	if len(contentType) > 0 {
+		input.ContentType = aws.String(contentType)
+	}
+	if len(metadata.CacheControl) > 0 {
+		input.CacheControl = aws.String(metadata.CacheControl)
+	}
+	if len(metadata.ContentDisposition) > 0 {
+		input.ContentDisposition = aws.String(metadata.ContentDisposition)
+	}
+	input.Metadata = aws.StringMap(metadata.UserMetadata)
+	return input
+}
+
+// withPartSize grows the part size for large files, so that they still fit
+// in the maximum number of parts of a multipart upload.
+func withPartSize(size int64) func(*s3manager.Uploader) {
+	return func(uploader *s3manager.Uploader) {
+		if minPartSize := size/int64(uploader.MaxUploadParts) + 1; minPartSize > uploader.PartSize {
+			uploader.PartSize = minPartSize
+		}
+	}
+}
+
+func toMetadata(cacheControl, contentDisposition *string, userMetadata map[string]*string) *blobmanager.Metadata {
+	return &blobmanager.Metadata{
+		CacheControl:       aws.StringValue(cacheControl),
+		ContentDisposition: aws.StringValue(contentDisposition),
+		UserMetadata:       blobmanager.NormalizeUserMetadata(aws.StringValueMap(userMetadata)),
+	}
 }
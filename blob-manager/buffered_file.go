@@ -0,0 +1,75 @@
+package blobmanager
+
+import (
+	"bytes"
+	"io"
+)
+
+// DefaultMaxBufferedSize is how much of an upload decorators hold in memory
+// unless they are configured otherwise.
+const DefaultMaxBufferedSize = 64 << 20
+
+// bufferedFile is an in-memory File, used by decorators that have to
+// transform the whole object before handing it on.
+type bufferedFile struct {
+	*bytes.Reader
+	fileName    string
+	contentType string
+	metadata    *Metadata
+}
+
+func newBufferedFile(fileName string, contentType string, content []byte, metadata *Metadata) *bufferedFile {
+	return &bufferedFile{
+		Reader:      bytes.NewReader(content),
+		fileName:    fileName,
+		contentType: contentType,
+		metadata:    metadata,
+	}
+}
+
+func (b *bufferedFile) Name() string {
+	return b.fileName
+}
+
+func (b *bufferedFile) Type() string {
+	return b.contentType
+}
+
+func (b *bufferedFile) Metadata() *Metadata {
+	return b.metadata
+}
+
+func (b *bufferedFile) Close() error {
+	return nil
+}
+
+// readBuffered reads files of up to limit bytes into memory. A larger file is
+// returned as a File that streams what was already read and then the rest.
+func readBuffered(file File, limit int64) ([]byte, File, error) {
+	content, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(content)) <= limit {
+		return content, nil, nil
+	}
+	return nil, &prefixedFile{File: file, reader: io.MultiReader(bytes.NewReader(content), file)}, nil
+}
+
+// prefixedFile is left to be closed by whoever handed on the file.
+type prefixedFile struct {
+	File
+	reader io.Reader
+}
+
+func (p *prefixedFile) Read(b []byte) (int, error) {
+	return p.reader.Read(b)
+}
+
+func (p *prefixedFile) Metadata() *Metadata {
+	return GetMetadata(p.File)
+}
+
+func (p *prefixedFile) Close() error {
+	return nil
+}
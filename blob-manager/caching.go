@@ -0,0 +1,316 @@
+package blobmanager
+
+import (
+	common "blob-manager/common"
+	"container/list"
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	cacheETagMetadata = "blob-cache-etag"
+	// cacheGenerations is the number of invalidation counters, object names
+	// share them by hash
+	cacheGenerations = 256
+)
+
+// CacheOptions configures a CachingBlobStore. MaxBytes bounds the content held
+// in memory, objects larger than that are only kept on the DiskTier. DiskTier
+// is optional and unbounded, any BlobStore works, usually a local one. With
+// ValidateETag every hit costs a Stat on the backing store, but objects
+// written around the cache, e.g. through signed urls, are never served stale.
+type CacheOptions struct {
+	MaxBytes     int64
+	DiskTier     BlobStore
+	ValidateETag bool
+}
+
+type CacheStats struct {
+	Hits      int64
+	DiskHits  int64
+	Misses    int64
+	Evictions int64
+	Bytes     int64
+	Entries   int
+}
+
+type cacheEntry struct {
+	fileName    string
+	content     []byte
+	contentType string
+	eTag        string
+	metadata    *Metadata
+}
+
+func (c *cacheEntry) file() File {
+	return newBufferedFile(c.fileName, c.contentType, c.content, c.metadata)
+}
+
+// CachingBlobStore serves downloads from an LRU cache in front of another
+// store, Upload and Delete invalidate the cached object. Signed urls are
+// forwarded to the backing store, reads through them don't need the cache.
+type CachingBlobStore struct {
+	store   BlobStore
+	options CacheOptions
+
+	mutex   sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	bytes   int64
+	// generations count invalidations, a download only caches what it read
+	// when no invalidation of its object happened meanwhile
+	generations [cacheGenerations]atomic.Uint64
+
+	hits      atomic.Int64
+	diskHits  atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+func CreateCachingBlobStore(store BlobStore, options *CacheOptions) (*CachingBlobStore, error) {
+	if options == nil || options.MaxBytes <= 0 {
+		return nil, errors.New("max bytes for caching blob store must be positive")
+	}
+	return &CachingBlobStore{
+		store:   store,
+		options: *options,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}, nil
+}
+
+func (c *CachingBlobStore) Download(ctx *context.Context, fileName string) (File, error) {
+	generation := c.generation(fileName).Load()
+	var eTag string
+	if c.options.ValidateETag {
+		info, err := c.store.Stat(ctx, fileName)
+		if err != nil {
+			var notFound *common.ObjectNotFound
+			if errors.As(err, &notFound) {
+				c.Invalidate(ctx, fileName)
+			}
+			return nil, err
+		}
+		eTag = info.ETag
+	}
+
+	if entry := c.get(fileName); entry != nil && c.valid(entry, eTag) {
+		c.hits.Add(1)
+		return entry.file(), nil
+	}
+	if entry := c.getFromDisk(ctx, fileName); entry != nil && c.valid(entry, eTag) {
+		c.diskHits.Add(1)
+		c.put(entry, generation)
+		return entry.file(), nil
+	}
+
+	c.misses.Add(1)
+	file, err := c.store.Download(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, readError(err)
+	}
+	entry := &cacheEntry{
+		fileName:    fileName,
+		content:     content,
+		contentType: file.Type(),
+		eTag:        eTag,
+		metadata:    GetMetadata(file),
+	}
+	c.put(entry, generation)
+	c.putOnDisk(ctx, entry, generation)
+	return entry.file(), nil
+}
+
+func (c *CachingBlobStore) valid(entry *cacheEntry, eTag string) bool {
+	return !c.options.ValidateETag || entry.eTag == eTag
+}
+
+func (c *CachingBlobStore) Upload(ctx *context.Context, file File) error {
+	c.Invalidate(ctx, file.Name())
+	err := c.store.Upload(ctx, file)
+	// a download racing the upload may have cached the old content
+	c.Invalidate(ctx, file.Name())
+	return err
+}
+
+func (c *CachingBlobStore) Delete(ctx *context.Context, fileName string) error {
+	c.Invalidate(ctx, fileName)
+	err := c.store.Delete(ctx, fileName)
+	c.Invalidate(ctx, fileName)
+	return err
+}
+
+// Exists is answered from memory unless entries are validated by ETag.
+func (c *CachingBlobStore) Exists(ctx *context.Context, fileName string) (bool, error) {
+	if !c.options.ValidateETag && c.get(fileName) != nil {
+		return true, nil
+	}
+	return c.store.Exists(ctx, fileName)
+}
+
+func (c *CachingBlobStore) Stat(ctx *context.Context, fileName string) (*ObjectInfo, error) {
+	return c.store.Stat(ctx, fileName)
+}
+
+func (c *CachingBlobStore) List(ctx *context.Context, prefix string, pageToken string) (*ObjectPage, error) {
+	return c.store.List(ctx, prefix, pageToken)
+}
+
+func (c *CachingBlobStore) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (File, error) {
+	rangeReader, ok := c.store.(RangeReader)
+	if !ok {
+		return nil, &common.UnsupportedOperationError{Operation: "DownloadRange"}
+	}
+	return rangeReader.DownloadRange(ctx, fileName, offset, length)
+}
+
+func (c *CachingBlobStore) SignedUploadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := c.store.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedUploadURL"}
+	}
+	return signer.SignedUploadURL(ctx, fileName, options)
+}
+
+func (c *CachingBlobStore) SignedDownloadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := c.store.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedDownloadURL"}
+	}
+	return signer.SignedDownloadURL(ctx, fileName, options)
+}
+
+// Invalidate drops fileName from both tiers.
+func (c *CachingBlobStore) Invalidate(ctx *context.Context, fileName string) {
+	c.generation(fileName).Add(1)
+	c.mutex.Lock()
+	if element, ok := c.entries[fileName]; ok {
+		c.remove(element)
+	}
+	c.mutex.Unlock()
+
+	if c.options.DiskTier == nil {
+		return
+	}
+	var notFound *common.ObjectNotFound
+	if err := c.options.DiskTier.Delete(ctx, fileName); err != nil && !errors.As(err, &notFound) {
+		log.Printf("failed to invalidate cached object: %s on disk, reason: %v", fileName, err)
+	}
+}
+
+func (c *CachingBlobStore) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		DiskHits:  c.diskHits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Bytes:     c.bytes,
+		Entries:   c.lru.Len(),
+	}
+}
+
+func (c *CachingBlobStore) get(fileName string) *cacheEntry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[fileName]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*cacheEntry)
+}
+
+func (c *CachingBlobStore) generation(fileName string) *atomic.Uint64 {
+	hash := fnv.New32a()
+	hash.Write([]byte(fileName))
+	return &c.generations[hash.Sum32()%cacheGenerations]
+}
+
+// put caches entry unless its object was invalidated since generation, the
+// entry may hold content an upload replaced meanwhile.
+func (c *CachingBlobStore) put(entry *cacheEntry, generation uint64) {
+	size := int64(len(entry.content))
+	if size > c.options.MaxBytes {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// invalidations take the mutex after counting, checking under it keeps
+	// an invalidation from slipping in before the entry is added
+	if c.generation(entry.fileName).Load() != generation {
+		return
+	}
+	if element, ok := c.entries[entry.fileName]; ok {
+		c.remove(element)
+	}
+	c.entries[entry.fileName] = c.lru.PushFront(entry)
+	c.bytes += size
+	for c.bytes > c.options.MaxBytes {
+		c.remove(c.lru.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// remove must be called with the mutex held.
+func (c *CachingBlobStore) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.fileName)
+	c.bytes -= int64(len(entry.content))
+}
+
+func (c *CachingBlobStore) getFromDisk(ctx *context.Context, fileName string) *cacheEntry {
+	if c.options.DiskTier == nil {
+		return nil
+	}
+	file, err := c.options.DiskTier.Download(ctx, fileName)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil
+	}
+	metadata := GetMetadata(file).Clone()
+	eTag := metadata.Get(cacheETagMetadata)
+	delete(metadata.UserMetadata, cacheETagMetadata)
+	return &cacheEntry{
+		fileName:    fileName,
+		content:     content,
+		contentType: file.Type(),
+		eTag:        eTag,
+		metadata:    metadata,
+	}
+}
+
+func (c *CachingBlobStore) putOnDisk(ctx *context.Context, entry *cacheEntry, generation uint64) {
+	if c.options.DiskTier == nil || c.generation(entry.fileName).Load() != generation {
+		return
+	}
+	metadata := entry.metadata.Clone()
+	metadata.Set(cacheETagMetadata, entry.eTag)
+	file := newBufferedFile(entry.fileName, entry.contentType, entry.content, metadata)
+	if err := c.options.DiskTier.Upload(ctx, file); err != nil {
+		log.Printf("failed to cache object: %s on disk, reason: %v", entry.fileName, err)
+		return
+	}
+	if c.generation(entry.fileName).Load() != generation {
+		// invalidated while writing, the invalidation may have run first
+		c.Invalidate(ctx, entry.fileName)
+	}
+}
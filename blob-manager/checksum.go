@@ -0,0 +1,180 @@
+package blobmanager
+
+import (
+	common "blob-manager/common"
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ChecksumMetadataKey holds the base64 SHA-256 of the stored bytes. Stores
+// set it on Upload, and verify it when a Download is read to the end.
+const ChecksumMetadataKey = "blob-sha256"
+
+// StagingPrefix holds large uploads that are streamed before they are
+// verified and copied over their object. Uploads that were interrupted leave
+// their staged copy behind, a lifecycle rule on the prefix removes them.
+const StagingPrefix = ".uploads/"
+
+// NewStagingKey returns a unique key under StagingPrefix.
+func NewStagingKey() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return StagingPrefix + hex.EncodeToString(id), nil
+}
+
+// Checksums of an object's content, MD5 and CRC32C are what providers check
+// an upload against, SHA256 is what's stored with the object.
+type Checksums struct {
+	SHA256 string
+	MD5    []byte
+	CRC32C uint32
+}
+
+// ChecksumReader computes the Checksums of everything read through it.
+type ChecksumReader struct {
+	reader io.Reader
+	sha256 hash.Hash
+	md5    hash.Hash
+	crc32c hash.Hash32
+	size   int64
+}
+
+func NewChecksumReader(reader io.Reader) *ChecksumReader {
+	return &ChecksumReader{
+		reader: reader,
+		sha256: sha256.New(),
+		md5:    md5.New(),
+		crc32c: crc32.New(crc32.MakeTable(crc32.Castagnoli)),
+	}
+}
+
+func (c *ChecksumReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.sha256.Write(p[:n])
+	c.md5.Write(p[:n])
+	c.crc32c.Write(p[:n])
+	c.size += int64(n)
+	return n, err
+}
+
+// Size returns the number of bytes read so far.
+func (c *ChecksumReader) Size() int64 {
+	return c.size
+}
+
+func (c *ChecksumReader) Checksums() *Checksums {
+	return &Checksums{
+		SHA256: base64.StdEncoding.EncodeToString(c.sha256.Sum(nil)),
+		MD5:    c.md5.Sum(nil),
+		CRC32C: c.crc32c.Sum32(),
+	}
+}
+
+// ReadWithChecksums reads files of up to limit bytes, for providers that need
+// the checksums before the first byte is sent. A larger file isn't buffered,
+// it's returned as a ChecksumReader to stream instead, with checksums that are
+// known once it's read to the end.
+func ReadWithChecksums(file File, limit int64) ([]byte, *Checksums, *ChecksumReader, error) {
+	content, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		var integrityError *common.IntegrityError
+		if errors.As(err, &integrityError) {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, &common.UploadError{Message: err.Error()}
+	}
+	if int64(len(content)) > limit {
+		return nil, nil, NewChecksumReader(io.MultiReader(bytes.NewReader(content), file)), nil
+	}
+	reader := NewChecksumReader(bytes.NewReader(content))
+	io.Copy(io.Discard, reader)
+	checksums := reader.Checksums()
+	if err := VerifyUploadChecksum(file, checksums); err != nil {
+		return nil, nil, nil, err
+	}
+	return content, checksums, nil, nil
+}
+
+// VerifyUploadChecksum rejects an upload whose content doesn't match the
+// checksum the caller supplied in its metadata, if any.
+func VerifyUploadChecksum(file File, checksums *Checksums) error {
+	expected := GetMetadata(file).Get(ChecksumMetadataKey)
+	if len(expected) > 0 && expected != checksums.SHA256 {
+		return &common.IntegrityError{
+			ObjectId: file.Name(),
+			Message:  "uploaded content doesn't match checksum " + expected,
+		}
+	}
+	return nil
+}
+
+// verifyContent checks content read from file against the caller's checksum,
+// for stores that transform the content before it's uploaded.
+func verifyContent(file File, content []byte) error {
+	if len(GetMetadata(file).Get(ChecksumMetadataKey)) == 0 {
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	return VerifyUploadChecksum(file, &Checksums{SHA256: base64.StdEncoding.EncodeToString(sum[:])})
+}
+
+// WithChecksum returns a copy of metadata carrying the checksum.
+func WithChecksum(metadata *Metadata, checksums *Checksums) *Metadata {
+	withChecksum := metadata.Clone()
+	withChecksum.Set(ChecksumMetadataKey, checksums.SHA256)
+	return withChecksum
+}
+
+// VerifyingFile checks the file against its stored checksum once it's read
+// to the end, the final Read returns an IntegrityError instead of io.EOF on
+// a mismatch. Files without a checksum are returned as they are.
+func VerifyingFile(file File) File {
+	expected := GetMetadata(file).Get(ChecksumMetadataKey)
+	if len(expected) == 0 {
+		return file
+	}
+	return &verifyingFile{File: file, expected: expected, sha256: sha256.New()}
+}
+
+type verifyingFile struct {
+	File
+	expected string
+	sha256   hash.Hash
+}
+
+func (v *verifyingFile) Read(p []byte) (int, error) {
+	n, err := v.File.Read(p)
+	v.sha256.Write(p[:n])
+	if err == io.EOF {
+		if actual := base64.StdEncoding.EncodeToString(v.sha256.Sum(nil)); actual != v.expected {
+			return n, &common.IntegrityError{
+				ObjectId: v.Name(),
+				Message:  "downloaded content has checksum " + actual + ", expected " + v.expected,
+			}
+		}
+	}
+	return n, err
+}
+
+func (v *verifyingFile) Metadata() *Metadata {
+	return GetMetadata(v.File)
+}
+
+// readError keeps an IntegrityError from reading a VerifyingFile typed.
+func readError(err error) error {
+	var integrityError *common.IntegrityError
+	if errors.As(err, &integrityError) {
+		return err
+	}
+	return &common.DownloadError{Message: err.Error()}
+}
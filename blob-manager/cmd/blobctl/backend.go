@@ -0,0 +1,50 @@
+package main
+
+import (
+	blobmanager "blob-manager"
+	"blob-manager/aws"
+	"blob-manager/gcs"
+	"blob-manager/local"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// openBackend creates the BlobStore for a backend spec:
+//
+//	s3://bucket?region=eu-north-1&endpoint=http://localhost:9000&path-style=true
+//	gcs://bucket?credentials=/path/to/credentials.json
+//	local:///path/to/dir, or just a directory
+//
+// S3 credentials come from the default chain, GCS credentials default to
+// GOOGLE_APPLICATION_CREDENTIALS.
+func openBackend(ctx *context.Context, spec string) (blobmanager.BlobStore, error) {
+	if !strings.Contains(spec, "://") {
+		return local.CreateFileSystemClient(spec)
+	}
+	backend, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend: %q, reason: %w", spec, err)
+	}
+	query := backend.Query()
+	switch backend.Scheme {
+	case "s3":
+		return aws.CreateS3Client(&aws.AWSConfig{
+			BucketName:     backend.Host,
+			Region:         query.Get("region"),
+			Endpoint:       query.Get("endpoint"),
+			ForcePathStyle: query.Get("path-style") == "true",
+		})
+	case "gcs":
+		credentials := query.Get("credentials")
+		if len(credentials) == 0 {
+			credentials = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		}
+		return gcs.CreateGCSClient(ctx, credentials, backend.Host), nil
+	case "local", "file":
+		return local.CreateFileSystemClient(backend.Path)
+	}
+	return nil, fmt.Errorf("unknown backend: %q, expected s3, gcs or local", backend.Scheme)
+}
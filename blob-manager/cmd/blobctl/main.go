@@ -0,0 +1,92 @@
+// blobctl copies, syncs and verifies the objects under a prefix between two
+// blob stores, e.g. to move from S3 to GCS:
+//
+//	blobctl copy -src s3://profiles?region=eu-north-1 -dst gcs://profiles -checkpoint copy.json
+//	blobctl verify -src s3://profiles?region=eu-north-1 -dst gcs://profiles -checksum
+//
+// It exits with 1 when an object failed or, for verify, when the stores
+// differ, and with 2 on invalid arguments.
+package main
+
+import (
+	"blob-manager/migration"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	mode := migration.Mode(args[0])
+	if mode != migration.ModeCopy && mode != migration.ModeSync && mode != migration.ModeVerify {
+		usage()
+		return 2
+	}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	source := flags.String("src", "", "source backend")
+	destination := flags.String("dst", "", "destination backend")
+	options := &migration.Options{}
+	flags.StringVar(&options.Prefix, "prefix", "", "only migrate objects under this prefix")
+	flags.IntVar(&options.Concurrency, "concurrency", 8, "objects migrated in parallel")
+	flags.BoolVar(&options.CompareChecksums, "checksum", false,
+		"compare stored checksums as well as sizes")
+	flags.StringVar(&options.CheckpointFile, "checkpoint", "", "file to resume an interrupted run from")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if len(*source) == 0 || len(*destination) == 0 {
+		fmt.Fprintln(os.Stderr, "both -src and -dst are required")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sourceStore, err := openBackend(&ctx, *source)
+	if err != nil {
+		log.Printf("failed to open source, reason: %v", err)
+		return 2
+	}
+	destinationStore, err := openBackend(&ctx, *destination)
+	if err != nil {
+		log.Printf("failed to open destination, reason: %v", err)
+		return 2
+	}
+	m, err := migration.CreateMigration(mode, sourceStore, destinationStore, options)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+
+	report, err := m.Run(&ctx)
+	log.Printf("%s: %s", mode, report)
+	if err != nil {
+		log.Printf("%s failed, reason: %v", mode, err)
+		return 1
+	}
+	if report.Missing > 0 || report.Different > 0 {
+		return 1
+	}
+	return 0
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: blobctl copy|sync|verify -src <backend> -dst <backend> [flags]
+
+backends:
+  s3://bucket?region=<region>&endpoint=<url>&path-style=true
+  gcs://bucket?credentials=<credentials file>
+  local:///path/to/dir
+
+run "blobctl <command> -h" for the flags`)
+}
@@ -25,3 +25,69 @@ func (e *UploadError) Error() string {
 func (e *DownloadError) Error() string {
 	return "failed to download file, reason:" + e.Message
 }
+
+type UnsupportedOperationError struct {
+	Operation string
+}
+
+func (e *UnsupportedOperationError) Error() string {
+	return fmt.Sprintf("operation %s is not supported by the blob store", e.Operation)
+}
+
+type SigningError struct {
+	Message string
+}
+
+func (e *SigningError) Error() string {
+	return "failed to sign url, reason:" + e.Message
+}
+
+type EncryptionError struct {
+	Message string
+}
+
+func (e *EncryptionError) Error() string {
+	return "failed to encrypt or decrypt object, reason:" + e.Message
+}
+
+type ReplicationError struct {
+	Message string
+}
+
+func (e *ReplicationError) Error() string {
+	return "failed to replicate object, reason:" + e.Message
+}
+
+type IntegrityError struct {
+	ObjectId string
+	Message  string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("integrity check of object with id: %s failed, reason: %s", e.ObjectId, e.Message)
+}
+
+type ObjectTooLargeError struct {
+	Message string
+}
+
+func (e *ObjectTooLargeError) Error() string {
+	return e.Message
+}
+
+type ContentTypeNotAllowedError struct {
+	ContentType string
+}
+
+func (e *ContentTypeNotAllowedError) Error() string {
+	return fmt.Sprintf("content type %q is not allowed", e.ContentType)
+}
+
+type QuotaExceededError struct {
+	Owner   string
+	Message string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("storage quota of %s exceeded, reason: %s", e.Owner, e.Message)
+}
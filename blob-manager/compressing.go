@@ -0,0 +1,363 @@
+package blobmanager
+
+import (
+	common "blob-manager/common"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EncodingMetadataKey records how an object was compressed, objects
+	// without it are stored as uploaded.
+	EncodingMetadataKey      = "blob-encoding"
+	uncompressedSizeMetadata = "blob-uncompressed-size"
+)
+
+type Encoding string
+
+const (
+	EncodingGzip Encoding = "gzip"
+	EncodingZstd Encoding = "zstd"
+)
+
+// DefaultCompressibleTypes are text based formats. Images, video and archives
+// are compressed already and aren't listed.
+var DefaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/*+xml",
+	"application/javascript",
+	"application/x-tar",
+	"image/svg+xml",
+}
+
+// CompressionOptions configure a CompressingBlobStore. Encoding defaults to
+// gzip and CompressibleTypes to DefaultCompressibleTypes, a type may end in
+// "/*" or contain "*+" to match a whole family. Objects smaller than MinSize
+// are stored as uploaded.
+type CompressionOptions struct {
+	Encoding          Encoding
+	CompressibleTypes []string
+	MinSize           int64
+}
+
+// CompressingBlobStore compresses objects of compressible content types
+// before they reach the wrapped store and decompresses them on Download. The
+// encoding travels as object metadata, so objects stored before compression
+// was enabled, and objects that didn't shrink, are returned as stored.
+//
+// Uploads are buffered in memory to compress them, downloads are
+// decompressed while they are read.
+type CompressingBlobStore struct {
+	store   BlobStore
+	options *CompressionOptions
+}
+
+func CreateCompressingBlobStore(store BlobStore, options *CompressionOptions) (*CompressingBlobStore, error) {
+	if options == nil {
+		options = &CompressionOptions{}
+	}
+	switch options.Encoding {
+	case "":
+		options.Encoding = EncodingGzip
+	case EncodingGzip, EncodingZstd:
+	default:
+		return nil, fmt.Errorf("unsupported compression encoding: %q", options.Encoding)
+	}
+	if options.CompressibleTypes == nil {
+		options.CompressibleTypes = DefaultCompressibleTypes
+	}
+	return &CompressingBlobStore{store: store, options: options}, nil
+}
+
+func (c *CompressingBlobStore) Upload(ctx *context.Context, file File) error {
+	if !c.compressible(file) {
+		return c.store.Upload(ctx, file)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	if err := verifyContent(file, content); err != nil {
+		return err
+	}
+	metadata := stripCompressionMetadata(GetMetadata(file))
+	compressed, err := compress(c.options.Encoding, content)
+	if err != nil {
+		return &common.UploadError{
+			Message: fmt.Sprintf("failed to compress object: %s, reason: %v", file.Name(), err)}
+	}
+	if len(compressed) >= len(content) {
+		return c.store.Upload(ctx, newBufferedFile(file.Name(), file.Type(), content, metadata))
+	}
+	metadata.Set(EncodingMetadataKey, string(c.options.Encoding))
+	metadata.Set(uncompressedSizeMetadata, strconv.Itoa(len(content)))
+	return c.store.Upload(ctx, newBufferedFile(file.Name(), file.Type(), compressed, metadata))
+}
+
+func (c *CompressingBlobStore) Download(ctx *context.Context, fileName string) (File, error) {
+	file, err := c.store.Download(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	metadata := GetMetadata(file)
+	encoding := Encoding(metadata.Get(EncodingMetadataKey))
+	if len(encoding) == 0 {
+		return file, nil
+	}
+	decompressed, err := newDecompressingFile(file, encoding, metadata)
+	if err != nil {
+		file.Close()
+		return nil, &common.DownloadError{
+			Message: fmt.Sprintf("failed to decompress object with id: %s, reason: %v", fileName, err)}
+	}
+	return decompressed, nil
+}
+
+// DownloadRange reads compressed objects from the start and skips to offset,
+// a compressed stream can't be entered in the middle.
+func (c *CompressingBlobStore) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (File, error) {
+	info, err := c.store.Stat(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Metadata.Get(EncodingMetadataKey)) == 0 {
+		return c.downloadStoredRange(ctx, fileName, offset, length)
+	}
+
+	file, err := c.Download(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	decompressed, ok := file.(*decompressingFile)
+	if !ok {
+		// replaced by an uncompressed object since the Stat
+		file.Close()
+		return c.downloadStoredRange(ctx, fileName, offset, length)
+	}
+	// objects without their uncompressed size have a size of -1, the offset
+	// is then only found to be past the end while skipping to it
+	invalidOffset := &common.DownloadError{
+		Message: fmt.Sprintf("invalid range offset: %d for file with id: %s", offset, fileName)}
+	if offset < 0 || (decompressed.size >= 0 && offset > decompressed.size) {
+		file.Close()
+		return nil, invalidOffset
+	}
+	if _, err := io.CopyN(io.Discard, decompressed.reader, offset); err != nil {
+		file.Close()
+		if err == io.EOF {
+			return nil, invalidOffset
+		}
+		return nil, readError(err)
+	}
+	if decompressed.size >= 0 {
+		decompressed.size -= offset
+		if length < 0 || length > decompressed.size {
+			length = decompressed.size
+		}
+		decompressed.size = length
+	}
+	if length >= 0 {
+		decompressed.reader = io.LimitReader(decompressed.reader, length)
+	}
+	return decompressed, nil
+}
+
+func (c *CompressingBlobStore) downloadStoredRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (File, error) {
+	rangeReader, ok := c.store.(RangeReader)
+	if !ok {
+		return nil, &common.UnsupportedOperationError{Operation: "DownloadRange"}
+	}
+	return rangeReader.DownloadRange(ctx, fileName, offset, length)
+}
+
+func (c *CompressingBlobStore) Delete(ctx *context.Context, fileName string) error {
+	return c.store.Delete(ctx, fileName)
+}
+
+// Stat reports the uncompressed size of compressed objects.
+func (c *CompressingBlobStore) Stat(ctx *context.Context, fileName string) (*ObjectInfo, error) {
+	info, err := c.store.Stat(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Metadata.Get(EncodingMetadataKey)) > 0 {
+		info.Size = uncompressedSize(info.Metadata, info.Size)
+		info.Metadata = stripCompressionMetadata(info.Metadata)
+	}
+	return info, nil
+}
+
+func (c *CompressingBlobStore) Exists(ctx *context.Context, fileName string) (bool, error) {
+	return c.store.Exists(ctx, fileName)
+}
+
+// List passes through to the wrapped store, listings don't carry metadata so
+// sizes of compressed objects are their stored sizes.
+func (c *CompressingBlobStore) List(ctx *context.Context, prefix string, pageToken string) (*ObjectPage, error) {
+	return c.store.List(ctx, prefix, pageToken)
+}
+
+// SignedUploadURL lets objects bypass compression, they are stored and
+// returned as uploaded.
+func (c *CompressingBlobStore) SignedUploadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := c.store.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedUploadURL"}
+	}
+	return signer.SignedUploadURL(ctx, fileName, options)
+}
+
+// SignedDownloadURL only signs objects stored uncompressed, a client would
+// get the compressed content otherwise.
+func (c *CompressingBlobStore) SignedDownloadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := c.store.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedDownloadURL"}
+	}
+	info, err := c.store.Stat(ctx, fileName)
+	if err != nil {
+		return "", err
+	}
+	if len(info.Metadata.Get(EncodingMetadataKey)) > 0 {
+		return "", &common.UnsupportedOperationError{Operation: "SignedDownloadURL"}
+	}
+	return signer.SignedDownloadURL(ctx, fileName, options)
+}
+
+func (c *CompressingBlobStore) compressible(file File) bool {
+	if file.Size() >= 0 && file.Size() < c.options.MinSize {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(file.Type())
+	if err != nil {
+		return false
+	}
+	for _, compressibleType := range c.options.CompressibleTypes {
+		if matchesMediaType(mediaType, strings.ToLower(compressibleType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMediaType matches "type/*" against any subtype and "type/*+suffix"
+// against any subtype with that suffix.
+func matchesMediaType(mediaType string, pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	if prefix, suffix, ok := strings.Cut(pattern, "*"); ok {
+		return strings.HasPrefix(mediaType, prefix) && strings.HasSuffix(mediaType, suffix)
+	}
+	return mediaType == pattern
+}
+
+func compress(encoding Encoding, content []byte) ([]byte, error) {
+	if encoding == EncodingZstd {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(content, nil), nil
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decompressingFile decompresses the wrapped file while it is read.
+type decompressingFile struct {
+	File
+	reader   io.Reader
+	size     int64
+	metadata *Metadata
+	closer   func()
+}
+
+func newDecompressingFile(file File, encoding Encoding, metadata *Metadata) (*decompressingFile, error) {
+	decompressed := &decompressingFile{
+		File:     file,
+		size:     uncompressedSize(metadata, -1),
+		metadata: stripCompressionMetadata(metadata),
+		closer:   func() {},
+	}
+	switch encoding {
+	case EncodingGzip:
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		decompressed.reader = reader
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		decompressed.reader, decompressed.closer = decoder, decoder.Close
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %q", encoding)
+	}
+	return decompressed, nil
+}
+
+func (d *decompressingFile) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = readError(err)
+	}
+	return n, err
+}
+
+func (d *decompressingFile) Size() int64 {
+	return d.size
+}
+
+func (d *decompressingFile) Metadata() *Metadata {
+	return d.metadata
+}
+
+func (d *decompressingFile) Close() error {
+	d.closer()
+	return d.File.Close()
+}
+
+func uncompressedSize(metadata *Metadata, defaultSize int64) int64 {
+	size, err := strconv.ParseInt(metadata.Get(uncompressedSizeMetadata), 10, 64)
+	if err != nil {
+		return defaultSize
+	}
+	return size
+}
+
+// stripCompressionMetadata drops the checksum too, it's that of the
+// compressed content.
+func stripCompressionMetadata(metadata *Metadata) *Metadata {
+	stripped := metadata.Clone()
+	for _, key := range []string{EncodingMetadataKey, uncompressedSizeMetadata, ChecksumMetadataKey} {
+		delete(stripped.UserMetadata, key)
+	}
+	return stripped
+}
@@ -0,0 +1,355 @@
+package blobmanager
+
+import (
+	common "blob-manager/common"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	encryptionAlgorithmMetadata = "blob-enc-alg"
+	encryptionKeyIdMetadata     = "blob-enc-key-id"
+	wrappedKeyMetadata          = "blob-enc-wrapped-key"
+	encryptionNonceMetadata     = "blob-enc-nonce"
+	encryptionAlgorithm         = "AES-256-GCM"
+	dataKeySize                 = 32
+	gcmNonceSize                = 12
+	gcmOverhead                 = 16
+)
+
+// Keyring holds the master keys that wrap data keys. New objects are
+// encrypted under ActiveKeyId, retired keys stay in MasterKeys so objects
+// written with them can still be read until they are rewrapped.
+type Keyring struct {
+	ActiveKeyId string
+	MasterKeys  map[string][]byte
+}
+
+// ParseKeyring parses master keys given as "id:base64key,id:base64key".
+func ParseKeyring(activeKeyId string, masterKeys string) (*Keyring, error) {
+	keyring := &Keyring{ActiveKeyId: activeKeyId, MasterKeys: map[string][]byte{}}
+	for _, entry := range strings.Split(masterKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		keyId, encodedKey, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid master key entry: %q", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key with id: %s, reason: %w", keyId, err)
+		}
+		keyring.MasterKeys[keyId] = key
+	}
+	return keyring, keyring.validate()
+}
+
+func (k *Keyring) validate() error {
+	if _, ok := k.MasterKeys[k.ActiveKeyId]; !ok {
+		return fmt.Errorf("active master key with id: %q is not configured", k.ActiveKeyId)
+	}
+	for keyId, key := range k.MasterKeys {
+		if len(key) != dataKeySize {
+			return fmt.Errorf("master key with id: %s must be %d bytes, got %d", keyId, dataKeySize, len(key))
+		}
+	}
+	return nil
+}
+
+// EncryptingBlobStore encrypts objects before they reach the wrapped store.
+// Every object gets its own random data key, the content is sealed with
+// AES-256-GCM and the data key is wrapped with the active master key. The
+// wrapped key, its master key id and the nonce travel as object metadata, so
+// any backend that keeps user metadata works.
+//
+// Objects are buffered in memory to encrypt and to authenticate them. The
+// content is bound to the object's name and the wrapped data key to the name
+// and master key id, so neither can be moved to another object.
+type EncryptingBlobStore struct {
+	store   BlobStore
+	keyring *Keyring
+	options *EncryptionOptions
+}
+
+// EncryptionOptions with AllowPlaintext return objects without encryption
+// metadata as stored, and Rewrap encrypts them, so a bucket can be switched
+// over before its existing objects are migrated. Otherwise reading one fails,
+// anyone able to write to the bucket could place unencrypted content.
+// Uploads larger than MaxObjectSize are rejected, 0 uses
+// DefaultMaxBufferedSize.
+type EncryptionOptions struct {
+	AllowPlaintext bool
+	MaxObjectSize  int64
+}
+
+// CreateEncryptingBlobStore only reads encrypted objects when options is nil.
+func CreateEncryptingBlobStore(store BlobStore, keyring *Keyring,
+	options *EncryptionOptions) (*EncryptingBlobStore, error) {
+	if keyring == nil {
+		return nil, errors.New("keyring for encrypting blob store is not configured")
+	}
+	if err := keyring.validate(); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &EncryptionOptions{}
+	}
+	return &EncryptingBlobStore{store: store, keyring: keyring, options: options}, nil
+}
+
+func (e *EncryptingBlobStore) Upload(ctx *context.Context, file File) error {
+	defer file.Close()
+	maxSize := e.options.MaxObjectSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBufferedSize
+	}
+	plaintext, streamed, err := readBuffered(file, maxSize)
+	if err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	if streamed != nil {
+		return &common.ObjectTooLargeError{
+			Message: fmt.Sprintf("object %s is larger than %d bytes", file.Name(), maxSize)}
+	}
+	if err := verifyContent(file, plaintext); err != nil {
+		return err
+	}
+	return e.encrypt(ctx, file.Name(), file.Type(), plaintext, stripEncryptionMetadata(GetMetadata(file)))
+}
+
+func (e *EncryptingBlobStore) encrypt(ctx *context.Context, fileName string, contentType string,
+	plaintext []byte, metadata *Metadata) error {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return &common.EncryptionError{Message: err.Error()}
+	}
+	nonce, ciphertext, err := seal(dataKey, plaintext, contentAAD(fileName))
+	if err != nil {
+		return &common.EncryptionError{Message: err.Error()}
+	}
+	metadata, err = e.wrap(fileName, metadata, dataKey, nonce)
+	if err != nil {
+		return err
+	}
+	return e.store.Upload(ctx, newBufferedFile(fileName, contentType, ciphertext, metadata))
+}
+
+func (e *EncryptingBlobStore) Download(ctx *context.Context, fileName string) (File, error) {
+	file, err := e.store.Download(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metadata := GetMetadata(file)
+	if len(metadata.Get(encryptionKeyIdMetadata)) == 0 {
+		if !e.options.AllowPlaintext {
+			return nil, notEncryptedError(fileName)
+		}
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return nil, readError(err)
+		}
+		return newBufferedFile(fileName, file.Type(), content, metadata), nil
+	}
+
+	ciphertext, err := io.ReadAll(file)
+	if err != nil {
+		return nil, readError(err)
+	}
+	dataKey, nonce, err := e.unwrap(fileName, metadata)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(dataKey, nonce, ciphertext, contentAAD(fileName))
+	if err != nil {
+		return nil, &common.EncryptionError{
+			Message: fmt.Sprintf("failed to decrypt object with id: %s, reason: %s", fileName, err.Error())}
+	}
+	return newBufferedFile(fileName, file.Type(), plaintext, stripEncryptionMetadata(metadata)), nil
+}
+
+func notEncryptedError(fileName string) error {
+	return &common.EncryptionError{Message: fmt.Sprintf("object with id: %s is not encrypted", fileName)}
+}
+
+// DownloadRange decrypts the whole object, GCM can't authenticate a part of it.
+func (e *EncryptingBlobStore) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (File, error) {
+	file, err := e.Download(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	content, _ := io.ReadAll(file)
+	if offset < 0 || offset > int64(len(content)) {
+		return nil, &common.DownloadError{
+			Message: fmt.Sprintf("invalid range offset: %d for file with id: %s", offset, fileName)}
+	}
+	end := int64(len(content))
+	if length >= 0 && offset+length < end {
+		end = offset + length
+	}
+	return newBufferedFile(fileName, file.Type(), content[offset:end], GetMetadata(file)), nil
+}
+
+func (e *EncryptingBlobStore) Delete(ctx *context.Context, fileName string) error {
+	return e.store.Delete(ctx, fileName)
+}
+
+// Stat reports the plaintext size of encrypted objects.
+func (e *EncryptingBlobStore) Stat(ctx *context.Context, fileName string) (*ObjectInfo, error) {
+	info, err := e.store.Stat(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Metadata.Get(encryptionKeyIdMetadata)) > 0 {
+		info.Size -= gcmOverhead
+		info.Metadata = stripEncryptionMetadata(info.Metadata)
+	}
+	return info, nil
+}
+
+func (e *EncryptingBlobStore) Exists(ctx *context.Context, fileName string) (bool, error) {
+	return e.store.Exists(ctx, fileName)
+}
+
+// List passes through to the wrapped store, listings don't carry metadata so
+// sizes of encrypted objects include the GCM tag.
+func (e *EncryptingBlobStore) List(ctx *context.Context, prefix string, pageToken string) (*ObjectPage, error) {
+	return e.store.List(ctx, prefix, pageToken)
+}
+
+// Rewrap wraps the data key of an object with the active master key, so the
+// master key it was written with can be retired. The content isn't
+// re-encrypted, but the object is uploaded again with the new metadata. With
+// AllowPlaintext an unencrypted object is encrypted instead.
+func (e *EncryptingBlobStore) Rewrap(ctx *context.Context, fileName string) error {
+	file, err := e.store.Download(ctx, fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	metadata := GetMetadata(file)
+	keyId := metadata.Get(encryptionKeyIdMetadata)
+	if keyId == e.keyring.ActiveKeyId {
+		return nil
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return readError(err)
+	}
+	if len(keyId) == 0 {
+		if !e.options.AllowPlaintext {
+			return notEncryptedError(fileName)
+		}
+		return e.encrypt(ctx, fileName, file.Type(), content, stripEncryptionMetadata(metadata))
+	}
+	ciphertext := content
+	dataKey, nonce, err := e.unwrap(fileName, metadata)
+	if err != nil {
+		return err
+	}
+	rewrapped, err := e.wrap(fileName, metadata.Clone(), dataKey, nonce)
+	if err != nil {
+		return err
+	}
+	return e.store.Upload(ctx, newBufferedFile(fileName, file.Type(), ciphertext, rewrapped))
+}
+
+func (e *EncryptingBlobStore) wrap(fileName string, metadata *Metadata, dataKey []byte,
+	nonce []byte) (*Metadata, error) {
+	keyNonce, wrappedKey, err := seal(e.keyring.MasterKeys[e.keyring.ActiveKeyId], dataKey,
+		keyAAD(fileName, e.keyring.ActiveKeyId))
+	if err != nil {
+		return nil, &common.EncryptionError{Message: err.Error()}
+	}
+	metadata.Set(encryptionAlgorithmMetadata, encryptionAlgorithm)
+	metadata.Set(encryptionKeyIdMetadata, e.keyring.ActiveKeyId)
+	metadata.Set(wrappedKeyMetadata, base64.StdEncoding.EncodeToString(append(keyNonce, wrappedKey...)))
+	metadata.Set(encryptionNonceMetadata, base64.StdEncoding.EncodeToString(nonce))
+	return metadata, nil
+}
+
+func (e *EncryptingBlobStore) unwrap(fileName string, metadata *Metadata) ([]byte, []byte, error) {
+	keyId := metadata.Get(encryptionKeyIdMetadata)
+	masterKey, ok := e.keyring.MasterKeys[keyId]
+	if !ok {
+		return nil, nil, &common.EncryptionError{
+			Message: fmt.Sprintf("master key with id: %s for object with id: %s is not configured", keyId, fileName)}
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(metadata.Get(wrappedKeyMetadata))
+	if err != nil || len(wrappedKey) < gcmNonceSize {
+		return nil, nil, &common.EncryptionError{
+			Message: fmt.Sprintf("invalid wrapped key for object with id: %s", fileName)}
+	}
+	nonce, err := base64.StdEncoding.DecodeString(metadata.Get(encryptionNonceMetadata))
+	if err != nil || len(nonce) != gcmNonceSize {
+		return nil, nil, &common.EncryptionError{
+			Message: fmt.Sprintf("invalid nonce for object with id: %s", fileName)}
+	}
+	dataKey, err := open(masterKey, wrappedKey[:gcmNonceSize], wrappedKey[gcmNonceSize:], keyAAD(fileName, keyId))
+	if err != nil {
+		return nil, nil, &common.EncryptionError{
+			Message: fmt.Sprintf("failed to unwrap data key for object with id: %s, reason: %s",
+				fileName, err.Error())}
+	}
+	return dataKey, nonce, nil
+}
+
+// contentAAD binds the content to the object's name.
+func contentAAD(fileName string) []byte {
+	return []byte(fileName)
+}
+
+// keyAAD binds a wrapped data key to the object's name and its master key.
+func keyAAD(fileName string, keyId string) []byte {
+	return []byte(keyId + "\x00" + fileName)
+}
+
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, []byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func open(key []byte, nonce []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// stripEncryptionMetadata drops the checksum too, it's that of the ciphertext.
+func stripEncryptionMetadata(metadata *Metadata) *Metadata {
+	stripped := metadata.Clone()
+	for _, key := range []string{encryptionAlgorithmMetadata, encryptionKeyIdMetadata,
+		wrappedKeyMetadata, encryptionNonceMetadata, ChecksumMetadataKey} {
+		delete(stripped.UserMetadata, key)
+	}
+	return stripped
+}
@@ -1,8 +1,16 @@
 package gcs
 
-import "context"
+import (
+	common "blob-manager/common"
+	"cloud.google.com/go/storage"
+	"context"
+	"errors"
+)
 
 func (g *GoogleStorageClient) Delete(ctx *context.Context, fileName string) error {
 	err := g.client.Bucket(g.bucket).Object(fileName).Delete(*ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return &common.ObjectNotFound{ObjectId: fileName}
+	}
 	return err
 }
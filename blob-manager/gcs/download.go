@@ -5,36 +5,78 @@ import (
 	common "blob-manager/common"
 	"cloud.google.com/go/storage"
 	"context"
+	"errors"
 )
 
 func (g *GoogleStorageClient) Download(ctx *context.Context, fileName string) (blob_manager.File, error) {
-	rc, err := g.client.Bucket(g.bucket).Object(fileName).NewReader(*ctx)
+	file, err := g.download(ctx, fileName, 0, -1)
 	if err != nil {
-		if storage.ErrObjectNotExist == err {
-			return nil, &common.ObjectNotFound{ObjectId: fileName}
-		}
-		return nil, &common.DownloadError{
-			Message: err.Error(),
-		}
+		return nil, err
+	}
+	return blob_manager.VerifyingFile(file), nil
+}
+
+func (g *GoogleStorageClient) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (blob_manager.File, error) {
+	if offset < 0 {
+		return nil, &common.DownloadError{Message: "negative offset for file with id: " + fileName}
+	}
+	return g.download(ctx, fileName, offset, length)
+}
+
+// download reads the object attributes first, since the reader only carries
+// a few of them, and pins the reader to the same generation.
+func (g *GoogleStorageClient) download(ctx *context.Context, fileName string,
+	offset int64, length int64) (blob_manager.File, error) {
+	object := g.client.Bucket(g.bucket).Object(fileName)
+	attrs, err := object.Attrs(*ctx)
+	if err != nil {
+		return nil, downloadError(fileName, err)
+	}
+	rc, err := object.Generation(attrs.Generation).NewRangeReader(*ctx, offset, length)
+	if err != nil {
+		return nil, downloadError(fileName, err)
 	}
 	cloudStorageObject := &CloudStorageObject{
 		FileName:      fileName,
 		StorageReader: rc,
+		ObjectAttrs:   attrs,
+		contentLength: rc.Remain(),
 	}
 	return cloudStorageObject, nil
 }
 
+func downloadError(fileName string, err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return &common.ObjectNotFound{ObjectId: fileName}
+	}
+	return &common.DownloadError{
+		Message: err.Error(),
+	}
+}
+
 type CloudStorageObject struct {
 	FileName      string
 	StorageReader *storage.Reader
+	ObjectAttrs   *storage.ObjectAttrs
+	contentLength int64
 }
 
 func (o *CloudStorageObject) Type() string {
 	return o.StorageReader.Attrs.ContentType
 }
 
+// Size is the number of bytes the reader yields, which is less than the
+// object size for ranged downloads.
 func (o *CloudStorageObject) Size() int64 {
-	return o.StorageReader.Attrs.Size
+	if o.contentLength < 0 {
+		return o.StorageReader.Attrs.Size
+	}
+	return o.contentLength
+}
+
+func (o *CloudStorageObject) Metadata() *blob_manager.Metadata {
+	return objectMetadata(o.ObjectAttrs)
 }
 
 func (o *CloudStorageObject) Read(p []byte) (n int, err error) {
@@ -0,0 +1,31 @@
+package gcs
+
+import (
+	blob_manager "blob-manager"
+	"cloud.google.com/go/storage"
+	"context"
+	"google.golang.org/api/iterator"
+	"strings"
+)
+
+func (g *GoogleStorageClient) List(ctx *context.Context, prefix string, pageToken string) (*blob_manager.ObjectPage, error) {
+	it := g.client.Bucket(g.bucket).Objects(*ctx, &storage.Query{Prefix: prefix})
+	var attrs []*storage.ObjectAttrs
+	nextPageToken, err := iterator.NewPager(it, blob_manager.ListPageSize, pageToken).NextPage(&attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &blob_manager.ObjectPage{
+		Objects:       make([]*blob_manager.ObjectInfo, 0, len(attrs)),
+		NextPageToken: nextPageToken,
+	}
+	for _, objectAttrs := range attrs {
+		// staged uploads aren't objects yet
+		if strings.HasPrefix(objectAttrs.Name, blob_manager.StagingPrefix) {
+			continue
+		}
+		page.Objects = append(page.Objects, objectInfo(objectAttrs))
+	}
+	return page, nil
+}
@@ -0,0 +1,42 @@
+package gcs
+
+import (
+	blob_manager "blob-manager"
+	common "blob-manager/common"
+	"cloud.google.com/go/storage"
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func (g *GoogleStorageClient) SignedUploadURL(ctx *context.Context, fileName string,
+	options *blob_manager.SignOptions) (string, error) {
+	signedURL, err := g.client.Bucket(g.bucket).SignedURL(fileName, &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      http.MethodPut,
+		Expires:     time.Now().Add(options.GetExpiry()),
+		ContentType: options.GetContentType(),
+	})
+	if err != nil {
+		return "", &common.SigningError{Message: err.Error()}
+	}
+	return signedURL, nil
+}
+
+func (g *GoogleStorageClient) SignedDownloadURL(ctx *context.Context, fileName string,
+	options *blob_manager.SignOptions) (string, error) {
+	signOptions := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(options.GetExpiry()),
+	}
+	if contentType := options.GetContentType(); len(contentType) > 0 {
+		signOptions.QueryParameters = url.Values{"response-content-type": {contentType}}
+	}
+	signedURL, err := g.client.Bucket(g.bucket).SignedURL(fileName, signOptions)
+	if err != nil {
+		return "", &common.SigningError{Message: err.Error()}
+	}
+	return signedURL, nil
+}
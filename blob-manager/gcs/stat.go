@@ -0,0 +1,51 @@
+package gcs
+
+import (
+	blob_manager "blob-manager"
+	common "blob-manager/common"
+	"cloud.google.com/go/storage"
+	"context"
+	"errors"
+)
+
+func (g *GoogleStorageClient) Stat(ctx *context.Context, fileName string) (*blob_manager.ObjectInfo, error) {
+	attrs, err := g.client.Bucket(g.bucket).Object(fileName).Attrs(*ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, &common.ObjectNotFound{ObjectId: fileName}
+		}
+		return nil, err
+	}
+	return objectInfo(attrs), nil
+}
+
+func (g *GoogleStorageClient) Exists(ctx *context.Context, fileName string) (bool, error) {
+	_, err := g.Stat(ctx, fileName)
+	if err != nil {
+		var notFound *common.ObjectNotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func objectInfo(attrs *storage.ObjectAttrs) *blob_manager.ObjectInfo {
+	return &blob_manager.ObjectInfo{
+		Name:         attrs.Name,
+		Size:         attrs.Size,
+		ContentType:  attrs.ContentType,
+		ETag:         attrs.Etag,
+		LastModified: attrs.Updated,
+		Metadata:     objectMetadata(attrs),
+	}
+}
+
+func objectMetadata(attrs *storage.ObjectAttrs) *blob_manager.Metadata {
+	return &blob_manager.Metadata{
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		UserMetadata:       blob_manager.NormalizeUserMetadata(attrs.Metadata),
+	}
+}
@@ -3,23 +3,93 @@ package gcs
 import (
 	blob_manager "blob-manager"
 	common "blob-manager/common"
+	"cloud.google.com/go/storage"
 	"context"
+	"google.golang.org/api/googleapi"
 	"io"
 	"log"
 )
 
+// Upload sends files of up to a chunk with their CRC32C, GCS rejects content
+// that doesn't match it. Larger files are streamed to a staging object and
+// compared with the checksum GCS reports, their SHA-256 is only known then.
+// They are copied over the object with it once they match. A failed upload
+// leaves the object as it was.
 func (g *GoogleStorageClient) Upload(ctx *context.Context, file blob_manager.File) error {
 	defer close(file)
-	wc := g.client.Bucket(g.bucket).Object(file.Name()).NewWriter(*ctx)
-	if _, err := io.Copy(wc, file); err != nil {
+	content, checksums, stream, err := blob_manager.ReadWithChecksums(file, googleapi.DefaultUploadChunkSize)
+	if err != nil {
+		return err
+	}
+	if stream != nil {
+		return g.uploadStreamed(ctx, file, stream)
+	}
+	// cancelling the writer's context before Close aborts the upload
+	uploadCtx, cancel := context.WithCancel(*ctx)
+	defer cancel()
+	metadata := blob_manager.WithChecksum(blob_manager.GetMetadata(file), checksums)
+	wc := g.client.Bucket(g.bucket).Object(file.Name()).NewWriter(uploadCtx)
+	wc.ObjectAttrs = objectAttrs(file, metadata)
+	wc.MD5 = checksums.MD5
+	wc.CRC32C = checksums.CRC32C
+	wc.SendCRC32C = true
+	if _, err := wc.Write(content); err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	if err := wc.Close(); err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	return nil
+}
+
+func (g *GoogleStorageClient) uploadStreamed(ctx *context.Context, file blob_manager.File,
+	stream *blob_manager.ChecksumReader) error {
+	stagingKey, err := blob_manager.NewStagingKey()
+	if err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	uploadCtx, cancel := context.WithCancel(*ctx)
+	defer cancel()
+	staged := g.client.Bucket(g.bucket).Object(stagingKey)
+	wc := staged.NewWriter(uploadCtx)
+	if _, err := io.Copy(wc, stream); err != nil {
 		return &common.UploadError{Message: err.Error()}
 	}
 	if err := wc.Close(); err != nil {
 		return &common.UploadError{Message: err.Error()}
 	}
+	defer func() {
+		if err := staged.Delete(*ctx); err != nil {
+			log.Printf("failed to delete staged upload: %s, reason: %v", stagingKey, err)
+		}
+	}()
+
+	checksums := stream.Checksums()
+	if err := blob_manager.VerifyUploadChecksum(file, checksums); err != nil {
+		return err
+	}
+	if wc.Attrs().CRC32C != checksums.CRC32C {
+		return &common.IntegrityError{ObjectId: file.Name(), Message: "stored content doesn't match the uploaded content"}
+	}
+	copier := g.client.Bucket(g.bucket).Object(file.Name()).CopierFrom(
+		staged.If(storage.Conditions{GenerationMatch: wc.Attrs().Generation}))
+	copier.ObjectAttrs = objectAttrs(file, blob_manager.WithChecksum(blob_manager.GetMetadata(file), checksums))
+	if _, err := copier.Run(*ctx); err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
 	return nil
 }
 
+func objectAttrs(file blob_manager.File, metadata *blob_manager.Metadata) storage.ObjectAttrs {
+	return storage.ObjectAttrs{
+		Name:               file.Name(),
+		ContentType:        file.Type(),
+		CacheControl:       metadata.CacheControl,
+		ContentDisposition: metadata.ContentDisposition,
+		Metadata:           metadata.UserMetadata,
+	}
+}
+
 func close(file blob_manager.File) {
 	err := file.Close()
 	if err != nil {
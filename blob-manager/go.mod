@@ -6,6 +6,7 @@ require (
 	cloud.google.com/go/storage v1.47.0
 	github.com/aws/aws-sdk-go v1.55.5
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.70.0
+	github.com/klauspost/compress v1.13.6
 	google.golang.org/api v0.203.0
 )
 
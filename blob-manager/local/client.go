@@ -0,0 +1,100 @@
+package local
+
+import (
+	blob_manager "blob-manager"
+	common "blob-manager/common"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	objectsDir  = "objects"
+	metadataDir = "metadata"
+	tempDir     = "tmp"
+)
+
+// FileSystemClient stores objects as plain files under a root directory.
+// Object content lives in <root>/objects/<key> and its content type and size
+// in <root>/metadata/<key>.json, so nested keys map onto nested directories.
+type FileSystemClient struct {
+	rootDir string
+}
+
+type objectMetadata struct {
+	ContentType        string            `json:"contentType"`
+	Size               int64             `json:"size"`
+	ETag               string            `json:"eTag"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	UserMetadata       map[string]string `json:"userMetadata,omitempty"`
+}
+
+func (m *objectMetadata) metadata() *blob_manager.Metadata {
+	return &blob_manager.Metadata{
+		CacheControl:       m.CacheControl,
+		ContentDisposition: m.ContentDisposition,
+		UserMetadata:       blob_manager.NormalizeUserMetadata(m.UserMetadata),
+	}
+}
+
+func CreateFileSystemClient(rootDir string) (*FileSystemClient, error) {
+	if len(rootDir) == 0 {
+		return nil, errors.New("root directory for local blob store is not configured")
+	}
+	for _, dir := range []string{objectsDir, metadataDir, tempDir} {
+		if err := os.MkdirAll(filepath.Join(rootDir, dir), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create local blob store directory, reason: %w", err)
+		}
+	}
+	return &FileSystemClient{rootDir: rootDir}, nil
+}
+
+func (f *FileSystemClient) objectPath(fileName string) (string, error) {
+	relative, err := relativePath(fileName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(f.rootDir, objectsDir, relative), nil
+}
+
+func (f *FileSystemClient) metadataPath(fileName string) (string, error) {
+	relative, err := relativePath(fileName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(f.rootDir, metadataDir, relative+".json"), nil
+}
+
+// relativePath rejects keys that would escape the root directory.
+func relativePath(fileName string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(fileName))
+	if len(fileName) == 0 || filepath.IsAbs(cleaned) || cleaned == "." ||
+		cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object name: %q", fileName)
+	}
+	return cleaned, nil
+}
+
+func (f *FileSystemClient) readMetadata(fileName string) (*objectMetadata, error) {
+	path, err := f.metadataPath(fileName)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &common.ObjectNotFound{ObjectId: fileName}
+		}
+		return nil, err
+	}
+	var metadata objectMetadata
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,51 @@
+package local
+
+import (
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+func (f *FileSystemClient) Delete(ctx *context.Context, fileName string) error {
+	if err := (*ctx).Err(); err != nil {
+		return err
+	}
+	objectPath, err := f.objectPath(fileName)
+	if err != nil {
+		return err
+	}
+	metadataPath, err := f.metadataPath(fileName)
+	if err != nil {
+		return err
+	}
+
+	// removing the metadata first uncommits the object, a crash before the
+	// object is removed leaves nothing visible behind
+	metadataErr := os.Remove(metadataPath)
+	if metadataErr != nil && !errors.Is(metadataErr, fs.ErrNotExist) {
+		return metadataErr
+	}
+	if err := os.Remove(objectPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if metadataErr != nil {
+		return &common.ObjectNotFound{ObjectId: fileName}
+	}
+
+	f.removeEmptyParents(filepath.Dir(objectPath), filepath.Join(f.rootDir, objectsDir))
+	f.removeEmptyParents(filepath.Dir(metadataPath), filepath.Join(f.rootDir, metadataDir))
+	return nil
+}
+
+// removeEmptyParents cleans up directories left behind by nested keys.
+func (f *FileSystemClient) removeEmptyParents(dir, stopAt string) {
+	for dir != stopAt && len(dir) > len(stopAt) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
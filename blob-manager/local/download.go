@@ -0,0 +1,117 @@
+package local
+
+import (
+	blob_manager "blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+func (f *FileSystemClient) Download(ctx *context.Context, fileName string) (blob_manager.File, error) {
+	if err := (*ctx).Err(); err != nil {
+		return nil, err
+	}
+	localFile, err := f.open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return blob_manager.VerifyingFile(localFile), nil
+}
+
+func (f *FileSystemClient) open(fileName string) (*LocalFile, error) {
+	objectPath, err := f.objectPath(fileName)
+	if err != nil {
+		return nil, &common.DownloadError{Message: err.Error()}
+	}
+	content, err := os.Open(objectPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &common.ObjectNotFound{ObjectId: fileName}
+		}
+		return nil, &common.DownloadError{Message: err.Error()}
+	}
+
+	metadata, err := f.readMetadata(fileName)
+	if err != nil {
+		content.Close()
+		var notFound *common.ObjectNotFound
+		if errors.As(err, &notFound) {
+			return nil, err
+		}
+		return nil, &common.DownloadError{Message: err.Error()}
+	}
+
+	return &LocalFile{
+		content:  content,
+		file:     content,
+		fileName: fileName,
+		fileType: metadata.ContentType,
+		fileSize: metadata.Size,
+		metadata: metadata.metadata(),
+	}, nil
+}
+
+func (f *FileSystemClient) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (blob_manager.File, error) {
+	if err := (*ctx).Err(); err != nil {
+		return nil, err
+	}
+	localFile, err := f.open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > localFile.fileSize {
+		localFile.Close()
+		return nil, &common.DownloadError{
+			Message: fmt.Sprintf("invalid range offset: %d for file with id: %s", offset, fileName)}
+	}
+	if _, err := localFile.file.Seek(offset, io.SeekStart); err != nil {
+		localFile.Close()
+		return nil, &common.DownloadError{Message: err.Error()}
+	}
+
+	remaining := localFile.fileSize - offset
+	if length < 0 || length > remaining {
+		length = remaining
+	}
+	localFile.content = io.LimitReader(localFile.file, length)
+	localFile.fileSize = length
+	return localFile, nil
+}
+
+type LocalFile struct {
+	content  io.Reader
+	file     *os.File
+	fileName string
+	fileType string
+	fileSize int64
+	metadata *blob_manager.Metadata
+}
+
+func (o *LocalFile) Type() string {
+	return o.fileType
+}
+
+func (o *LocalFile) Size() int64 {
+	return o.fileSize
+}
+
+func (o *LocalFile) Read(p []byte) (n int, err error) {
+	return o.content.Read(p)
+}
+
+func (o *LocalFile) Name() string {
+	return o.fileName
+}
+
+func (o *LocalFile) Metadata() *blob_manager.Metadata {
+	return o.metadata
+}
+
+func (o *LocalFile) Close() error {
+	return o.file.Close()
+}
@@ -0,0 +1,59 @@
+package local
+
+import (
+	blob_manager "blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// List walks the objects directory in key order, the page token is the last
+// key of the previous page. Objects without metadata aren't committed and
+// aren't listed.
+func (f *FileSystemClient) List(ctx *context.Context, prefix string, pageToken string) (*blob_manager.ObjectPage, error) {
+	if err := (*ctx).Err(); err != nil {
+		return nil, err
+	}
+	root := filepath.Join(f.rootDir, objectsDir)
+	var keys []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if strings.HasPrefix(key, prefix) && key > pageToken {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	page := &blob_manager.ObjectPage{}
+	if len(keys) > blob_manager.ListPageSize {
+		keys = keys[:blob_manager.ListPageSize]
+		page.NextPageToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		info, err := f.Stat(ctx, key)
+		var notFound *common.ObjectNotFound
+		if errors.As(err, &notFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		page.Objects = append(page.Objects, info)
+	}
+	return page, nil
+}
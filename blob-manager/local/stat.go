@@ -0,0 +1,55 @@
+package local
+
+import (
+	blob_manager "blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+func (f *FileSystemClient) Stat(ctx *context.Context, fileName string) (*blob_manager.ObjectInfo, error) {
+	if err := (*ctx).Err(); err != nil {
+		return nil, err
+	}
+	objectPath, err := f.objectPath(fileName)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(objectPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &common.ObjectNotFound{ObjectId: fileName}
+		}
+		return nil, err
+	}
+	if fileInfo.IsDir() {
+		return nil, &common.ObjectNotFound{ObjectId: fileName}
+	}
+
+	metadata, err := f.readMetadata(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &blob_manager.ObjectInfo{
+		Name:         fileName,
+		Size:         metadata.Size,
+		ContentType:  metadata.ContentType,
+		ETag:         metadata.ETag,
+		LastModified: fileInfo.ModTime(),
+		Metadata:     metadata.metadata(),
+	}, nil
+}
+
+func (f *FileSystemClient) Exists(ctx *context.Context, fileName string) (bool, error) {
+	_, err := f.Stat(ctx, fileName)
+	if err != nil {
+		var notFound *common.ObjectNotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,391 @@
+package test
+
+import (
+	"blob-manager"
+	common "blob-manager/common"
+	"blob-manager/local"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newBlobManager(t *testing.T) *blobmanager.BlobManager {
+	client, err := local.CreateFileSystemClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("CreateFileSystemClient() error = %v", err)
+	}
+	return &blobmanager.BlobManager{BlobStore: client}
+}
+
+func TestBlobManager_UploadDownload(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name        string
+		fileName    string
+		content     []byte
+		contentType string
+	}{
+		{
+			name:        "flat key",
+			fileName:    "674c9d65361369da5c4710d6",
+			content:     []byte("profile picture"),
+			contentType: "image/png",
+		},
+		{
+			name:        "nested key",
+			fileName:    "users/674c9d65361369da5c4710d6/avatar",
+			content:     []byte("nested profile picture"),
+			contentType: "image/jpeg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBlobManager(t)
+			if err := b.Upload(&ctx, getFile(tt.fileName, tt.content, tt.contentType)); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+
+			got, err := b.Download(&ctx, tt.fileName)
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			defer got.Close()
+
+			content, err := io.ReadAll(got)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(content, tt.content) {
+				t.Errorf("Download() content = %q, want %q", content, tt.content)
+			}
+			if got.Type() != tt.contentType {
+				t.Errorf("Download() type = %s, want %s", got.Type(), tt.contentType)
+			}
+			if got.Size() != int64(len(tt.content)) {
+				t.Errorf("Download() size = %d, want %d", got.Size(), len(tt.content))
+			}
+		})
+	}
+}
+
+func TestBlobManager_Overwrite(t *testing.T) {
+	var ctx = context.Background()
+	b := newBlobManager(t)
+	if err := b.Upload(&ctx, getFile("avatar", []byte("first"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if err := b.Upload(&ctx, getFile("avatar", []byte("second version"), "image/jpeg")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	got, err := b.Download(&ctx, "avatar")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	defer got.Close()
+	content, _ := io.ReadAll(got)
+	if string(content) != "second version" || got.Type() != "image/jpeg" || got.Size() != 14 {
+		t.Errorf("Download() got = %q (%s, %d), want overwritten object", content, got.Type(), got.Size())
+	}
+}
+
+func TestBlobManager_Metadata(t *testing.T) {
+	var ctx = context.Background()
+	b := newBlobManager(t)
+	metadata := &blobmanager.Metadata{
+		CacheControl:       "public, max-age=3600",
+		ContentDisposition: "inline; filename=\"avatar.png\"",
+	}
+	metadata.Set("User-Id", "674c9d65361369da5c4710d6")
+	file := blobmanager.NewUploadableFile("avatar", getReadCloserFromByteArray([]byte("content")),
+		7, "image/png").WithMetadata(metadata)
+	if err := b.Upload(&ctx, file); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	got, err := b.Download(&ctx, "avatar")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	defer got.Close()
+	want := metadata.Clone()
+	want.Set(blobmanager.ChecksumMetadataKey, checksum([]byte("content")))
+	if gotMetadata := blobmanager.GetMetadata(got); !reflect.DeepEqual(gotMetadata, want) {
+		t.Errorf("Download() metadata = %+v, want %+v", gotMetadata, want)
+	}
+
+	info, err := b.Stat(&ctx, "avatar")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Metadata.Get("user-id") != "674c9d65361369da5c4710d6" ||
+		info.Metadata.CacheControl != metadata.CacheControl {
+		t.Errorf("Stat() metadata = %+v, want %+v", info.Metadata, metadata)
+	}
+}
+
+func TestBlobManager_Integrity(t *testing.T) {
+	var ctx = context.Background()
+	rootDir := t.TempDir()
+	client, err := local.CreateFileSystemClient(rootDir)
+	if err != nil {
+		t.Fatalf("CreateFileSystemClient() error = %v", err)
+	}
+	b := &blobmanager.BlobManager{BlobStore: client}
+	if err := b.Upload(&ctx, getFile("avatar", []byte("profile picture"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	var integrityError *common.IntegrityError
+	metadata := &blobmanager.Metadata{}
+	metadata.Set(blobmanager.ChecksumMetadataKey, checksum([]byte("something else")))
+	corrupted := blobmanager.NewUploadableFile("avatar", getReadCloserFromByteArray([]byte("corrupted")),
+		9, "image/png").WithMetadata(metadata)
+	if err := b.Upload(&ctx, corrupted); !errors.As(err, &integrityError) {
+		t.Errorf("Upload() with wrong checksum error = %v, want IntegrityError", err)
+	}
+
+	got, err := b.Download(&ctx, "avatar")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	content, err := io.ReadAll(got)
+	got.Close()
+	if err != nil || string(content) != "profile picture" {
+		t.Fatalf("Download() after rejected upload got = %q, %v", content, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(rootDir, "objects", "avatar"), []byte("profile pictur3"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	got, err = b.Download(&ctx, "avatar")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	defer got.Close()
+	if _, err := io.ReadAll(got); !errors.As(err, &integrityError) {
+		t.Errorf("Download() of tampered object error = %v, want IntegrityError", err)
+	}
+}
+
+func TestBlobManager_UncommittedObject(t *testing.T) {
+	var ctx = context.Background()
+	rootDir := t.TempDir()
+	client, err := local.CreateFileSystemClient(rootDir)
+	if err != nil {
+		t.Fatalf("CreateFileSystemClient() error = %v", err)
+	}
+	b := &blobmanager.BlobManager{BlobStore: client}
+	// an upload that crashed before its metadata was written
+	if err := os.WriteFile(filepath.Join(rootDir, "objects", "partial"), []byte("partial"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	var notFound *common.ObjectNotFound
+	if exists, err := b.Exists(&ctx, "partial"); exists || err != nil {
+		t.Errorf("Exists() = %v, %v, want false", exists, err)
+	}
+	if _, err := b.Download(&ctx, "partial"); !errors.As(err, &notFound) {
+		t.Errorf("Download() error = %v, want ObjectNotFound", err)
+	}
+	if page, err := b.List(&ctx, "", ""); err != nil || len(page.Objects) != 0 {
+		t.Errorf("List() = %v, %v, want no objects", page, err)
+	}
+	if err := b.Delete(&ctx, "partial"); !errors.As(err, &notFound) {
+		t.Errorf("Delete() error = %v, want ObjectNotFound", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "objects", "partial")); !os.IsNotExist(err) {
+		t.Errorf("Delete() left the uncommitted object behind, stat error = %v", err)
+	}
+}
+
+func TestBlobManager_DownloadRange(t *testing.T) {
+	var ctx = context.Background()
+	content := []byte("0123456789")
+	tests := []struct {
+		name    string
+		offset  int64
+		length  int64
+		want    string
+		wantErr bool
+	}{
+		{name: "middle", offset: 2, length: 3, want: "234"},
+		{name: "to end", offset: 7, length: -1, want: "789"},
+		{name: "past end is truncated", offset: 8, length: 10, want: "89"},
+		{name: "invalid offset", offset: 11, length: 1, wantErr: true},
+	}
+	b := newBlobManager(t)
+	if err := b.Upload(&ctx, getFile("digits", content, "text/plain")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.DownloadRange(&ctx, "digits", tt.offset, tt.length)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DownloadRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer got.Close()
+			read, _ := io.ReadAll(got)
+			if string(read) != tt.want || got.Size() != int64(len(tt.want)) {
+				t.Errorf("DownloadRange() got = %q (size %d), want %q", read, got.Size(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBlobManager_Delete(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name     string
+		upload   bool
+		fileName string
+		wantErr  bool
+	}{
+		{
+			name:     "existing object",
+			upload:   true,
+			fileName: "users/674c9d65361369da5c4710d6",
+			wantErr:  false,
+		},
+		{
+			name:     "missing object",
+			upload:   false,
+			fileName: "674c9d65361369da5c4710d6",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBlobManager(t)
+			if tt.upload {
+				if err := b.Upload(&ctx, getFile(tt.fileName, []byte("content"), "image/png")); err != nil {
+					t.Fatalf("Upload() error = %v", err)
+				}
+			}
+			err := b.Delete(&ctx, tt.fileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var notFound *common.ObjectNotFound
+			if _, err := b.Download(&ctx, tt.fileName); !errors.As(err, &notFound) {
+				t.Errorf("Download() after Delete() error = %v, want ObjectNotFound", err)
+			}
+		})
+	}
+}
+
+func TestBlobManager_StatExists(t *testing.T) {
+	var ctx = context.Background()
+	b := newBlobManager(t)
+	if err := b.Upload(&ctx, getFile("users/avatar", []byte("content"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	info, err := b.Stat(&ctx, "users/avatar")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size != 7 || info.ContentType != "image/png" || len(info.ETag) == 0 || info.LastModified.IsZero() {
+		t.Errorf("Stat() got = %+v", info)
+	}
+
+	var notFound *common.ObjectNotFound
+	if _, err := b.Stat(&ctx, "users/missing"); !errors.As(err, &notFound) {
+		t.Errorf("Stat() error = %v, want ObjectNotFound", err)
+	}
+	if _, err := b.Stat(&ctx, "users"); !errors.As(err, &notFound) {
+		t.Errorf("Stat() on directory error = %v, want ObjectNotFound", err)
+	}
+
+	tests := []struct {
+		fileName string
+		want     bool
+	}{
+		{fileName: "users/avatar", want: true},
+		{fileName: "users/missing", want: false},
+	}
+	for _, tt := range tests {
+		got, err := b.Exists(&ctx, tt.fileName)
+		if err != nil || got != tt.want {
+			t.Errorf("Exists(%s) = %v, %v, want %v", tt.fileName, got, err, tt.want)
+		}
+	}
+}
+
+func TestBlobManager_List(t *testing.T) {
+	var ctx = context.Background()
+	b := newBlobManager(t)
+	for _, fileName := range []string{"users/b", "users/a", "users/nested/c", "other/d"} {
+		if err := b.Upload(&ctx, getFile(fileName, []byte(fileName), "text/plain")); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+	}
+
+	page, err := b.List(&ctx, "users/", "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var names []string
+	for _, object := range page.Objects {
+		names = append(names, object.Name)
+	}
+	want := []string{"users/a", "users/b", "users/nested/c"}
+	if !reflect.DeepEqual(names, want) || page.NextPageToken != "" {
+		t.Errorf("List() got = %v (token %q), want %v", names, page.NextPageToken, want)
+	}
+
+	page, err = b.List(&ctx, "users/", "users/a")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(page.Objects) != 2 || page.Objects[0].Name != "users/b" {
+		t.Errorf("List() after token got = %v", page.Objects)
+	}
+}
+
+func TestBlobManager_InvalidKey(t *testing.T) {
+	var ctx = context.Background()
+	b := newBlobManager(t)
+	for _, fileName := range []string{"", "../escape", "/etc/passwd"} {
+		if err := b.Upload(&ctx, getFile(fileName, []byte("content"), "text/plain")); err == nil {
+			t.Errorf("Upload(%q) error = nil, want error", fileName)
+		}
+	}
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func getFile(fileId string, content []byte, contentType string) blobmanager.File {
+	return blobmanager.NewUploadableFile(fileId, getReadCloserFromByteArray(content),
+		int64(len(content)), contentType)
+}
+
+// A struct to wrap bytes.Reader and implement io.Closer
+type reader struct {
+	*bytes.Reader
+}
+
+// Implement the Close method to satisfy the io.Closer interface
+func (rc *reader) Close() error {
+	return nil // No resources to release, so return nil
+}
+
+// getReadCloserFromByteArray converts a byte array to multipart.File
+func getReadCloserFromByteArray(data []byte) multipart.File {
+	return &reader{Reader: bytes.NewReader(data)}
+}
@@ -0,0 +1,111 @@
+package local
+
+import (
+	blobmanager "blob-manager"
+	common "blob-manager/common"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func (f *FileSystemClient) Upload(ctx *context.Context, file blobmanager.File) error {
+	defer file.Close()
+	if err := (*ctx).Err(); err != nil {
+		return err
+	}
+	objectPath, err := f.objectPath(file.Name())
+	if err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	metadataPath, err := f.metadataPath(file.Name())
+	if err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+
+	reader := blobmanager.NewChecksumReader(file)
+	stagedPath, size, err := f.stage(reader, func() error {
+		return blobmanager.VerifyUploadChecksum(file, reader.Checksums())
+	})
+	if err != nil {
+		var integrityError *common.IntegrityError
+		if errors.As(err, &integrityError) {
+			return err
+		}
+		return &common.UploadError{Message: err.Error()}
+	}
+	defer os.Remove(stagedPath)
+
+	checksums := reader.Checksums()
+	fileMetadata := blobmanager.WithChecksum(blobmanager.GetMetadata(file), checksums)
+	metadata, err := json.Marshal(&objectMetadata{
+		ContentType:        file.Type(),
+		Size:               size,
+		ETag:               hex.EncodeToString(checksums.MD5),
+		CacheControl:       fileMetadata.CacheControl,
+		ContentDisposition: fileMetadata.ContentDisposition,
+		UserMetadata:       fileMetadata.UserMetadata,
+	})
+	if err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	if _, err := f.writeAtomically(metadataPath, bytes.NewReader(metadata), nil); err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	// the object is renamed into place last, one without metadata is an
+	// upload that didn't finish and isn't visible
+	if err := f.commit(stagedPath, objectPath); err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	return nil
+}
+
+// writeAtomically writes content into a temp file and renames it into place,
+// so readers never observe a partially written file.
+func (f *FileSystemClient) writeAtomically(path string, content io.Reader, verify func() error) (int64, error) {
+	stagedPath, size, err := f.stage(content, verify)
+	if err != nil {
+		return 0, err
+	}
+	return size, f.commit(stagedPath, path)
+}
+
+// stage writes content into a temp file for commit to rename into place. A
+// non-nil verify is called once it's written and can reject the content.
+func (f *FileSystemClient) stage(content io.Reader, verify func() error) (string, int64, error) {
+	tempFile, err := os.CreateTemp(filepath.Join(f.rootDir, tempDir), "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := io.Copy(tempFile, content)
+	if err == nil && verify != nil {
+		err = verify()
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", 0, err
+	}
+	return tempFile.Name(), size, nil
+}
+
+func (f *FileSystemClient) commit(stagedPath string, path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		err = os.Rename(stagedPath, path)
+	}
+	if err != nil {
+		os.Remove(stagedPath)
+	}
+	return err
+}
@@ -1,6 +1,9 @@
 package blobmanager
 
-import "context"
+import (
+	common "blob-manager/common"
+	"context"
+)
 
 type BlobManager struct {
 	BlobStore BlobStore
@@ -15,6 +18,45 @@ func (b *BlobManager) Download(ctx *context.Context, fileName string) (File, err
 	return file, err
 }
 
+func (b *BlobManager) Stat(ctx *context.Context, fileName string) (*ObjectInfo, error) {
+	return b.BlobStore.Stat(ctx, fileName)
+}
+
+func (b *BlobManager) Exists(ctx *context.Context, fileName string) (bool, error) {
+	return b.BlobStore.Exists(ctx, fileName)
+}
+
+func (b *BlobManager) List(ctx *context.Context, prefix string, pageToken string) (*ObjectPage, error) {
+	return b.BlobStore.List(ctx, prefix, pageToken)
+}
+
+func (b *BlobManager) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (File, error) {
+	rangeReader, ok := b.BlobStore.(RangeReader)
+	if !ok {
+		return nil, &common.UnsupportedOperationError{Operation: "DownloadRange"}
+	}
+	return rangeReader.DownloadRange(ctx, fileName, offset, length)
+}
+
 func (b *BlobManager) Delete(ctx *context.Context, fileName string) error {
 	return b.BlobStore.Delete(ctx, fileName)
 }
+
+func (b *BlobManager) SignedUploadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := b.BlobStore.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedUploadURL"}
+	}
+	return signer.SignedUploadURL(ctx, fileName, options)
+}
+
+func (b *BlobManager) SignedDownloadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := b.BlobStore.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedDownloadURL"}
+	}
+	return signer.SignedDownloadURL(ctx, fileName, options)
+}
@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	phaseCopy   = "copy"
+	phaseDelete = "delete"
+)
+
+// Checkpoint is where an interrupted migration resumes, PageToken is the
+// listing page of Phase that comes after the last completed one. Missing and
+// Different are what a verify found on the completed pages, since nothing
+// else records them.
+type Checkpoint struct {
+	Mode      Mode   `json:"mode"`
+	Prefix    string `json:"prefix"`
+	Phase     string `json:"phase"`
+	PageToken string `json:"pageToken"`
+	Missing   int64  `json:"missing,omitempty"`
+	Different int64  `json:"different,omitempty"`
+}
+
+func (m *Migration) loadCheckpoint() (*Checkpoint, error) {
+	checkpoint := &Checkpoint{Mode: m.mode, Prefix: m.options.Prefix, Phase: phaseCopy}
+	if len(m.options.CheckpointFile) == 0 {
+		return checkpoint, nil
+	}
+	content, err := os.ReadFile(m.options.CheckpointFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint, reason: %w", err)
+	}
+	var saved Checkpoint
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %s, reason: %w", m.options.CheckpointFile, err)
+	}
+	if saved.Mode != m.mode || saved.Prefix != m.options.Prefix {
+		return nil, fmt.Errorf("checkpoint: %s belongs to %s of prefix: %q", m.options.CheckpointFile,
+			saved.Mode, saved.Prefix)
+	}
+	return &saved, nil
+}
+
+// saveCheckpoint replaces the checkpoint file atomically, so an interrupted
+// write leaves the previous checkpoint behind.
+func (m *Migration) saveCheckpoint(checkpoint *Checkpoint) error {
+	if len(m.options.CheckpointFile) == 0 {
+		return nil
+	}
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(m.options.CheckpointFile), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint, reason: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.Write(content)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), m.options.CheckpointFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint, reason: %w", err)
+	}
+	return nil
+}
+
+func (m *Migration) removeCheckpoint() error {
+	if len(m.options.CheckpointFile) == 0 {
+		return nil
+	}
+	if err := os.Remove(m.options.CheckpointFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
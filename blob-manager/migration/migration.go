@@ -0,0 +1,254 @@
+package migration
+
+import (
+	blobmanager "blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+type Mode string
+
+const (
+	// ModeCopy copies objects that are missing or different in the destination.
+	ModeCopy Mode = "copy"
+	// ModeSync copies like ModeCopy and then deletes destination objects that
+	// are no longer in the source.
+	ModeSync Mode = "sync"
+	// ModeVerify only compares, it reports missing and different objects.
+	ModeVerify Mode = "verify"
+)
+
+// Options configure a migration. Objects are compared by size, and by the
+// checksum stored with them when CompareChecksums is set and both sides have
+// one. A non-empty CheckpointFile makes the migration resumable, it's
+// removed once the migration completes.
+type Options struct {
+	Prefix           string
+	Concurrency      int
+	CompareChecksums bool
+	CheckpointFile   string
+}
+
+// Report counts what a migration did. Missing and Different are only set
+// by ModeVerify, which leaves them to be copied, a resumed verify includes
+// those of the pages checked before it was interrupted.
+type Report struct {
+	Copied    int64
+	Skipped   int64
+	Deleted   int64
+	Missing   int64
+	Different int64
+	Failed    int64
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("copied: %d, skipped: %d, deleted: %d, missing: %d, different: %d, failed: %d",
+		r.Copied, r.Skipped, r.Deleted, r.Missing, r.Different, r.Failed)
+}
+
+// Migration moves the objects under a prefix from one BlobStore to another,
+// page by page with a pool of workers per page.
+type Migration struct {
+	mode        Mode
+	source      blobmanager.BlobStore
+	destination blobmanager.BlobStore
+	options     *Options
+	report      *Report
+}
+
+func CreateMigration(mode Mode, source blobmanager.BlobStore, destination blobmanager.BlobStore,
+	options *Options) (*Migration, error) {
+	if mode != ModeCopy && mode != ModeSync && mode != ModeVerify {
+		return nil, fmt.Errorf("unknown migration mode: %q", mode)
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	return &Migration{
+		mode:        mode,
+		source:      source,
+		destination: destination,
+		options:     options,
+		report:      &Report{},
+	}, nil
+}
+
+// Run migrates every object and returns the report, with an error when an
+// object failed or ctx was cancelled. The checkpoint only moves past pages
+// without failures, so a rerun retries them.
+func (m *Migration) Run(ctx *context.Context) (*Report, error) {
+	checkpoint, err := m.loadCheckpoint()
+	if err != nil {
+		return m.report, err
+	}
+	m.report.Missing, m.report.Different = checkpoint.Missing, checkpoint.Different
+	if checkpoint.Phase == phaseCopy {
+		err = m.forEachPage(ctx, m.source, checkpoint, m.migrate)
+		// only delete once everything was copied
+		if err == nil && m.mode == ModeSync && m.report.Failed == 0 {
+			checkpoint.Phase, checkpoint.PageToken = phaseDelete, ""
+			err = m.saveCheckpoint(checkpoint)
+		}
+	}
+	if err == nil && checkpoint.Phase == phaseDelete {
+		err = m.forEachPage(ctx, m.destination, checkpoint, m.deleteRemoved)
+	}
+	if err != nil {
+		return m.report, err
+	}
+	if m.report.Failed > 0 {
+		return m.report, fmt.Errorf("%d objects failed", m.report.Failed)
+	}
+	return m.report, m.removeCheckpoint()
+}
+
+func (m *Migration) forEachPage(ctx *context.Context, store blobmanager.BlobStore, checkpoint *Checkpoint,
+	process func(ctx *context.Context, info *blobmanager.ObjectInfo) error) error {
+	pageToken := checkpoint.PageToken
+	for {
+		page, err := store.List(ctx, m.options.Prefix, pageToken)
+		if err != nil {
+			return fmt.Errorf("failed to list prefix: %q, reason: %w", m.options.Prefix, err)
+		}
+		m.processPage(ctx, page.Objects, process)
+		// a cancelled page is incomplete, the checkpoint stays before it
+		if err := (*ctx).Err(); err != nil {
+			return err
+		}
+		if len(page.NextPageToken) == 0 {
+			return nil
+		}
+		pageToken = page.NextPageToken
+		if atomic.LoadInt64(&m.report.Failed) == 0 {
+			checkpoint.PageToken = pageToken
+			checkpoint.Missing, checkpoint.Different = m.report.Missing, m.report.Different
+			if err := m.saveCheckpoint(checkpoint); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (m *Migration) processPage(ctx *context.Context, objects []*blobmanager.ObjectInfo,
+	process func(ctx *context.Context, info *blobmanager.ObjectInfo) error) {
+	work := make(chan *blobmanager.ObjectInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < m.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for info := range work {
+				if err := process(ctx, info); err != nil {
+					atomic.AddInt64(&m.report.Failed, 1)
+					log.Printf("failed to %s object: %s, reason: %v", m.mode, info.Name, err)
+				}
+			}
+		}()
+	}
+	for _, info := range objects {
+		if (*ctx).Err() != nil {
+			break
+		}
+		work <- info
+	}
+	close(work)
+	wg.Wait()
+}
+
+func (m *Migration) migrate(ctx *context.Context, info *blobmanager.ObjectInfo) error {
+	state, err := m.inDestination(ctx, info)
+	if err != nil {
+		return err
+	}
+	switch {
+	case state == present:
+		atomic.AddInt64(&m.report.Skipped, 1)
+		return nil
+	case m.mode == ModeVerify && state == absent:
+		atomic.AddInt64(&m.report.Missing, 1)
+		log.Printf("object: %s is missing in the destination", info.Name)
+		return nil
+	case m.mode == ModeVerify:
+		atomic.AddInt64(&m.report.Different, 1)
+		log.Printf("object: %s is different in the destination", info.Name)
+		return nil
+	}
+
+	file, err := m.source.Download(ctx, info.Name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := m.destination.Upload(ctx, file); err != nil {
+		return err
+	}
+	atomic.AddInt64(&m.report.Copied, 1)
+	return nil
+}
+
+type presence int
+
+const (
+	absent presence = iota
+	different
+	present
+)
+
+// inDestination compares the source object with the destination's copy.
+func (m *Migration) inDestination(ctx *context.Context, info *blobmanager.ObjectInfo) (presence, error) {
+	stored, err := m.destination.Stat(ctx, info.Name)
+	var objectNotFound *common.ObjectNotFound
+	if errors.As(err, &objectNotFound) {
+		return absent, nil
+	}
+	if err != nil {
+		return absent, err
+	}
+	if stored.Size != info.Size {
+		return different, nil
+	}
+	if !m.options.CompareChecksums {
+		return present, nil
+	}
+	sourceChecksum, err := checksum(ctx, m.source, info)
+	if err != nil {
+		return absent, err
+	}
+	destinationChecksum := stored.Metadata.Get(blobmanager.ChecksumMetadataKey)
+	if len(sourceChecksum) > 0 && len(destinationChecksum) > 0 && sourceChecksum != destinationChecksum {
+		return different, nil
+	}
+	return present, nil
+}
+
+// checksum returns the stored checksum of an object, listings don't carry
+// metadata on every provider.
+func checksum(ctx *context.Context, store blobmanager.BlobStore, info *blobmanager.ObjectInfo) (string, error) {
+	if value := info.Metadata.Get(blobmanager.ChecksumMetadataKey); len(value) > 0 {
+		return value, nil
+	}
+	stat, err := store.Stat(ctx, info.Name)
+	if err != nil {
+		return "", err
+	}
+	return stat.Metadata.Get(blobmanager.ChecksumMetadataKey), nil
+}
+
+func (m *Migration) deleteRemoved(ctx *context.Context, info *blobmanager.ObjectInfo) error {
+	exists, err := m.source.Exists(ctx, info.Name)
+	if err != nil || exists {
+		return err
+	}
+	err = m.destination.Delete(ctx, info.Name)
+	var objectNotFound *common.ObjectNotFound
+	if err != nil && !errors.As(err, &objectNotFound) {
+		return err
+	}
+	atomic.AddInt64(&m.report.Deleted, 1)
+	return nil
+}
@@ -0,0 +1,243 @@
+package test
+
+import (
+	"blob-manager"
+	"blob-manager/local"
+	"blob-manager/migration"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pagedStore lists two objects per page, so that paging and checkpoints are
+// exercised without thousands of objects.
+type pagedStore struct {
+	blobmanager.BlobStore
+	failUploads map[string]bool
+	failStats   map[string]bool
+}
+
+func (p *pagedStore) List(ctx *context.Context, prefix string, pageToken string) (*blobmanager.ObjectPage, error) {
+	all, err := p.BlobStore.List(ctx, prefix, "")
+	if err != nil {
+		return nil, err
+	}
+	page := &blobmanager.ObjectPage{}
+	for _, info := range all.Objects {
+		if info.Name <= pageToken {
+			continue
+		}
+		if len(page.Objects) == 2 {
+			page.NextPageToken = page.Objects[1].Name
+			break
+		}
+		page.Objects = append(page.Objects, info)
+	}
+	return page, nil
+}
+
+func (p *pagedStore) Upload(ctx *context.Context, file blobmanager.File) error {
+	if p.failUploads[file.Name()] {
+		file.Close()
+		return errors.New("store unavailable")
+	}
+	return p.BlobStore.Upload(ctx, file)
+}
+
+func (p *pagedStore) Stat(ctx *context.Context, fileName string) (*blobmanager.ObjectInfo, error) {
+	if p.failStats[fileName] {
+		return nil, errors.New("store unavailable")
+	}
+	return p.BlobStore.Stat(ctx, fileName)
+}
+
+func TestMigration_Run(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name        string
+		mode        migration.Mode
+		checksums   bool
+		wantReport  migration.Report
+		wantObjects map[string]string
+	}{
+		{
+			name:       "copy comparing sizes",
+			mode:       migration.ModeCopy,
+			wantReport: migration.Report{Copied: 3, Skipped: 1},
+			wantObjects: map[string]string{"users/a": "alpha", "users/b": "BRAVO", "users/c": "charlie",
+				"users/d": "delta", "users/old": "removed"},
+		},
+		{
+			name:       "copy comparing checksums",
+			mode:       migration.ModeCopy,
+			checksums:  true,
+			wantReport: migration.Report{Copied: 4},
+			wantObjects: map[string]string{"users/a": "alpha", "users/b": "bravo", "users/c": "charlie",
+				"users/d": "delta", "users/old": "removed"},
+		},
+		{
+			name:        "sync",
+			mode:        migration.ModeSync,
+			checksums:   true,
+			wantReport:  migration.Report{Copied: 4, Deleted: 1},
+			wantObjects: map[string]string{"users/a": "alpha", "users/b": "bravo", "users/c": "charlie", "users/d": "delta"},
+		},
+		{
+			name:        "verify",
+			mode:        migration.ModeVerify,
+			checksums:   true,
+			wantReport:  migration.Report{Missing: 3, Different: 1},
+			wantObjects: map[string]string{"users/b": "BRAVO", "users/old": "removed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newStore(t, map[string]string{
+				"users/a": "alpha", "users/b": "bravo", "users/c": "charlie", "users/d": "delta", "other/x": "x"})
+			destination := newStore(t, map[string]string{"users/b": "BRAVO", "users/old": "removed"})
+			m, err := migration.CreateMigration(tt.mode, source, destination, &migration.Options{
+				Prefix:           "users/",
+				Concurrency:      3,
+				CompareChecksums: tt.checksums,
+			})
+			if err != nil {
+				t.Fatalf("CreateMigration() error = %v", err)
+			}
+			report, err := m.Run(&ctx)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if *report != tt.wantReport {
+				t.Errorf("Run() report = %s, want %s", report, &tt.wantReport)
+			}
+			if got := contents(t, destination); !equal(got, tt.wantObjects) {
+				t.Errorf("destination = %v, want %v", got, tt.wantObjects)
+			}
+		})
+	}
+}
+
+func TestMigration_Resume(t *testing.T) {
+	var ctx = context.Background()
+	objects := map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"}
+	source := newStore(t, objects)
+	destination := newStore(t, nil)
+	destination.failUploads = map[string]bool{"d": true}
+	options := &migration.Options{Concurrency: 2, CheckpointFile: filepath.Join(t.TempDir(), "checkpoint.json")}
+
+	m, _ := migration.CreateMigration(migration.ModeCopy, source, destination, options)
+	report, err := m.Run(&ctx)
+	if err == nil || report.Failed != 1 || report.Copied != 4 {
+		t.Fatalf("Run() = %s, %v, want d to fail", report, err)
+	}
+	if _, err := os.Stat(options.CheckpointFile); err != nil {
+		t.Fatalf("checkpoint after failed run error = %v", err)
+	}
+
+	// the first page was completed, the rerun starts at the page holding d
+	destination.failUploads = nil
+	m, _ = migration.CreateMigration(migration.ModeCopy, source, destination, options)
+	report, err = m.Run(&ctx)
+	if err != nil || report.Copied != 1 || report.Skipped != 2 {
+		t.Fatalf("Run() resumed = %s, %v, want d copied and c, e skipped", report, err)
+	}
+	if got := contents(t, destination); !equal(got, objects) {
+		t.Errorf("destination = %v, want %v", got, objects)
+	}
+	if _, err := os.Stat(options.CheckpointFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint after completed run error = %v, want it removed", err)
+	}
+
+	m, _ = migration.CreateMigration(migration.ModeSync, source, destination, options)
+	if err := os.WriteFile(options.CheckpointFile, []byte(`{"mode":"copy","phase":"copy"}`), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := m.Run(&ctx); err == nil {
+		t.Errorf("Run() with checkpoint of another migration error = nil")
+	}
+}
+
+func TestMigration_ResumeVerify(t *testing.T) {
+	var ctx = context.Background()
+	source := newStore(t, map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"})
+	destination := newStore(t, nil)
+	destination.failStats = map[string]bool{"d": true}
+	options := &migration.Options{Concurrency: 2, CheckpointFile: filepath.Join(t.TempDir(), "checkpoint.json")}
+
+	m, _ := migration.CreateMigration(migration.ModeVerify, source, destination, options)
+	if report, err := m.Run(&ctx); err == nil || report.Failed != 1 {
+		t.Fatalf("Run() = %s, %v, want d to fail", report, err)
+	}
+
+	// the rerun starts at the page holding d, the first page stays counted
+	destination.failStats = nil
+	m, _ = migration.CreateMigration(migration.ModeVerify, source, destination, options)
+	report, err := m.Run(&ctx)
+	if err != nil || *report != (migration.Report{Missing: 5}) {
+		t.Errorf("Run() resumed = %s, %v, want all 5 objects missing", report, err)
+	}
+}
+
+func newStore(t *testing.T, objects map[string]string) *pagedStore {
+	var ctx = context.Background()
+	client, err := local.CreateFileSystemClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("CreateFileSystemClient() error = %v", err)
+	}
+	for name, content := range objects {
+		file := blobmanager.NewUploadableFile(name, &reader{bytes.NewReader([]byte(content))},
+			int64(len(content)), "text/plain")
+		if err := client.Upload(&ctx, file); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+	}
+	return &pagedStore{BlobStore: client}
+}
+
+func contents(t *testing.T, store blobmanager.BlobStore) map[string]string {
+	var ctx = context.Background()
+	got := map[string]string{}
+	for pageToken := ""; ; {
+		page, err := store.List(&ctx, "", pageToken)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		for _, info := range page.Objects {
+			file, err := store.Download(&ctx, info.Name)
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			content, _ := io.ReadAll(file)
+			file.Close()
+			got[info.Name] = string(content)
+		}
+		if len(page.NextPageToken) == 0 {
+			return got
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func equal(got map[string]string, want map[string]string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for name, content := range want {
+		if got[name] != content {
+			return false
+		}
+	}
+	return true
+}
+
+type reader struct {
+	*bytes.Reader
+}
+
+func (r *reader) Close() error {
+	return nil
+}
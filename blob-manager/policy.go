@@ -0,0 +1,191 @@
+package blobmanager
+
+import (
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"strings"
+)
+
+// UploadPolicy limits what PolicyBlobStore accepts. A MaxObjectSize or Quota
+// of 0 is unlimited and an empty AllowedContentTypes allows any. Owner maps
+// an object to the owner it's accounted to, objects it maps to "" are not
+// accounted. Accounting needs a MaxObjectSize.
+type UploadPolicy struct {
+	MaxObjectSize       int64
+	AllowedContentTypes []string
+	Quota               int64
+	Owner               func(fileName string) string
+}
+
+// PolicyBlobStore enforces an UploadPolicy on uploads and tracks the bytes
+// stored per owner in a UsageStore. Uploads of up to MaxObjectSize are
+// buffered in memory so their size is known, and accounted, before anything
+// is stored, without a MaxObjectSize they are streamed. Signed upload URLs
+// bypass the policy, their objects should not be accounted to an owner.
+type PolicyBlobStore struct {
+	store  BlobStore
+	policy *UploadPolicy
+	usage  UsageStore
+}
+
+func CreatePolicyBlobStore(store BlobStore, policy *UploadPolicy, usage UsageStore) (*PolicyBlobStore, error) {
+	if policy.Quota > 0 && (usage == nil || policy.Owner == nil) {
+		return nil, errors.New("a storage quota needs a usage store and an owner")
+	}
+	if usage != nil && policy.Owner != nil && policy.MaxObjectSize <= 0 {
+		return nil, errors.New("accounting storage usage needs a maximum object size")
+	}
+	return &PolicyBlobStore{store: store, policy: policy, usage: usage}, nil
+}
+
+func (p *PolicyBlobStore) Upload(ctx *context.Context, file File) error {
+	defer file.Close()
+	if !p.allowed(file.Type()) {
+		return &common.ContentTypeNotAllowedError{ContentType: file.Type()}
+	}
+	if p.policy.MaxObjectSize <= 0 {
+		// nothing to check or account, the file is handed on as is
+		return p.store.Upload(ctx, file)
+	}
+	content, err := p.read(file)
+	if err != nil {
+		return err
+	}
+	upload := newBufferedFile(file.Name(), file.Type(), content, GetMetadata(file))
+
+	owner := p.owner(file.Name())
+	if len(owner) == 0 {
+		return p.store.Upload(ctx, upload)
+	}
+	previous, err := p.usage.Set(ctx, owner, file.Name(), int64(len(content)), p.policy.Quota)
+	if err != nil {
+		return err
+	}
+	if err := p.store.Upload(ctx, upload); err != nil {
+		p.account(ctx, owner, file.Name(), previous)
+		return err
+	}
+	return nil
+}
+
+func (p *PolicyBlobStore) Delete(ctx *context.Context, fileName string) error {
+	owner := p.owner(fileName)
+	if len(owner) == 0 {
+		return p.store.Delete(ctx, fileName)
+	}
+	err := p.store.Delete(ctx, fileName)
+	var objectNotFound *common.ObjectNotFound
+	if err != nil && !errors.As(err, &objectNotFound) {
+		return err
+	}
+	// a missing object isn't stored either, whatever the usage still counts
+	p.account(ctx, owner, fileName, 0)
+	return err
+}
+
+// Usage returns the bytes stored by owner.
+func (p *PolicyBlobStore) Usage(ctx *context.Context, owner string) (int64, error) {
+	if p.usage == nil {
+		return 0, nil
+	}
+	return p.usage.Get(ctx, owner)
+}
+
+func (p *PolicyBlobStore) allowed(contentType string) bool {
+	if len(p.policy.AllowedContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range p.policy.AllowedContentTypes {
+		if strings.EqualFold(mediaType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// read reads one byte past MaxObjectSize, so a file that lies about its
+// size is caught as well.
+func (p *PolicyBlobStore) read(file File) ([]byte, error) {
+	maxSize := p.policy.MaxObjectSize
+	tooLarge := &common.ObjectTooLargeError{
+		Message: fmt.Sprintf("object %s is larger than %d bytes", file.Name(), maxSize)}
+	if file.Size() > maxSize {
+		return nil, tooLarge
+	}
+	content, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return nil, &common.UploadError{Message: err.Error()}
+	}
+	if int64(len(content)) > maxSize {
+		return nil, tooLarge
+	}
+	return content, nil
+}
+
+func (p *PolicyBlobStore) owner(fileName string) string {
+	if p.usage == nil || p.policy.Owner == nil {
+		return ""
+	}
+	return p.policy.Owner(fileName)
+}
+
+// account records the size of an object after a delete or a failed upload,
+// failures are only logged since the object operation already happened.
+func (p *PolicyBlobStore) account(ctx *context.Context, owner string, fileName string, size int64) {
+	if _, err := p.usage.Set(ctx, owner, fileName, size, 0); err != nil {
+		log.Printf("failed to record %d bytes of %s in the storage usage of %s, reason: %v",
+			size, fileName, owner, err)
+	}
+}
+
+func (p *PolicyBlobStore) Download(ctx *context.Context, fileName string) (File, error) {
+	return p.store.Download(ctx, fileName)
+}
+
+func (p *PolicyBlobStore) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (File, error) {
+	rangeReader, ok := p.store.(RangeReader)
+	if !ok {
+		return nil, &common.UnsupportedOperationError{Operation: "DownloadRange"}
+	}
+	return rangeReader.DownloadRange(ctx, fileName, offset, length)
+}
+
+func (p *PolicyBlobStore) Stat(ctx *context.Context, fileName string) (*ObjectInfo, error) {
+	return p.store.Stat(ctx, fileName)
+}
+
+func (p *PolicyBlobStore) Exists(ctx *context.Context, fileName string) (bool, error) {
+	return p.store.Exists(ctx, fileName)
+}
+
+func (p *PolicyBlobStore) List(ctx *context.Context, prefix string, pageToken string) (*ObjectPage, error) {
+	return p.store.List(ctx, prefix, pageToken)
+}
+
+func (p *PolicyBlobStore) SignedUploadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := p.store.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedUploadURL"}
+	}
+	return signer.SignedUploadURL(ctx, fileName, options)
+}
+
+func (p *PolicyBlobStore) SignedDownloadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := p.store.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedDownloadURL"}
+	}
+	return signer.SignedDownloadURL(ctx, fileName, options)
+}
@@ -0,0 +1,98 @@
+package blobmanager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type RepairOperation string
+
+const (
+	RepairUpload RepairOperation = "upload"
+	RepairDelete RepairOperation = "delete"
+)
+
+const (
+	// DefaultRepairAttempts is how often a repair is tried before it's
+	// dead-lettered.
+	DefaultRepairAttempts = 10
+	// DefaultRepairQueueSize is how many tasks a MemoryRepairQueue holds, and
+	// how many dead letters it keeps.
+	DefaultRepairQueueSize = 10000
+)
+
+// RepairTask records a write that didn't reach the replica at StoreIndex.
+// A task that failed MaxAttempts times is dead-lettered.
+type RepairTask struct {
+	FileName    string
+	Operation   RepairOperation
+	StoreIndex  int
+	Reason      string
+	QueuedAt    time.Time
+	Attempts    int
+	MaxAttempts int
+}
+
+// RepairQueue holds failed replica writes until they are repaired. Drain
+// hands every queued task to the caller, tasks that still fail are enqueued
+// again until they run out of attempts and are dead-lettered.
+type RepairQueue interface {
+	Enqueue(task *RepairTask) error
+	Drain() ([]*RepairTask, error)
+	DeadLetter(task *RepairTask) error
+}
+
+// MemoryRepairQueue keeps repair tasks in process, they are lost on restart.
+// Enqueue fails once it holds DefaultRepairQueueSize tasks, and only the
+// latest DefaultRepairQueueSize dead letters are kept.
+type MemoryRepairQueue struct {
+	mutex       sync.Mutex
+	tasks       []*RepairTask
+	deadLetters []*RepairTask
+}
+
+func NewMemoryRepairQueue() *MemoryRepairQueue {
+	return &MemoryRepairQueue{}
+}
+
+func (q *MemoryRepairQueue) Enqueue(task *RepairTask) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.tasks) >= DefaultRepairQueueSize {
+		return fmt.Errorf("repair queue is full with %d tasks", len(q.tasks))
+	}
+	q.tasks = append(q.tasks, task)
+	return nil
+}
+
+func (q *MemoryRepairQueue) DeadLetter(task *RepairTask) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.deadLetters) >= DefaultRepairQueueSize {
+		q.deadLetters = q.deadLetters[1:]
+	}
+	q.deadLetters = append(q.deadLetters, task)
+	return nil
+}
+
+// DeadLetters returns the tasks that ran out of attempts.
+func (q *MemoryRepairQueue) DeadLetters() []*RepairTask {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]*RepairTask(nil), q.deadLetters...)
+}
+
+func (q *MemoryRepairQueue) Drain() ([]*RepairTask, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	tasks := q.tasks
+	q.tasks = nil
+	return tasks, nil
+}
+
+func (q *MemoryRepairQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.tasks)
+}
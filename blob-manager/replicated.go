@@ -0,0 +1,340 @@
+package blobmanager
+
+import (
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ConsistencyMode int
+
+const (
+	// ConsistencyAll fails a write unless every replica accepted it.
+	ConsistencyAll ConsistencyMode = iota
+	// ConsistencyQuorum fails a write unless a majority of replicas accepted it.
+	ConsistencyQuorum
+)
+
+// ReplicatedBlobStore writes every object to several stores and reads from
+// the first one that can serve it, stores are given in priority order.
+// Replicas that miss a successful write are queued on the RepairQueue,
+// Repair copies the object over from a healthy replica. Uploads are buffered
+// in memory so the content can be sent to each replica.
+type ReplicatedBlobStore struct {
+	stores      []BlobStore
+	consistency ConsistencyMode
+	repairQueue RepairQueue
+}
+
+func CreateReplicatedBlobStore(consistency ConsistencyMode, repairQueue RepairQueue,
+	stores ...BlobStore) (*ReplicatedBlobStore, error) {
+	if len(stores) == 0 {
+		return nil, errors.New("replicated blob store needs at least one store")
+	}
+	if repairQueue == nil {
+		repairQueue = NewMemoryRepairQueue()
+	}
+	return &ReplicatedBlobStore{
+		stores:      stores,
+		consistency: consistency,
+		repairQueue: repairQueue,
+	}, nil
+}
+
+func (r *ReplicatedBlobStore) required() int {
+	if r.consistency == ConsistencyQuorum {
+		return len(r.stores)/2 + 1
+	}
+	return len(r.stores)
+}
+
+func (r *ReplicatedBlobStore) Upload(ctx *context.Context, file File) error {
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	metadata := GetMetadata(file)
+	errs := r.fanOut(func(store BlobStore) error {
+		return store.Upload(ctx, newBufferedFile(file.Name(), file.Type(), content, metadata))
+	})
+	return r.settle(file.Name(), RepairUpload, errs)
+}
+
+// Delete treats a replica that doesn't have the object as deleted, it only
+// returns ObjectNotFound when no replica had it.
+func (r *ReplicatedBlobStore) Delete(ctx *context.Context, fileName string) error {
+	errs := r.fanOut(func(store BlobStore) error {
+		return store.Delete(ctx, fileName)
+	})
+	notFound := 0
+	for index, err := range errs {
+		var objectNotFound *common.ObjectNotFound
+		if errors.As(err, &objectNotFound) {
+			errs[index] = nil
+			notFound++
+		}
+	}
+	if notFound == len(r.stores) {
+		return &common.ObjectNotFound{ObjectId: fileName}
+	}
+	return r.settle(fileName, RepairDelete, errs)
+}
+
+func (r *ReplicatedBlobStore) fanOut(write func(store BlobStore) error) []error {
+	errs := make([]error, len(r.stores))
+	var wg sync.WaitGroup
+	for index, store := range r.stores {
+		wg.Add(1)
+		go func(index int, store BlobStore) {
+			defer wg.Done()
+			errs[index] = write(store)
+		}(index, store)
+	}
+	wg.Wait()
+	return errs
+}
+
+// settle fails when fewer replicas than required accepted the write, and
+// otherwise queues the replicas that missed it for repair. A failed write
+// isn't repaired, the caller was told it failed and retries it or not, so
+// it stays on the replicas that accepted it until then.
+func (r *ReplicatedBlobStore) settle(fileName string, operation RepairOperation, errs []error) error {
+	var failures []string
+	for index, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("store %d: %s", index, err.Error()))
+		}
+	}
+	succeeded := len(errs) - len(failures)
+	if succeeded >= r.required() {
+		for index, err := range errs {
+			if err == nil {
+				continue
+			}
+			log.Printf("failed to %s object: %s on store %d, queued for repair, reason: %v",
+				operation, fileName, index, err)
+			r.enqueue(&RepairTask{
+				FileName:    fileName,
+				Operation:   operation,
+				StoreIndex:  index,
+				Reason:      err.Error(),
+				QueuedAt:    time.Now(),
+				MaxAttempts: DefaultRepairAttempts,
+			})
+		}
+	}
+	if succeeded < r.required() {
+		return &common.ReplicationError{
+			Message: fmt.Sprintf("%s of object: %s succeeded on %d of %d stores, %d required, failures: %s",
+				operation, fileName, succeeded, len(errs), r.required(), strings.Join(failures, "; "))}
+	}
+	return nil
+}
+
+func (r *ReplicatedBlobStore) enqueue(task *RepairTask) {
+	if err := r.repairQueue.Enqueue(task); err != nil {
+		log.Printf("failed to queue repair of object: %s on store %d, reason: %v",
+			task.FileName, task.StoreIndex, err)
+	}
+}
+
+func (r *ReplicatedBlobStore) deadLetter(task *RepairTask) {
+	log.Printf("giving up repair of object: %s on store %d after %d attempts",
+		task.FileName, task.StoreIndex, task.Attempts)
+	if err := r.repairQueue.DeadLetter(task); err != nil {
+		log.Printf("failed to dead-letter repair of object: %s on store %d, reason: %v",
+			task.FileName, task.StoreIndex, err)
+	}
+}
+
+func (r *ReplicatedBlobStore) Download(ctx *context.Context, fileName string) (File, error) {
+	return readFirst(r.stores, fileName, func(store BlobStore) (File, error) {
+		return store.Download(ctx, fileName)
+	})
+}
+
+func (r *ReplicatedBlobStore) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (File, error) {
+	return readFirst(r.stores, fileName, func(store BlobStore) (File, error) {
+		rangeReader, ok := store.(RangeReader)
+		if !ok {
+			return nil, &common.UnsupportedOperationError{Operation: "DownloadRange"}
+		}
+		return rangeReader.DownloadRange(ctx, fileName, offset, length)
+	})
+}
+
+func (r *ReplicatedBlobStore) Stat(ctx *context.Context, fileName string) (*ObjectInfo, error) {
+	return readFirst(r.stores, fileName, func(store BlobStore) (*ObjectInfo, error) {
+		return store.Stat(ctx, fileName)
+	})
+}
+
+// Exists reports true when any replica has the object, a replica that
+// hasn't been repaired yet doesn't hide it.
+func (r *ReplicatedBlobStore) Exists(ctx *context.Context, fileName string) (bool, error) {
+	var lastErr error
+	answered := false
+	for _, store := range r.stores {
+		exists, err := store.Exists(ctx, fileName)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if exists {
+			return true, nil
+		}
+		answered = true
+	}
+	if answered {
+		return false, nil
+	}
+	return false, lastErr
+}
+
+// List lists the first store that answers, replicas that are behind may
+// miss objects that are still queued for repair.
+func (r *ReplicatedBlobStore) List(ctx *context.Context, prefix string, pageToken string) (*ObjectPage, error) {
+	var lastErr error
+	for index, store := range r.stores {
+		page, err := store.List(ctx, prefix, pageToken)
+		if err == nil {
+			return page, nil
+		}
+		log.Printf("failed to list prefix: %s on store %d, reason: %v", prefix, index, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// readFirst returns the result of the first store that succeeds, falling back
+// on errors and on ObjectNotFound. It returns ObjectNotFound only when every
+// store reported it, otherwise the last other error.
+func readFirst[T any](stores []BlobStore, fileName string, read func(store BlobStore) (T, error)) (T, error) {
+	var zero T
+	var lastErr error
+	for index, store := range stores {
+		result, err := read(store)
+		if err == nil {
+			return result, nil
+		}
+		var objectNotFound *common.ObjectNotFound
+		if !errors.As(err, &objectNotFound) {
+			log.Printf("failed to read object: %s from store %d, reason: %v", fileName, index, err)
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return zero, lastErr
+	}
+	return zero, &common.ObjectNotFound{ObjectId: fileName}
+}
+
+// Repair drains the repair queue and replays each task against its replica,
+// uploads are copied from the first other replica that has the object. Tasks
+// that fail again are put back on the queue, or dead-lettered once they ran
+// out of attempts. It returns the number of replicas repaired.
+func (r *ReplicatedBlobStore) Repair(ctx *context.Context) (int, error) {
+	tasks, err := r.repairQueue.Drain()
+	if err != nil {
+		return 0, err
+	}
+	repaired := 0
+	for _, task := range tasks {
+		if err := r.repair(ctx, task); err != nil {
+			log.Printf("failed to repair object: %s on store %d, reason: %v", task.FileName, task.StoreIndex, err)
+			task.Attempts++
+			task.Reason = err.Error()
+			if task.MaxAttempts > 0 && task.Attempts >= task.MaxAttempts {
+				r.deadLetter(task)
+				continue
+			}
+			r.enqueue(task)
+			continue
+		}
+		repaired++
+	}
+	return repaired, nil
+}
+
+// RunRepairs calls Repair every interval until ctx is done.
+func (r *ReplicatedBlobStore) RunRepairs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if repaired, err := r.Repair(&ctx); err != nil {
+				log.Printf("failed to repair replicas, reason: %v", err)
+			} else if repaired > 0 {
+				log.Printf("repaired %d replicas", repaired)
+			}
+		}
+	}
+}
+
+// existsOnAny reports whether any of stores has the object, it fails when a
+// store that could have it can't be asked.
+func existsOnAny(ctx *context.Context, stores []BlobStore, fileName string) (bool, error) {
+	for _, store := range stores {
+		exists, err := store.Exists(ctx, fileName)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *ReplicatedBlobStore) repair(ctx *context.Context, task *RepairTask) error {
+	if task.StoreIndex < 0 || task.StoreIndex >= len(r.stores) {
+		return fmt.Errorf("invalid store index: %d", task.StoreIndex)
+	}
+	target := r.stores[task.StoreIndex]
+	var objectNotFound *common.ObjectNotFound
+	var sources []BlobStore
+	for index, store := range r.stores {
+		if index != task.StoreIndex {
+			sources = append(sources, store)
+		}
+	}
+	if task.Operation == RepairDelete {
+		uploaded, err := existsOnAny(ctx, sources, task.FileName)
+		if err != nil {
+			return err
+		}
+		if uploaded {
+			// uploaded again since the delete, the target has the newer
+			// object or is queued to get it
+			return nil
+		}
+		if err := target.Delete(ctx, task.FileName); err != nil && !errors.As(err, &objectNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	file, err := readFirst(sources, task.FileName, func(store BlobStore) (File, error) {
+		return store.Download(ctx, task.FileName)
+	})
+	if errors.As(err, &objectNotFound) {
+		// deleted everywhere else since the upload, nothing left to copy
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return target.Upload(ctx, file)
+}
@@ -0,0 +1,283 @@
+package blobmanager
+
+import (
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"google.golang.org/api/googleapi"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how RetryingBlobStore retries a failed operation.
+// AttemptTimeout bounds every single attempt, 0 leaves attempts bounded only
+// by the caller's context. Uploads of up to MaxBufferedSize bytes, 0 uses
+// DefaultMaxBufferedSize, are buffered to be retried, larger ones are
+// streamed in a single attempt. Retryable defaults to IsRetryable, OnRetry is
+// called before every retry, e.g. to log it.
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	AttemptTimeout  time.Duration
+	MaxBufferedSize int64
+	Retryable       func(err error) bool
+	OnRetry         func(attempt *RetryAttempt)
+}
+
+// RetryAttempt describes a failed attempt that is about to be retried after
+// Backoff.
+type RetryAttempt struct {
+	Operation string
+	FileName  string
+	Attempt   int
+	Err       error
+	Backoff   time.Duration
+}
+
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+// transientCodes are the error codes of S3 and compatible services that
+// report throttling or a request that timed out.
+var transientCodes = map[string]bool{
+	"RequestError":              true,
+	"RequestTimeout":            true,
+	"ResponseTimeout":           true,
+	"SlowDown":                  true,
+	"Throttling":                true,
+	"ThrottlingException":       true,
+	"RequestLimitExceeded":      true,
+	"TooManyRequestsException":  true,
+	"RequestThrottledException": true,
+}
+
+// IsRetryable reports whether err may go away on its own: server errors,
+// throttling, timeouts and network failures. Anything else, including errors
+// it doesn't recognise, is final.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var codedErr interface{ Code() string }
+	if errors.As(err, &codedErr) && transientCodes[codedErr.Code()] {
+		return true
+	}
+	var statusErr interface{ StatusCode() int }
+	if errors.As(err, &statusErr) {
+		return isTransientStatus(statusErr.StatusCode())
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return isTransientStatus(googleErr.Code)
+	}
+	return false
+}
+
+func isTransientStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests ||
+		status == http.StatusRequestTimeout
+}
+
+// RetryingBlobStore retries failed operations of a store with exponential
+// backoff and jitter. Uploads are buffered in memory, up to the policy's
+// MaxBufferedSize, so the content can be sent again.
+type RetryingBlobStore struct {
+	store  BlobStore
+	policy *RetryPolicy
+}
+
+func CreateRetryingBlobStore(store BlobStore, policy *RetryPolicy) *RetryingBlobStore {
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+	return &RetryingBlobStore{store: store, policy: policy}
+}
+
+func (r *RetryingBlobStore) Upload(ctx *context.Context, file File) error {
+	defer file.Close()
+	content, streamed, err := readBuffered(file, r.maxBufferedSize())
+	if err != nil {
+		return &common.UploadError{Message: err.Error()}
+	}
+	if streamed != nil {
+		attemptCtx, cancel := r.attemptContext(ctx)
+		defer cancel()
+		return r.store.Upload(&attemptCtx, streamed)
+	}
+	metadata := GetMetadata(file)
+	_, err = retry(r, ctx, "upload", file.Name(), func(attemptCtx *context.Context) (struct{}, error) {
+		return struct{}{}, r.store.Upload(attemptCtx,
+			newBufferedFile(file.Name(), file.Type(), content, metadata))
+	})
+	return err
+}
+
+// Download returns a file whose attempt timeout, if any, keeps running until
+// it is closed.
+func (r *RetryingBlobStore) Download(ctx *context.Context, fileName string) (File, error) {
+	return retry(r, ctx, "download", fileName, func(attemptCtx *context.Context) (File, error) {
+		return r.store.Download(attemptCtx, fileName)
+	})
+}
+
+func (r *RetryingBlobStore) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (File, error) {
+	rangeReader, ok := r.store.(RangeReader)
+	if !ok {
+		return nil, &common.UnsupportedOperationError{Operation: "DownloadRange"}
+	}
+	return retry(r, ctx, "download range", fileName, func(attemptCtx *context.Context) (File, error) {
+		return rangeReader.DownloadRange(attemptCtx, fileName, offset, length)
+	})
+}
+
+func (r *RetryingBlobStore) Delete(ctx *context.Context, fileName string) error {
+	_, err := retry(r, ctx, "delete", fileName, func(attemptCtx *context.Context) (struct{}, error) {
+		return struct{}{}, r.store.Delete(attemptCtx, fileName)
+	})
+	return err
+}
+
+func (r *RetryingBlobStore) Stat(ctx *context.Context, fileName string) (*ObjectInfo, error) {
+	return retry(r, ctx, "stat", fileName, func(attemptCtx *context.Context) (*ObjectInfo, error) {
+		return r.store.Stat(attemptCtx, fileName)
+	})
+}
+
+func (r *RetryingBlobStore) Exists(ctx *context.Context, fileName string) (bool, error) {
+	return retry(r, ctx, "exists", fileName, func(attemptCtx *context.Context) (bool, error) {
+		return r.store.Exists(attemptCtx, fileName)
+	})
+}
+
+func (r *RetryingBlobStore) List(ctx *context.Context, prefix string, pageToken string) (*ObjectPage, error) {
+	return retry(r, ctx, "list", prefix, func(attemptCtx *context.Context) (*ObjectPage, error) {
+		return r.store.List(attemptCtx, prefix, pageToken)
+	})
+}
+
+// Signing doesn't call the store's backend, so it isn't retried.
+func (r *RetryingBlobStore) SignedUploadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := r.store.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedUploadURL"}
+	}
+	return signer.SignedUploadURL(ctx, fileName, options)
+}
+
+func (r *RetryingBlobStore) SignedDownloadURL(ctx *context.Context, fileName string,
+	options *SignOptions) (string, error) {
+	signer, ok := r.store.(URLSigner)
+	if !ok {
+		return "", &common.UnsupportedOperationError{Operation: "SignedDownloadURL"}
+	}
+	return signer.SignedDownloadURL(ctx, fileName, options)
+}
+
+// retry runs attempt until it succeeds, fails with an error that isn't
+// retryable, runs out of attempts or ctx is done. Each attempt gets its own
+// context, cancelled once the attempt returns, or for a File once it's closed.
+func retry[T any](r *RetryingBlobStore, ctx *context.Context, operation string, fileName string,
+	attempt func(attemptCtx *context.Context) (T, error)) (T, error) {
+	retryable := r.policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	maxAttempts := max(1, r.policy.MaxAttempts)
+	for number := 1; ; number++ {
+		attemptCtx, cancel := r.attemptContext(ctx)
+		result, err := attempt(&attemptCtx)
+		if err == nil {
+			if file, ok := any(result).(File); ok {
+				return any(&cancelOnCloseFile{File: file, cancel: cancel}).(T), nil
+			}
+			cancel()
+			return result, nil
+		}
+		cancel()
+		if number >= maxAttempts || (*ctx).Err() != nil || !retryable(err) {
+			return result, err
+		}
+
+		backoff := r.backoff(number)
+		if r.policy.OnRetry != nil {
+			r.policy.OnRetry(&RetryAttempt{
+				Operation: operation,
+				FileName:  fileName,
+				Attempt:   number,
+				Err:       err,
+				Backoff:   backoff,
+			})
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-(*ctx).Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *RetryingBlobStore) maxBufferedSize() int64 {
+	if r.policy.MaxBufferedSize <= 0 {
+		return DefaultMaxBufferedSize
+	}
+	return r.policy.MaxBufferedSize
+}
+
+func (r *RetryingBlobStore) attemptContext(ctx *context.Context) (context.Context, context.CancelFunc) {
+	if r.policy.AttemptTimeout <= 0 {
+		return context.WithCancel(*ctx)
+	}
+	return context.WithTimeout(*ctx, r.policy.AttemptTimeout)
+}
+
+// backoff doubles InitialBackoff for every failed attempt up to MaxBackoff
+// and keeps a random half of it, so clients failing together spread out.
+func (r *RetryingBlobStore) backoff(attempt int) time.Duration {
+	backoff := r.policy.InitialBackoff
+	for i := 1; i < attempt && (r.policy.MaxBackoff <= 0 || backoff < r.policy.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if r.policy.MaxBackoff > 0 && backoff > r.policy.MaxBackoff {
+		backoff = r.policy.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + rand.N(backoff-half+1)
+}
+
+// cancelOnCloseFile keeps an attempt's context alive while the file is read.
+type cancelOnCloseFile struct {
+	File
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnCloseFile) Metadata() *Metadata {
+	return GetMetadata(c.File)
+}
+
+func (c *cancelOnCloseFile) Close() error {
+	defer c.cancel()
+	return c.File.Close()
+}
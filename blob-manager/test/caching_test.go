@@ -0,0 +1,209 @@
+package test
+
+import (
+	"blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// countingStore counts the downloads that reach the backing store, and runs
+// afterDownload once a download has read the object.
+type countingStore struct {
+	blobmanager.BlobStore
+	downloads     int
+	afterDownload func()
+}
+
+func (c *countingStore) Download(ctx *context.Context, fileName string) (blobmanager.File, error) {
+	c.downloads++
+	file, err := c.BlobStore.Download(ctx, fileName)
+	if c.afterDownload != nil {
+		afterDownload := c.afterDownload
+		c.afterDownload = nil
+		afterDownload()
+	}
+	return file, err
+}
+
+// signingStore signs urls for any object.
+type signingStore struct {
+	blobmanager.BlobStore
+}
+
+func (s *signingStore) SignedUploadURL(ctx *context.Context, fileName string,
+	options *blobmanager.SignOptions) (string, error) {
+	return "https://blobs.example.com/upload/" + fileName, nil
+}
+
+func (s *signingStore) SignedDownloadURL(ctx *context.Context, fileName string,
+	options *blobmanager.SignOptions) (string, error) {
+	return "https://blobs.example.com/" + fileName, nil
+}
+
+func TestCachingBlobStore_Download(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name          string
+		validateETag  bool
+		diskTier      bool
+		modify        func(t *testing.T, store *countingStore, cache *blobmanager.CachingBlobStore)
+		want          string
+		wantDownloads int
+		wantStats     blobmanager.CacheStats
+	}{
+		{
+			name:          "memory hit",
+			want:          "first",
+			wantDownloads: 1,
+			wantStats:     blobmanager.CacheStats{Hits: 1, Misses: 1, Bytes: 5, Entries: 1},
+		},
+		{
+			name: "invalidated by upload",
+			modify: func(t *testing.T, store *countingStore, cache *blobmanager.CachingBlobStore) {
+				if err := cache.Upload(&ctx, getFile("avatar", []byte("second"), "image/png")); err != nil {
+					t.Fatalf("Upload() error = %v", err)
+				}
+			},
+			want:          "second",
+			wantDownloads: 2,
+			wantStats:     blobmanager.CacheStats{Misses: 2, Bytes: 6, Entries: 1},
+		},
+		{
+			name:         "stale etag",
+			validateETag: true,
+			modify: func(t *testing.T, store *countingStore, cache *blobmanager.CachingBlobStore) {
+				if err := store.Upload(&ctx, getFile("avatar", []byte("second"), "image/png")); err != nil {
+					t.Fatalf("Upload() error = %v", err)
+				}
+			},
+			want:          "second",
+			wantDownloads: 2,
+			wantStats:     blobmanager.CacheStats{Misses: 2, Bytes: 6, Entries: 1},
+		},
+		{
+			name:          "valid etag",
+			validateETag:  true,
+			want:          "first",
+			wantDownloads: 1,
+			wantStats:     blobmanager.CacheStats{Hits: 1, Misses: 1, Bytes: 5, Entries: 1},
+		},
+		{
+			name:     "disk hit after eviction",
+			diskTier: true,
+			modify: func(t *testing.T, store *countingStore, cache *blobmanager.CachingBlobStore) {
+				if err := store.Upload(&ctx, getFile("other", []byte("0123456789"), "image/png")); err != nil {
+					t.Fatalf("Upload() error = %v", err)
+				}
+				if _, err := cache.Download(&ctx, "other"); err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+			},
+			want:          "first",
+			wantDownloads: 2,
+			wantStats:     blobmanager.CacheStats{DiskHits: 1, Misses: 2, Evictions: 2, Bytes: 5, Entries: 1},
+		},
+		{
+			name:     "download racing an upload",
+			diskTier: true,
+			modify: func(t *testing.T, store *countingStore, cache *blobmanager.CachingBlobStore) {
+				cache.Invalidate(&ctx, "avatar")
+				// the upload lands after the download read the old content
+				store.afterDownload = func() {
+					if err := cache.Upload(&ctx, getFile("avatar", []byte("second"), "image/png")); err != nil {
+						t.Fatalf("Upload() error = %v", err)
+					}
+				}
+				if _, err := cache.Download(&ctx, "avatar"); err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+			},
+			want:          "second",
+			wantDownloads: 3,
+			wantStats:     blobmanager.CacheStats{Misses: 3, Bytes: 6, Entries: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &countingStore{BlobStore: newLocalStore(t)}
+			options := &blobmanager.CacheOptions{MaxBytes: 12, ValidateETag: tt.validateETag}
+			if tt.diskTier {
+				options.DiskTier = newLocalStore(t)
+			}
+			cache, err := blobmanager.CreateCachingBlobStore(store, options)
+			if err != nil {
+				t.Fatalf("CreateCachingBlobStore() error = %v", err)
+			}
+			if err := cache.Upload(&ctx, getFile("avatar", []byte("first"), "image/png")); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+			if _, err := cache.Download(&ctx, "avatar"); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if tt.modify != nil {
+				tt.modify(t, store, cache)
+			}
+
+			got, err := cache.Download(&ctx, "avatar")
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			defer got.Close()
+			if content, _ := io.ReadAll(got); string(content) != tt.want || got.Type() != "image/png" {
+				t.Errorf("Download() got = %q (%s), want %q", content, got.Type(), tt.want)
+			}
+			if store.downloads != tt.wantDownloads {
+				t.Errorf("backing store downloads = %d, want %d", store.downloads, tt.wantDownloads)
+			}
+			if stats := cache.Stats(); stats != tt.wantStats {
+				t.Errorf("Stats() = %+v, want %+v", stats, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestCachingBlobStore_Delete(t *testing.T) {
+	var ctx = context.Background()
+	cache, err := blobmanager.CreateCachingBlobStore(newLocalStore(t),
+		&blobmanager.CacheOptions{MaxBytes: 1024, DiskTier: newLocalStore(t)})
+	if err != nil {
+		t.Fatalf("CreateCachingBlobStore() error = %v", err)
+	}
+	if err := cache.Upload(&ctx, getFile("avatar", []byte("first"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if _, err := cache.Download(&ctx, "avatar"); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if err := cache.Delete(&ctx, "avatar"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	var notFound *common.ObjectNotFound
+	if _, err := cache.Download(&ctx, "avatar"); !errors.As(err, &notFound) {
+		t.Errorf("Download() after Delete() error = %v, want ObjectNotFound", err)
+	}
+	if exists, _ := cache.Exists(&ctx, "avatar"); exists {
+		t.Errorf("Exists() after Delete() = true")
+	}
+}
+
+func TestCachingBlobStore_SignedURLs(t *testing.T) {
+	var ctx = context.Background()
+	cache, err := blobmanager.CreateCachingBlobStore(&signingStore{BlobStore: newLocalStore(t)},
+		&blobmanager.CacheOptions{MaxBytes: 1024})
+	if err != nil {
+		t.Fatalf("CreateCachingBlobStore() error = %v", err)
+	}
+	if url, err := cache.SignedDownloadURL(&ctx, "avatar", nil); err != nil || url != "https://blobs.example.com/avatar" {
+		t.Errorf("SignedDownloadURL() = %s, %v, want the backing store's url", url, err)
+	}
+
+	unsigned, _ := blobmanager.CreateCachingBlobStore(newLocalStore(t), &blobmanager.CacheOptions{MaxBytes: 1024})
+	var unsupported *common.UnsupportedOperationError
+	if _, err := unsigned.SignedDownloadURL(&ctx, "avatar", nil); !errors.As(err, &unsupported) {
+		t.Errorf("SignedDownloadURL() error = %v, want UnsupportedOperationError", err)
+	}
+}
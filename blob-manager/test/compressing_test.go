@@ -0,0 +1,253 @@
+package test
+
+import (
+	"blob-manager"
+	common "blob-manager/common"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressingBlobStore_UploadDownload(t *testing.T) {
+	var ctx = context.Background()
+	document := []byte(strings.Repeat(`{"userId":"user-1","firstName":"Jane"},`, 100))
+	random := make([]byte, 4096)
+	rand.Read(random)
+	tests := []struct {
+		name         string
+		encoding     blobmanager.Encoding
+		content      []byte
+		contentType  string
+		wantEncoding string
+	}{
+		{name: "gzip json", content: document, contentType: "application/json", wantEncoding: "gzip"},
+		{name: "zstd json", encoding: blobmanager.EncodingZstd, content: document,
+			contentType: "application/json; charset=utf-8", wantEncoding: "zstd"},
+		{name: "text family", content: document, contentType: "text/csv", wantEncoding: "gzip"},
+		{name: "structured suffix", content: document, contentType: "application/ld+json", wantEncoding: "gzip"},
+		{name: "svg", content: document, contentType: "image/svg+xml", wantEncoding: "gzip"},
+		{name: "jpeg", content: document, contentType: "image/jpeg"},
+		{name: "below minimum size", content: []byte(`{"a":1}`), contentType: "application/json"},
+		{name: "incompressible", content: random, contentType: "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newLocalStore(t)
+			compressing := newCompressingStore(t, store, tt.encoding)
+			if err := compressing.Upload(&ctx, getFile("export", tt.content, tt.contentType)); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+
+			stored, err := store.Stat(&ctx, "export")
+			if err != nil {
+				t.Fatalf("Stat() on backing store error = %v", err)
+			}
+			if got := stored.Metadata.Get(blobmanager.EncodingMetadataKey); got != tt.wantEncoding {
+				t.Errorf("stored encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if compressed := len(tt.wantEncoding) > 0; compressed != (stored.Size < int64(len(tt.content))) {
+				t.Errorf("stored size = %d of %d bytes", stored.Size, len(tt.content))
+			}
+
+			file, err := compressing.Download(&ctx, "export")
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			content, err := io.ReadAll(file)
+			file.Close()
+			if err != nil || !bytes.Equal(content, tt.content) {
+				t.Errorf("Download() content = %d bytes, error = %v, want %d bytes", len(content), err, len(tt.content))
+			}
+			if file.Size() != int64(len(tt.content)) {
+				t.Errorf("Download() size = %d, want %d", file.Size(), len(tt.content))
+			}
+			if got := blobmanager.GetMetadata(file).Get(blobmanager.EncodingMetadataKey); len(got) > 0 {
+				t.Errorf("Download() metadata has encoding %q", got)
+			}
+			info, err := compressing.Stat(&ctx, "export")
+			if err != nil || info.Size != int64(len(tt.content)) {
+				t.Errorf("Stat() size = %v, error = %v, want %d", info, err, len(tt.content))
+			}
+		})
+	}
+}
+
+func TestCompressingBlobStore_DownloadRange(t *testing.T) {
+	var ctx = context.Background()
+	content := []byte(strings.Repeat("0123456789", 100))
+	tests := []struct {
+		name        string
+		contentType string
+		offset      int64
+		length      int64
+		unsized     bool
+		want        string
+		wantErr     bool
+	}{
+		{name: "compressed", contentType: "text/plain", offset: 995, length: 3, want: "567"},
+		{name: "compressed to end", contentType: "text/plain", offset: 997, length: -1, want: "789"},
+		{name: "uncompressed", contentType: "application/octet-stream", offset: 12, length: 4, want: "2345"},
+		{name: "offset past end", contentType: "text/plain", offset: 1001, length: 1, wantErr: true},
+		{name: "unknown size", contentType: "text/plain", unsized: true, offset: 995, length: 3, want: "567"},
+		{name: "unknown size to end", contentType: "text/plain", unsized: true, offset: 998, length: 5,
+			want: "89"},
+		{name: "unknown size past end", contentType: "text/plain", unsized: true, offset: 1001, length: 1,
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newLocalStore(t)
+			compressing := newCompressingStore(t, store, blobmanager.EncodingZstd)
+			if err := compressing.Upload(&ctx, getFile("log", content, tt.contentType)); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+			if tt.unsized {
+				dropUncompressedSize(t, store, "log")
+			}
+			file, err := compressing.DownloadRange(&ctx, "log", tt.offset, tt.length)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DownloadRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer file.Close()
+			got, _ := io.ReadAll(file)
+			wantSize := int64(len(tt.want))
+			if tt.unsized {
+				wantSize = -1
+			}
+			if string(got) != tt.want || file.Size() != wantSize {
+				t.Errorf("DownloadRange() = %q of size %d, want %q", got, file.Size(), tt.want)
+			}
+		})
+	}
+}
+
+// replacedStore replaces an object right after it's been stat'ed.
+type replacedStore struct {
+	blobmanager.BlobStore
+	replace func()
+}
+
+func (r *replacedStore) Stat(ctx *context.Context, fileName string) (*blobmanager.ObjectInfo, error) {
+	info, err := r.BlobStore.Stat(ctx, fileName)
+	if r.replace != nil {
+		r.replace()
+		r.replace = nil
+	}
+	return info, err
+}
+
+func (r *replacedStore) DownloadRange(ctx *context.Context, fileName string,
+	offset int64, length int64) (blobmanager.File, error) {
+	return r.BlobStore.(blobmanager.RangeReader).DownloadRange(ctx, fileName, offset, length)
+}
+
+func TestCompressingBlobStore_DownloadRangeReplaced(t *testing.T) {
+	var ctx = context.Background()
+	store := &replacedStore{BlobStore: newLocalStore(t)}
+	compressing := newCompressingStore(t, store, blobmanager.EncodingGzip)
+	if err := compressing.Upload(&ctx, getFile("log", []byte(strings.Repeat("0123456789", 100)),
+		"text/plain")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	store.replace = func() {
+		if err := store.BlobStore.Upload(&ctx, getFile("log", []byte("replaced"), "text/plain")); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+	}
+
+	file, err := compressing.DownloadRange(&ctx, "log", 2, 3)
+	if err != nil {
+		t.Fatalf("DownloadRange() error = %v", err)
+	}
+	defer file.Close()
+	if got, _ := io.ReadAll(file); string(got) != "pla" {
+		t.Errorf("DownloadRange() = %q, want %q", got, "pla")
+	}
+}
+
+// dropUncompressedSize stores the object again without the uncompressed size
+// in its metadata.
+func dropUncompressedSize(t *testing.T, store blobmanager.BlobStore, fileName string) {
+	var ctx = context.Background()
+	file, err := store.Download(&ctx, fileName)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	content, _ := io.ReadAll(file)
+	file.Close()
+	metadata := blobmanager.GetMetadata(file).Clone()
+	delete(metadata.UserMetadata, "blob-uncompressed-size")
+	if err := store.Upload(&ctx, blobmanager.NewUploadableFile(fileName, getReadCloserFromByteArray(content),
+		int64(len(content)), file.Type()).WithMetadata(metadata)); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+}
+
+func TestCompressingBlobStore_UploadChecksum(t *testing.T) {
+	var ctx = context.Background()
+	content := []byte(strings.Repeat("compressible notes ", 20))
+	sum := sha256.Sum256(content)
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{name: "matching checksum", checksum: base64.StdEncoding.EncodeToString(sum[:])},
+		{name: "mismatched checksum", checksum: base64.StdEncoding.EncodeToString(make([]byte, 32)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newLocalStore(t)
+			metadata := &blobmanager.Metadata{}
+			metadata.Set(blobmanager.ChecksumMetadataKey, tt.checksum)
+			err := newCompressingStore(t, store, blobmanager.EncodingGzip).Upload(&ctx,
+				blobmanager.NewUploadableFile("notes", getReadCloserFromByteArray(content),
+					int64(len(content)), "text/plain").WithMetadata(metadata))
+			var integrityError *common.IntegrityError
+			if (err != nil) != tt.wantErr || (tt.wantErr && !errors.As(err, &integrityError)) {
+				t.Fatalf("Upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if exists, _ := store.Exists(&ctx, "notes"); exists == tt.wantErr {
+				t.Errorf("Upload() stored the object = %v, want %v", exists, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompressingBlobStore_Uncompressed(t *testing.T) {
+	var ctx = context.Background()
+	store := newLocalStore(t)
+	content := []byte(strings.Repeat("stored before compression ", 20))
+	if err := store.Upload(&ctx, getFile("notes", content, "text/plain")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	file, err := newCompressingStore(t, store, blobmanager.EncodingGzip).Download(&ctx, "notes")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	defer file.Close()
+	if got, _ := io.ReadAll(file); !bytes.Equal(got, content) {
+		t.Errorf("Download() = %q, want %q", got, content)
+	}
+}
+
+func newCompressingStore(t *testing.T, store blobmanager.BlobStore,
+	encoding blobmanager.Encoding) *blobmanager.CompressingBlobStore {
+	compressing, err := blobmanager.CreateCompressingBlobStore(store, &blobmanager.CompressionOptions{
+		Encoding: encoding,
+		MinSize:  64,
+	})
+	if err != nil {
+		t.Fatalf("CreateCompressingBlobStore() error = %v", err)
+	}
+	return compressing
+}
@@ -0,0 +1,372 @@
+package test
+
+import (
+	"blob-manager"
+	common "blob-manager/common"
+	"blob-manager/local"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime/multipart"
+	"testing"
+)
+
+func TestEncryptingBlobStore_UploadDownload(t *testing.T) {
+	var ctx = context.Background()
+	content := []byte("profile picture")
+	tests := []struct {
+		name        string
+		writeKeyId  string
+		readKeyring *blobmanager.Keyring
+		wantErr     bool
+	}{
+		{
+			name:        "same keyring",
+			writeKeyId:  "key-1",
+			readKeyring: keyring("key-1", "key-1"),
+		},
+		{
+			name:        "rotated master key",
+			writeKeyId:  "key-1",
+			readKeyring: keyring("key-2", "key-1", "key-2"),
+		},
+		{
+			name:        "retired master key",
+			writeKeyId:  "key-1",
+			readKeyring: keyring("key-2", "key-2"),
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newLocalStore(t)
+			writer := newEncryptingStore(t, store, nil, keyring(tt.writeKeyId, tt.writeKeyId))
+			if err := writer.Upload(&ctx, getFile("avatar", content, "image/png")); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+
+			stored, err := store.Download(&ctx, "avatar")
+			if err != nil {
+				t.Fatalf("Download() from backing store error = %v", err)
+			}
+			ciphertext, _ := io.ReadAll(stored)
+			stored.Close()
+			if bytes.Contains(ciphertext, content) {
+				t.Errorf("backing store holds plaintext %q", ciphertext)
+			}
+
+			reader := newEncryptingStore(t, store, nil, tt.readKeyring)
+			got, err := reader.Download(&ctx, "avatar")
+			var encryptionError *common.EncryptionError
+			if (err != nil) != tt.wantErr || (tt.wantErr && !errors.As(err, &encryptionError)) {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer got.Close()
+			plaintext, _ := io.ReadAll(got)
+			if !bytes.Equal(plaintext, content) || got.Type() != "image/png" || got.Size() != int64(len(content)) {
+				t.Errorf("Download() got = %q (%s, %d), want %q", plaintext, got.Type(), got.Size(), content)
+			}
+			if len(blobmanager.GetMetadata(got).UserMetadata) != 0 {
+				t.Errorf("Download() leaks encryption metadata %v", blobmanager.GetMetadata(got).UserMetadata)
+			}
+		})
+	}
+}
+
+func TestEncryptingBlobStore_UploadCloses(t *testing.T) {
+	var ctx = context.Background()
+	file, closed := getClosableFile("avatar", []byte("profile picture"), "image/png")
+	encrypting := newEncryptingStore(t, newLocalStore(t), nil, keyring("key-1", "key-1"))
+	if err := encrypting.Upload(&ctx, file); err != nil || !closed() {
+		t.Errorf("Upload() error = %v, closed the file = %v", err, closed())
+	}
+}
+
+func TestEncryptingBlobStore_UploadChecksum(t *testing.T) {
+	var ctx = context.Background()
+	content := []byte("profile picture")
+	sum := sha256.Sum256(content)
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{name: "matching checksum", checksum: base64.StdEncoding.EncodeToString(sum[:])},
+		{name: "mismatched checksum", checksum: base64.StdEncoding.EncodeToString(make([]byte, 32)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newLocalStore(t)
+			encrypting := newEncryptingStore(t, store, nil, keyring("key-1", "key-1"))
+			metadata := &blobmanager.Metadata{}
+			metadata.Set(blobmanager.ChecksumMetadataKey, tt.checksum)
+			err := encrypting.Upload(&ctx, blobmanager.NewUploadableFile("avatar",
+				getReadCloserFromByteArray(content), int64(len(content)), "image/png").WithMetadata(metadata))
+			var integrityError *common.IntegrityError
+			if (err != nil) != tt.wantErr || (tt.wantErr && !errors.As(err, &integrityError)) {
+				t.Fatalf("Upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if exists, _ := store.Exists(&ctx, "avatar"); exists == tt.wantErr {
+				t.Errorf("Upload() stored the object = %v, want %v", exists, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptingBlobStore_TooLarge(t *testing.T) {
+	var ctx = context.Background()
+	store := newLocalStore(t)
+	encrypting := newEncryptingStore(t, store, &blobmanager.EncryptionOptions{MaxObjectSize: 4},
+		keyring("key-1", "key-1"))
+	var tooLarge *common.ObjectTooLargeError
+	err := encrypting.Upload(&ctx, getFile("avatar", []byte("profile picture"), "image/png"))
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("Upload() error = %v, want ObjectTooLargeError", err)
+	}
+	if exists, _ := store.Exists(&ctx, "avatar"); exists {
+		t.Errorf("Upload() stored an object larger than MaxObjectSize")
+	}
+}
+
+func TestEncryptingBlobStore_Tampered(t *testing.T) {
+	var ctx = context.Background()
+	store := newLocalStore(t)
+	encrypting := newEncryptingStore(t, store, nil, keyring("key-1", "key-1"))
+	if err := encrypting.Upload(&ctx, getFile("avatar", []byte("profile picture"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	stored, _ := store.Download(&ctx, "avatar")
+	ciphertext, _ := io.ReadAll(stored)
+	stored.Close()
+	ciphertext[0] ^= 0xff
+	// drop the stored checksum, the local store would reject the tampered upload
+	metadata := blobmanager.GetMetadata(stored).Clone()
+	delete(metadata.UserMetadata, blobmanager.ChecksumMetadataKey)
+	tampered := blobmanager.NewUploadableFile("avatar", getReadCloserFromByteArray(ciphertext),
+		int64(len(ciphertext)), "image/png").WithMetadata(metadata)
+	if err := store.Upload(&ctx, tampered); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	var encryptionError *common.EncryptionError
+	if _, err := encrypting.Download(&ctx, "avatar"); !errors.As(err, &encryptionError) {
+		t.Errorf("Download() error = %v, want EncryptionError", err)
+	}
+}
+
+func TestEncryptingBlobStore_Rewrap(t *testing.T) {
+	var ctx = context.Background()
+	store := newLocalStore(t)
+	old := newEncryptingStore(t, store, nil, keyring("key-1", "key-1"))
+	if err := old.Upload(&ctx, getFile("avatar", []byte("profile picture"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	rotated := newEncryptingStore(t, store, nil, keyring("key-2", "key-1", "key-2"))
+	if err := rotated.Rewrap(&ctx, "avatar"); err != nil {
+		t.Fatalf("Rewrap() error = %v", err)
+	}
+
+	retired := newEncryptingStore(t, store, nil, keyring("key-2", "key-2"))
+	got, err := retired.Download(&ctx, "avatar")
+	if err != nil {
+		t.Fatalf("Download() after Rewrap() error = %v", err)
+	}
+	defer got.Close()
+	if content, _ := io.ReadAll(got); string(content) != "profile picture" {
+		t.Errorf("Download() after Rewrap() got = %q", content)
+	}
+
+	info, err := retired.Stat(&ctx, "avatar")
+	if err != nil || info.Size != int64(len("profile picture")) {
+		t.Errorf("Stat() got = %+v, %v", info, err)
+	}
+}
+
+func TestEncryptingBlobStore_Unencrypted(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name    string
+		options *blobmanager.EncryptionOptions
+		wantErr bool
+	}{
+		{name: "rejected by default", options: nil, wantErr: true},
+		{name: "allowed while migrating", options: &blobmanager.EncryptionOptions{AllowPlaintext: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newLocalStore(t)
+			if err := store.Upload(&ctx, getFile("avatar", []byte("legacy picture"), "image/png")); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+
+			encrypting := newEncryptingStore(t, store, tt.options, keyring("key-1", "key-1"))
+			got, err := encrypting.Download(&ctx, "avatar")
+			var encryptionError *common.EncryptionError
+			if tt.wantErr {
+				if !errors.As(err, &encryptionError) {
+					t.Errorf("Download() error = %v, want EncryptionError", err)
+				}
+				if err := encrypting.Rewrap(&ctx, "avatar"); !errors.As(err, &encryptionError) {
+					t.Errorf("Rewrap() error = %v, want EncryptionError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if content, _ := io.ReadAll(got); string(content) != "legacy picture" {
+				t.Errorf("Download() got = %q, want legacy picture", content)
+			}
+			got.Close()
+
+			// Rewrap migrates the object, it's readable without AllowPlaintext then
+			if err := encrypting.Rewrap(&ctx, "avatar"); err != nil {
+				t.Fatalf("Rewrap() error = %v", err)
+			}
+			strict := newEncryptingStore(t, store, nil, keyring("key-1", "key-1"))
+			migrated, err := strict.Download(&ctx, "avatar")
+			if err != nil {
+				t.Fatalf("Download() after Rewrap() error = %v", err)
+			}
+			defer migrated.Close()
+			if content, _ := io.ReadAll(migrated); string(content) != "legacy picture" {
+				t.Errorf("Download() after Rewrap() got = %q, want legacy picture", content)
+			}
+		})
+	}
+}
+
+func TestEncryptingBlobStore_Swapped(t *testing.T) {
+	var ctx = context.Background()
+	store := newLocalStore(t)
+	encrypting := newEncryptingStore(t, store, nil, keyring("key-1", "key-1"))
+	if err := encrypting.Upload(&ctx, getFile("alice", []byte("alice's picture"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	// copy alice's ciphertext and wrapped key over bob's object
+	stored, _ := store.Download(&ctx, "alice")
+	ciphertext, _ := io.ReadAll(stored)
+	stored.Close()
+	swapped := blobmanager.NewUploadableFile("bob", getReadCloserFromByteArray(ciphertext),
+		int64(len(ciphertext)), "image/png").WithMetadata(blobmanager.GetMetadata(stored).Clone())
+	if err := store.Upload(&ctx, swapped); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	var encryptionError *common.EncryptionError
+	if _, err := encrypting.Download(&ctx, "bob"); !errors.As(err, &encryptionError) {
+		t.Errorf("Download() of a swapped object error = %v, want EncryptionError", err)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name        string
+		activeKeyId string
+		masterKeys  string
+		wantErr     bool
+	}{
+		{
+			name:        "valid",
+			activeKeyId: "key-2",
+			masterKeys:  "key-1:" + encodedKey("key-1") + ", key-2:" + encodedKey("key-2"),
+		},
+		{
+			name:        "missing active key",
+			activeKeyId: "key-3",
+			masterKeys:  "key-1:" + encodedKey("key-1"),
+			wantErr:     true,
+		},
+		{
+			name:        "short key",
+			activeKeyId: "key-1",
+			masterKeys:  "key-1:c2hvcnQ=",
+			wantErr:     true,
+		},
+		{
+			name:        "missing separator",
+			activeKeyId: "key-1",
+			masterKeys:  encodedKey("key-1"),
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := blobmanager.ParseKeyring(tt.activeKeyId, tt.masterKeys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func keyring(activeKeyId string, keyIds ...string) *blobmanager.Keyring {
+	masterKeys := map[string][]byte{}
+	for _, keyId := range keyIds {
+		masterKeys[keyId] = masterKey(keyId)
+	}
+	return &blobmanager.Keyring{ActiveKeyId: activeKeyId, MasterKeys: masterKeys}
+}
+
+func masterKey(keyId string) []byte {
+	return bytes.Repeat([]byte(keyId[len(keyId)-1:]), 32)
+}
+
+func encodedKey(keyId string) string {
+	return base64.StdEncoding.EncodeToString(masterKey(keyId))
+}
+
+func newEncryptingStore(t *testing.T, store blobmanager.BlobStore, options *blobmanager.EncryptionOptions,
+	keyring *blobmanager.Keyring) *blobmanager.EncryptingBlobStore {
+	encrypting, err := blobmanager.CreateEncryptingBlobStore(store, keyring, options)
+	if err != nil {
+		t.Fatalf("CreateEncryptingBlobStore() error = %v", err)
+	}
+	return encrypting
+}
+
+func newLocalStore(t *testing.T) *local.FileSystemClient {
+	client, err := local.CreateFileSystemClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("CreateFileSystemClient() error = %v", err)
+	}
+	return client
+}
+
+func getFile(fileId string, content []byte, contentType string) blobmanager.File {
+	return blobmanager.NewUploadableFile(fileId, getReadCloserFromByteArray(content),
+		int64(len(content)), contentType)
+}
+
+// A struct to wrap bytes.Reader and implement io.Closer
+type reader struct {
+	*bytes.Reader
+	closed bool
+}
+
+// Implement the Close method to satisfy the io.Closer interface
+func (rc *reader) Close() error {
+	rc.closed = true
+	return nil
+}
+
+// getClosableFile returns a file and reports whether it was closed.
+func getClosableFile(fileId string, content []byte, contentType string) (blobmanager.File, func() bool) {
+	closer := &reader{Reader: bytes.NewReader(content)}
+	file := blobmanager.NewUploadableFile(fileId, closer, int64(len(content)), contentType)
+	return file, func() bool { return closer.closed }
+}
+
+// getReadCloserFromByteArray converts a byte array to multipart.File
+func getReadCloserFromByteArray(data []byte) multipart.File {
+	return &reader{Reader: bytes.NewReader(data)}
+}
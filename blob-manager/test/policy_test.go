@@ -0,0 +1,203 @@
+package test
+
+import (
+	"blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newPolicyStore(t *testing.T, store blobmanager.BlobStore,
+	usage blobmanager.UsageStore) *blobmanager.PolicyBlobStore {
+	policyStore, err := blobmanager.CreatePolicyBlobStore(store, &blobmanager.UploadPolicy{
+		MaxObjectSize:       10,
+		AllowedContentTypes: []string{"image/png", "image/jpeg"},
+		Quota:               16,
+		Owner: func(fileName string) string {
+			owner, _, _ := strings.Cut(fileName, "/")
+			if owner == "uploads" {
+				return ""
+			}
+			return owner
+		},
+	}, usage)
+	if err != nil {
+		t.Fatalf("CreatePolicyBlobStore() error = %v", err)
+	}
+	return policyStore
+}
+
+func TestPolicyBlobStore_Upload(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name        string
+		fileName    string
+		content     string
+		contentType string
+		wantErr     error
+		wantUsage   int64
+	}{
+		{name: "allowed", fileName: "user-1/avatar", content: "picture", contentType: "image/png",
+			wantUsage: 7},
+		{name: "content type with parameters", fileName: "user-1/avatar", content: "picture",
+			contentType: "image/JPEG; q=1", wantUsage: 7},
+		{name: "content type not allowed", fileName: "user-1/avatar", content: "<svg/>",
+			contentType: "image/svg+xml", wantErr: &common.ContentTypeNotAllowedError{}},
+		{name: "too large", fileName: "user-1/avatar", content: "a much larger picture",
+			contentType: "image/png", wantErr: &common.ObjectTooLargeError{}},
+		{name: "not accounted", fileName: "uploads/user-1", content: "picture", contentType: "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := blobmanager.NewMemoryUsageStore()
+			store := newPolicyStore(t, newLocalStore(t), usage)
+			err := store.Upload(&ctx, getFile(tt.fileName, []byte(tt.content), tt.contentType))
+			if !matchesError(err, tt.wantErr) {
+				t.Fatalf("Upload() error = %v, want %T", err, tt.wantErr)
+			}
+			if got, _ := store.Usage(&ctx, "user-1"); got != tt.wantUsage {
+				t.Errorf("Usage() = %d, want %d", got, tt.wantUsage)
+			}
+			exists, _ := store.Exists(&ctx, tt.fileName)
+			if exists != (tt.wantErr == nil) {
+				t.Errorf("Exists() = %v after Upload() error = %v", exists, err)
+			}
+		})
+	}
+}
+
+func TestPolicyBlobStore_Quota(t *testing.T) {
+	var ctx = context.Background()
+	usage := blobmanager.NewMemoryUsageStore()
+	store := newPolicyStore(t, newLocalStore(t), usage)
+	steps := []struct {
+		name      string
+		upload    string
+		content   string
+		delete    string
+		wantErr   error
+		wantUsage int64
+	}{
+		{name: "first", upload: "user-1/a", content: "12345678", wantUsage: 8},
+		{name: "second", upload: "user-1/b", content: "12345678", wantUsage: 16},
+		{name: "over quota", upload: "user-1/c", content: "1", wantErr: &common.QuotaExceededError{},
+			wantUsage: 16},
+		{name: "overwrite smaller", upload: "user-1/a", content: "1234", wantUsage: 12},
+		{name: "fits again", upload: "user-1/c", content: "1234", wantUsage: 16},
+		{name: "delete", delete: "user-1/b", wantUsage: 8},
+		{name: "delete missing", delete: "user-1/b", wantErr: &common.ObjectNotFound{}, wantUsage: 8},
+	}
+	for _, step := range steps {
+		var err error
+		if len(step.upload) > 0 {
+			err = store.Upload(&ctx, getFile(step.upload, []byte(step.content), "image/png"))
+		} else {
+			err = store.Delete(&ctx, step.delete)
+		}
+		if !matchesError(err, step.wantErr) {
+			t.Fatalf("%s: error = %v, want %T", step.name, err, step.wantErr)
+		}
+		if got, _ := store.Usage(&ctx, "user-1"); got != step.wantUsage {
+			t.Errorf("%s: Usage() = %d, want %d", step.name, got, step.wantUsage)
+		}
+	}
+	if got, _ := store.Usage(&ctx, "user-2"); got != 0 {
+		t.Errorf("Usage() of another owner = %d, want 0", got)
+	}
+}
+
+func TestPolicyBlobStore_ConcurrentOverwrites(t *testing.T) {
+	var ctx = context.Background()
+	usage := blobmanager.NewMemoryUsageStore()
+	store := newPolicyStore(t, newLocalStore(t), usage)
+	var wait sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			errs <- store.Upload(&ctx, getFile("user-1/a", []byte("12345678"), "image/png"))
+		}()
+	}
+	wait.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Upload() error = %v, want overwrites of one object to be accounted once", err)
+		}
+	}
+	if got, _ := store.Usage(&ctx, "user-1"); got != 8 {
+		t.Errorf("Usage() = %d, want 8", got)
+	}
+}
+
+func TestPolicyBlobStore_FailedUpload(t *testing.T) {
+	var ctx = context.Background()
+	usage := blobmanager.NewMemoryUsageStore()
+	store := newPolicyStore(t, &faultyStore{BlobStore: newLocalStore(t), failWrites: true}, usage)
+	if err := store.Upload(&ctx, getFile("user-1/a", []byte("picture"), "image/png")); err == nil {
+		t.Fatalf("Upload() error = nil, want store error")
+	}
+	if got, _ := store.Usage(&ctx, "user-1"); got != 0 {
+		t.Errorf("Usage() after failed upload = %d, want 0", got)
+	}
+}
+
+func TestPolicyBlobStore_DeleteMissing(t *testing.T) {
+	var ctx = context.Background()
+	usage := blobmanager.NewMemoryUsageStore()
+	store := newPolicyStore(t, newLocalStore(t), usage)
+	// accounted, but removed from the backend behind the store's back
+	if _, err := usage.Set(&ctx, "user-1", "user-1/a", 8, 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := store.Delete(&ctx, "user-1/a"); !matchesError(err, &common.ObjectNotFound{}) {
+		t.Errorf("Delete() error = %v, want ObjectNotFound", err)
+	}
+	if got, _ := store.Usage(&ctx, "user-1"); got != 0 {
+		t.Errorf("Usage() after deleting a missing object = %d, want 0", got)
+	}
+}
+
+func TestCreatePolicyBlobStore(t *testing.T) {
+	var ctx = context.Background()
+	owner := func(fileName string) string { return "user-1" }
+	if _, err := blobmanager.CreatePolicyBlobStore(newLocalStore(t), &blobmanager.UploadPolicy{Owner: owner},
+		blobmanager.NewMemoryUsageStore()); err == nil {
+		t.Errorf("CreatePolicyBlobStore() accounting without a maximum object size error = nil")
+	}
+
+	store, err := blobmanager.CreatePolicyBlobStore(newLocalStore(t), &blobmanager.UploadPolicy{}, nil)
+	if err != nil {
+		t.Fatalf("CreatePolicyBlobStore() error = %v", err)
+	}
+	if err := store.Upload(&ctx, getFile("user-1/a", []byte("an unlimited picture"), "image/png")); err != nil {
+		t.Errorf("Upload() without limits error = %v", err)
+	}
+	if exists, _ := store.Exists(&ctx, "user-1/a"); !exists {
+		t.Errorf("Upload() without limits didn't store the object")
+	}
+}
+
+func matchesError(err error, want error) bool {
+	switch want.(type) {
+	case nil:
+		return err == nil
+	case *common.ContentTypeNotAllowedError:
+		var target *common.ContentTypeNotAllowedError
+		return errors.As(err, &target)
+	case *common.ObjectTooLargeError:
+		var target *common.ObjectTooLargeError
+		return errors.As(err, &target)
+	case *common.QuotaExceededError:
+		var target *common.QuotaExceededError
+		return errors.As(err, &target)
+	case *common.ObjectNotFound:
+		var target *common.ObjectNotFound
+		return errors.As(err, &target)
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package test
+
+import (
+	"blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// faultyStore fails writes or reads while the matching flag is set.
+type faultyStore struct {
+	blobmanager.BlobStore
+	failWrites bool
+	failReads  bool
+}
+
+var errUnavailable error = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func (f *faultyStore) Upload(ctx *context.Context, file blobmanager.File) error {
+	if f.failWrites {
+		return errUnavailable
+	}
+	return f.BlobStore.Upload(ctx, file)
+}
+
+func (f *faultyStore) Delete(ctx *context.Context, fileName string) error {
+	if f.failWrites {
+		return errUnavailable
+	}
+	return f.BlobStore.Delete(ctx, fileName)
+}
+
+func (f *faultyStore) Download(ctx *context.Context, fileName string) (blobmanager.File, error) {
+	if f.failReads {
+		return nil, errUnavailable
+	}
+	return f.BlobStore.Download(ctx, fileName)
+}
+
+func TestReplicatedBlobStore_Upload(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name        string
+		consistency blobmanager.ConsistencyMode
+		failing     []int
+		wantErr     bool
+		wantRepairs int
+	}{
+		{name: "all healthy", consistency: blobmanager.ConsistencyAll},
+		{name: "all with failed replica", consistency: blobmanager.ConsistencyAll, failing: []int{2},
+			wantErr: true},
+		{name: "quorum with failed replica", consistency: blobmanager.ConsistencyQuorum, failing: []int{2},
+			wantRepairs: 1},
+		{name: "quorum lost", consistency: blobmanager.ConsistencyQuorum, failing: []int{0, 1},
+			wantErr: true},
+		{name: "every replica failed", consistency: blobmanager.ConsistencyQuorum, failing: []int{0, 1, 2},
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := []*faultyStore{
+				{BlobStore: newLocalStore(t)}, {BlobStore: newLocalStore(t)}, {BlobStore: newLocalStore(t)}}
+			for _, index := range tt.failing {
+				stores[index].failWrites = true
+			}
+			queue := blobmanager.NewMemoryRepairQueue()
+			replicated := newReplicatedStore(t, tt.consistency, queue, stores)
+
+			err := replicated.Upload(&ctx, getFile("avatar", []byte("profile picture"), "image/png"))
+			var replicationError *common.ReplicationError
+			if (err != nil) != tt.wantErr || (tt.wantErr && !errors.As(err, &replicationError)) {
+				t.Fatalf("Upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if queue.Len() != tt.wantRepairs {
+				t.Fatalf("repair queue length = %d, want %d", queue.Len(), tt.wantRepairs)
+			}
+
+			for _, store := range stores {
+				store.failWrites = false
+			}
+			repaired, err := replicated.Repair(&ctx)
+			if err != nil || repaired != tt.wantRepairs {
+				t.Fatalf("Repair() = %d, %v, want %d", repaired, err, tt.wantRepairs)
+			}
+			if tt.wantErr {
+				// a failed write isn't completed behind the caller's back
+				for _, index := range tt.failing {
+					if exists, _ := stores[index].Exists(&ctx, "avatar"); exists {
+						t.Errorf("store %d has the object of a failed Upload() after Repair()", index)
+					}
+				}
+				return
+			}
+			for index, store := range stores {
+				if exists, _ := store.Exists(&ctx, "avatar"); !exists {
+					t.Errorf("store %d is missing the object after Repair()", index)
+				}
+			}
+		})
+	}
+}
+
+func TestReplicatedBlobStore_DownloadFallback(t *testing.T) {
+	var ctx = context.Background()
+	primary := &faultyStore{BlobStore: newLocalStore(t)}
+	secondary := &faultyStore{BlobStore: newLocalStore(t)}
+	replicated := newReplicatedStore(t, blobmanager.ConsistencyQuorum, nil, []*faultyStore{primary, secondary})
+
+	if err := secondary.Upload(&ctx, getFile("only-secondary", []byte("secondary"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if err := replicated.Upload(&ctx, getFile("both", []byte("replicated"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		fileName    string
+		primaryDown bool
+		want        string
+		wantErr     bool
+		notFound    bool
+	}{
+		{name: "primary unavailable", fileName: "both", primaryDown: true, want: "replicated"},
+		{name: "missing on primary", fileName: "only-secondary", want: "secondary"},
+		{name: "missing everywhere", fileName: "missing", wantErr: true, notFound: true},
+		{name: "missing with primary unavailable", fileName: "missing", primaryDown: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary.failReads = tt.primaryDown
+			got, err := replicated.Download(&ctx, tt.fileName)
+			if tt.wantErr {
+				var notFound *common.ObjectNotFound
+				if err == nil || errors.As(err, &notFound) != tt.notFound {
+					t.Errorf("Download() error = %v, want ObjectNotFound %v", err, tt.notFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			defer got.Close()
+			if content, _ := io.ReadAll(got); string(content) != tt.want {
+				t.Errorf("Download() got = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplicatedBlobStore_Delete(t *testing.T) {
+	var ctx = context.Background()
+	primary := &faultyStore{BlobStore: newLocalStore(t)}
+	secondary := &faultyStore{BlobStore: newLocalStore(t)}
+	queue := blobmanager.NewMemoryRepairQueue()
+	replicated := newReplicatedStore(t, blobmanager.ConsistencyAll, queue, []*faultyStore{primary, secondary})
+
+	if err := primary.Upload(&ctx, getFile("avatar", []byte("primary only"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if err := replicated.Delete(&ctx, "avatar"); err != nil {
+		t.Fatalf("Delete() error = %v, want replicas without the object to count as deleted", err)
+	}
+
+	var notFound *common.ObjectNotFound
+	if err := replicated.Delete(&ctx, "avatar"); !errors.As(err, &notFound) {
+		t.Errorf("Delete() error = %v, want ObjectNotFound", err)
+	}
+
+	if err := replicated.Upload(&ctx, getFile("avatar", []byte("replicated"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	secondary.failWrites = true
+	if err := replicated.Delete(&ctx, "avatar"); err == nil {
+		t.Fatalf("Delete() error = nil, want error with ConsistencyAll")
+	}
+	secondary.failWrites = false
+	if repaired, err := replicated.Repair(&ctx); err != nil || repaired != 0 {
+		t.Fatalf("Repair() = %d, %v, want a failed Delete() not to be repaired", repaired, err)
+	}
+}
+
+func TestReplicatedBlobStore_RepairDelete(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name       string
+		reupload   bool
+		wantExists bool
+	}{
+		{name: "deleted", reupload: false, wantExists: false},
+		{name: "uploaded again since", reupload: true, wantExists: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := []*faultyStore{
+				{BlobStore: newLocalStore(t)}, {BlobStore: newLocalStore(t)}, {BlobStore: newLocalStore(t)}}
+			queue := blobmanager.NewMemoryRepairQueue()
+			replicated := newReplicatedStore(t, blobmanager.ConsistencyQuorum, queue, stores)
+			if err := replicated.Upload(&ctx, getFile("avatar", []byte("old"), "image/png")); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+			stores[2].failWrites = true
+			if err := replicated.Delete(&ctx, "avatar"); err != nil || queue.Len() != 1 {
+				t.Fatalf("Delete() error = %v with %d repairs queued, want 1", err, queue.Len())
+			}
+			stores[2].failWrites = false
+			if tt.reupload {
+				if err := replicated.Upload(&ctx, getFile("avatar", []byte("new"), "image/png")); err != nil {
+					t.Fatalf("Upload() error = %v", err)
+				}
+			}
+
+			if _, err := replicated.Repair(&ctx); err != nil {
+				t.Fatalf("Repair() error = %v", err)
+			}
+			if exists, _ := stores[2].Exists(&ctx, "avatar"); exists != tt.wantExists {
+				t.Errorf("store 2 has the object = %v after Repair(), want %v", exists, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestReplicatedBlobStore_RepairDeadLetter(t *testing.T) {
+	var ctx = context.Background()
+	stores := []*faultyStore{
+		{BlobStore: newLocalStore(t)}, {BlobStore: newLocalStore(t)}, {BlobStore: newLocalStore(t)}}
+	stores[2].failWrites = true
+	queue := blobmanager.NewMemoryRepairQueue()
+	replicated := newReplicatedStore(t, blobmanager.ConsistencyQuorum, queue, stores)
+	file, closed := getClosableFile("avatar", []byte("profile picture"), "image/png")
+	if err := replicated.Upload(&ctx, file); err != nil || !closed() {
+		t.Fatalf("Upload() error = %v, closed the file = %v", err, closed())
+	}
+
+	for attempt := 1; attempt <= blobmanager.DefaultRepairAttempts; attempt++ {
+		if repaired, err := replicated.Repair(&ctx); err != nil || repaired != 0 {
+			t.Fatalf("Repair() = %d, %v, want the repair to fail", repaired, err)
+		}
+	}
+	deadLetters := queue.DeadLetters()
+	if queue.Len() != 0 || len(deadLetters) != 1 || deadLetters[0].Attempts != blobmanager.DefaultRepairAttempts {
+		t.Errorf("after %d failed repairs %d are queued and %v dead-lettered, want one dead letter",
+			blobmanager.DefaultRepairAttempts, queue.Len(), deadLetters)
+	}
+}
+
+func TestMemoryRepairQueue_Full(t *testing.T) {
+	queue := blobmanager.NewMemoryRepairQueue()
+	for i := 0; i < blobmanager.DefaultRepairQueueSize; i++ {
+		if err := queue.Enqueue(&blobmanager.RepairTask{FileName: "avatar"}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if err := queue.Enqueue(&blobmanager.RepairTask{FileName: "avatar"}); err == nil {
+		t.Errorf("Enqueue() on a full queue error = nil")
+	}
+}
+
+func newReplicatedStore(t *testing.T, consistency blobmanager.ConsistencyMode,
+	queue blobmanager.RepairQueue, stores []*faultyStore) *blobmanager.ReplicatedBlobStore {
+	var blobStores []blobmanager.BlobStore
+	for _, store := range stores {
+		blobStores = append(blobStores, store)
+	}
+	replicated, err := blobmanager.CreateReplicatedBlobStore(consistency, queue, blobStores...)
+	if err != nil {
+		t.Fatalf("CreateReplicatedBlobStore() error = %v", err)
+	}
+	return replicated
+}
@@ -0,0 +1,189 @@
+package test
+
+import (
+	"blob-manager"
+	common "blob-manager/common"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"google.golang.org/api/googleapi"
+	"io"
+	"testing"
+	"time"
+)
+
+// flakyStore fails the first failures calls to Upload and Download with err.
+type flakyStore struct {
+	blobmanager.BlobStore
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyStore) fail() error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyStore) Upload(ctx *context.Context, file blobmanager.File) error {
+	if err := f.fail(); err != nil {
+		file.Close()
+		return err
+	}
+	return f.BlobStore.Upload(ctx, file)
+}
+
+func (f *flakyStore) Download(ctx *context.Context, fileName string) (blobmanager.File, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return f.BlobStore.Download(ctx, fileName)
+}
+
+func TestRetryingBlobStore_Upload(t *testing.T) {
+	var ctx = context.Background()
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		maxBuffered int64
+		wantErr     bool
+		wantCalls   int
+		wantRetries int
+	}{
+		{name: "no failure", wantCalls: 1},
+		{name: "recovers", failures: 2, err: errUnavailable, wantCalls: 3, wantRetries: 2},
+		{name: "out of attempts", failures: 3, err: errUnavailable, wantErr: true, wantCalls: 3, wantRetries: 2},
+		{name: "not retryable", failures: 1, err: &common.EncryptionError{Message: "bad key"}, wantErr: true,
+			wantCalls: 1},
+		{name: "streamed", maxBuffered: 4, wantCalls: 1},
+		{name: "streamed isn't retried", failures: 1, err: errUnavailable, maxBuffered: 4, wantErr: true,
+			wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyStore{BlobStore: newLocalStore(t), failures: tt.failures, err: tt.err}
+			var attempts []*blobmanager.RetryAttempt
+			retrying := blobmanager.CreateRetryingBlobStore(flaky, &blobmanager.RetryPolicy{
+				MaxAttempts:     3,
+				InitialBackoff:  time.Millisecond,
+				MaxBackoff:      5 * time.Millisecond,
+				MaxBufferedSize: tt.maxBuffered,
+				OnRetry: func(attempt *blobmanager.RetryAttempt) {
+					attempts = append(attempts, attempt)
+				},
+			})
+
+			err := retrying.Upload(&ctx, getFile("avatar", []byte("profile picture"), "image/png"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if flaky.calls != tt.wantCalls || len(attempts) != tt.wantRetries {
+				t.Errorf("Upload() calls = %d, retries = %d, want %d, %d", flaky.calls, len(attempts),
+					tt.wantCalls, tt.wantRetries)
+			}
+			for index, attempt := range attempts {
+				if attempt.Attempt != index+1 || attempt.Operation != "upload" || attempt.FileName != "avatar" ||
+					attempt.Backoff > 5*time.Millisecond {
+					t.Errorf("OnRetry() got = %+v", attempt)
+				}
+			}
+			if tt.wantErr {
+				return
+			}
+			file, err := flaky.BlobStore.Download(&ctx, "avatar")
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			defer file.Close()
+			if content, _ := io.ReadAll(file); string(content) != "profile picture" {
+				t.Errorf("Download() got = %q", content)
+			}
+		})
+	}
+}
+
+func TestRetryingBlobStore_Download(t *testing.T) {
+	var ctx = context.Background()
+	flaky := &flakyStore{BlobStore: newLocalStore(t), failures: 1, err: errUnavailable}
+	if err := flaky.BlobStore.Upload(&ctx, getFile("avatar", []byte("profile picture"), "image/png")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	retrying := blobmanager.CreateRetryingBlobStore(flaky, &blobmanager.RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		AttemptTimeout: time.Second,
+	})
+
+	file, err := retrying.Download(&ctx, "avatar")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	content, _ := io.ReadAll(file)
+	file.Close()
+	if string(content) != "profile picture" || file.Type() != "image/png" {
+		t.Errorf("Download() got = %q (%s)", content, file.Type())
+	}
+
+	var notFound *common.ObjectNotFound
+	flaky.calls, flaky.failures = 0, 0
+	if _, err := retrying.Download(&ctx, "missing"); !errors.As(err, &notFound) || flaky.calls != 1 {
+		t.Errorf("Download() missing error = %v after %d calls, want ObjectNotFound after 1", err, flaky.calls)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "network failure", err: errUnavailable, want: true},
+		{name: "attempt timeout", err: fmt.Errorf("download: %w", context.DeadlineExceeded), want: true},
+		{name: "s3 server error", err: awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, ""),
+			want: true},
+		{name: "s3 throttled", err: awserr.NewRequestFailure(awserr.New("SlowDown", "", nil), 503, ""), want: true},
+		{name: "s3 request error", err: awserr.New("RequestError", "send request failed", nil), want: true},
+		{name: "s3 access denied", err: awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, ""),
+			want: false},
+		{name: "gcs rate limited", err: &googleapi.Error{Code: 429}, want: true},
+		{name: "gcs precondition failed", err: &googleapi.Error{Code: 412}, want: false},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "not found", err: &common.ObjectNotFound{ObjectId: "avatar"}, want: false},
+		{name: "unknown", err: errors.New("invalid bucket name"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blobmanager.IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryingBlobStore_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	flaky := &flakyStore{BlobStore: newLocalStore(t), failures: 5, err: errUnavailable}
+	retrying := blobmanager.CreateRetryingBlobStore(flaky, &blobmanager.RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Hour,
+		OnRetry: func(attempt *blobmanager.RetryAttempt) {
+			cancel()
+		},
+	})
+
+	start := time.Now()
+	if _, err := retrying.Download(&ctx, "avatar"); !errors.Is(err, errUnavailable) {
+		t.Errorf("Download() error = %v, want %v", err, errUnavailable)
+	}
+	if flaky.calls != 1 || time.Since(start) > time.Minute {
+		t.Errorf("Download() kept retrying after cancel, calls = %d", flaky.calls)
+	}
+	if _, err := newLocalStore(t).Stat(&ctx, "avatar"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Stat() with cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,59 @@
+package blobmanager
+
+import (
+	common "blob-manager/common"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// UsageStore tracks the bytes stored per owner, along with the size of each
+// of their objects, so that replacing an object is accounted in one step.
+type UsageStore interface {
+	Get(ctx *context.Context, owner string) (int64, error)
+	// Set records size bytes for the object fileName of owner in place of
+	// what was recorded for it, a size of 0 removes it, and returns the
+	// previous size. A change that would take usage above limit fails with a
+	// QuotaExceededError and changes nothing, a limit of 0 is unlimited.
+	Set(ctx *context.Context, owner string, fileName string, size int64, limit int64) (int64, error)
+}
+
+// MemoryUsageStore keeps usage in process, it is lost on restart.
+type MemoryUsageStore struct {
+	mutex   sync.Mutex
+	usage   map[string]int64
+	objects map[string]map[string]int64
+}
+
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{usage: map[string]int64{}, objects: map[string]map[string]int64{}}
+}
+
+func (m *MemoryUsageStore) Get(ctx *context.Context, owner string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.usage[owner], nil
+}
+
+func (m *MemoryUsageStore) Set(ctx *context.Context, owner string, fileName string,
+	size int64, limit int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	previous := m.objects[owner][fileName]
+	delta := size - previous
+	if delta > 0 && limit > 0 && m.usage[owner]+delta > limit {
+		return previous, &common.QuotaExceededError{
+			Owner:   owner,
+			Message: fmt.Sprintf("%d of %d bytes used, %d more requested", m.usage[owner], limit, delta)}
+	}
+	if m.objects[owner] == nil {
+		m.objects[owner] = map[string]int64{}
+	}
+	if size > 0 {
+		m.objects[owner][fileName] = size
+	} else {
+		delete(m.objects[owner], fileName)
+	}
+	m.usage[owner] = max(0, m.usage[owner]+delta)
+	return previous, nil
+}
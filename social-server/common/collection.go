@@ -3,3 +3,6 @@ package common
 const (
 	UsersCollection = "users-collection"
 )
+
+// TokenIntrospectScope is the scope user-server requires to introspect tokens.
+const TokenIntrospectScope = "tokens:introspect"
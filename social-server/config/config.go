@@ -14,6 +14,27 @@ type ServerConfig struct {
 	ServerPort  int
 	MongoConfig *mongodb.MongoConfig
 	SecretKey   string
+	// JwksUrl is user-server's key set, tokens are verified with the shared
+	// SecretKey when it's empty.
+	JwksUrl string
+	// JwtIssuer and JwtAudience are required of tokens when set, JwtLeeway
+	// is the clock skew allowed in seconds.
+	JwtIssuer   string
+	JwtAudience string
+	JwtLeeway   int
+	// TokenFormat is "jwt", "paseto-public", verified with the keys at
+	// JwksUrl, or "paseto-local", decrypted with the base64 PasetoLocalKey.
+	// paseto-local tokens are verified without scopes and never as service
+	// tokens, any holder of the key can mint them.
+	TokenFormat    string
+	PasetoLocalKey string
+	// IntrospectionUrl is user-server's introspection endpoint, when set
+	// every token is also checked there so revoked tokens are rejected. It's
+	// called with service tokens of ClientId from ServiceTokenUrl.
+	IntrospectionUrl string
+	ServiceTokenUrl  string
+	ClientId         string
+	ClientSecret     string
 }
 
 var Configuration *ServerConfig
@@ -44,6 +65,25 @@ func loadConfig() {
 			Username:         os.Getenv("DB_USER"),
 			Password:         os.Getenv("DB_PASSWORD"),
 		},
-		SecretKey: os.Getenv("SECRET_KEY"),
+		SecretKey:      os.Getenv("SECRET_KEY"),
+		JwksUrl:        os.Getenv("JWKS_URL"),
+		JwtIssuer:      os.Getenv("JWT_ISSUER"),
+		JwtAudience:    os.Getenv("JWT_AUDIENCE"),
+		JwtLeeway:      getInt("JWT_LEEWAY_SECONDS", 0),
+		TokenFormat:    os.Getenv("TOKEN_FORMAT"),
+		PasetoLocalKey: os.Getenv("PASETO_LOCAL_KEY"),
+
+		IntrospectionUrl: os.Getenv("INTROSPECTION_URL"),
+		ServiceTokenUrl:  os.Getenv("SERVICE_TOKEN_URL"),
+		ClientId:         os.Getenv("SERVICE_CLIENT_ID"),
+		ClientSecret:     os.Getenv("SERVICE_CLIENT_SECRET"),
+	}
+}
+
+func getInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
 	}
+	return value
 }
@@ -8,6 +8,8 @@ import (
 	"social-server/user/db"
 	"social-server/user/handlers"
 	"social-server/user/service"
+	"time"
+	token "token-manager"
 	"user-server/auth"
 )
 
@@ -22,10 +24,54 @@ func LoadHandlers(router *gin.Engine) {
 	userDb := db.NewMongoUserStore(collection)
 	manager := service.NewUserService(userDb)
 	handler = handlers.NewUserHandler(manager)
-	authHandler = auth.NewAuthHandler(config.Configuration.SecretKey)
+	authHandler = auth.NewAuthHandler(getIntrospectingVerifier(getTokenVerifier()))
 	loadRoutes(router)
 }
 
+// getIntrospectingVerifier checks tokens against user-server's revocations
+// when IntrospectionUrl is set, without it a revoked token is accepted until
+// it expires.
+func getIntrospectingVerifier(verifier token.TokenVerifier) token.TokenVerifier {
+	if len(config.Configuration.IntrospectionUrl) == 0 {
+		return verifier
+	}
+	if len(config.Configuration.ServiceTokenUrl) == 0 || len(config.Configuration.ClientId) == 0 {
+		log.Fatalf("INTROSPECTION_URL is called with service tokens, SERVICE_TOKEN_URL and SERVICE_CLIENT_ID must be set")
+	}
+	credentials := token.NewClientCredentials(config.Configuration.ServiceTokenUrl, config.Configuration.ClientId,
+		config.Configuration.ClientSecret, common.TokenIntrospectScope)
+	return token.NewIntrospectionVerifier(verifier, config.Configuration.IntrospectionUrl, credentials)
+}
+
+func getTokenVerifier() token.TokenVerifier {
+	options := &token.VerifyOptions{
+		Issuer:   config.Configuration.JwtIssuer,
+		Audience: config.Configuration.JwtAudience,
+		Leeway:   time.Duration(config.Configuration.JwtLeeway) * time.Second,
+	}
+	switch config.Configuration.TokenFormat {
+	case "paseto-public":
+		if len(config.Configuration.JwksUrl) == 0 {
+			log.Fatalf("paseto-public tokens are verified with the keys at JWKS_URL, it's not set")
+		}
+		return token.NewPasetoPublicTokenVerifier(token.NewRemoteKeySet(config.Configuration.JwksUrl), options)
+	case "paseto-local":
+		verifier, err := token.NewPasetoLocalTokenManager(config.Configuration.PasetoLocalKey, options)
+		if err != nil {
+			log.Fatalf("Error loading paseto local key, reason: %v", err)
+		}
+		return verifier
+	}
+	if len(config.Configuration.JwksUrl) == 0 {
+		keySet, err := token.NewKeySet("", token.NewSecretKey("", config.Configuration.SecretKey))
+		if err != nil {
+			log.Fatalf("tokens are verified with SECRET_KEY when JWKS_URL is not set, reason: %v", err)
+		}
+		return token.NewKeySetTokenManager(keySet, options)
+	}
+	return token.NewJwtTokenVerifier(token.NewRemoteKeySet(config.Configuration.JwksUrl), options)
+}
+
 func loadRoutes(router *gin.Engine) {
 	group := router.Group("/api/v1/social")
 	group.Use(authHandler.Handle())
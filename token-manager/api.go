@@ -1,10 +1,17 @@
 package token_manager
 
 import (
-	"encoding/base64"
+	"strings"
 	"time"
 )
 
+// Kinds of tokens, SERVICE tokens identify a service rather than a user and
+// carry no user id.
+const (
+	KindUser    = "USER"
+	KindService = "SERVICE"
+)
+
 type TokenClaims struct {
 	UserId    string
 	EmailId   string
@@ -12,9 +19,36 @@ type TokenClaims struct {
 	App       string
 	IAT       *time.Time
 	EXP       *time.Time
+	NBF       *time.Time
 	Kind      string
 	Sub       string
 	JTI       string
+	Issuer    string
+	Audience  []string
+	// Scopes are the permissions granted to the token, e.g. "endpoints:write"
+	Scopes []string
+}
+
+// HasScopes reports whether the token was granted every one of scopes.
+func (t *TokenClaims) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		granted := false
+		for _, tokenScope := range t.Scopes {
+			if tokenScope == scope {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return false
+		}
+	}
+	return true
+}
+
+// scopeClaim joins scopes into the space separated "scope" claim of OAuth 2.0.
+func scopeClaim(scopes []string) string {
+	return strings.Join(scopes, " ")
 }
 
 type TokenManager interface {
@@ -26,13 +60,45 @@ type TokenVerifier interface {
 	Verify(token string) (*TokenClaims, error)
 }
 
+// JwtTokenManager signs with the signing key of its key set and verifies
+// tokens signed by any key in it.
 type JwtTokenManager struct {
-	secretKey []byte
+	keySet  *KeySet
+	options *VerifyOptions
+}
+
+// NewJwtTokenManager signs with HS512 and a shared secret, its tokens carry
+// no key id. It fails when the secret isn't a non-empty base64 key.
+func NewJwtTokenManager(secretKeyBase64 string) (*JwtTokenManager, error) {
+	keySet, err := NewKeySet("", NewSecretKey("", secretKeyBase64))
+	if err != nil {
+		return nil, err
+	}
+	return &JwtTokenManager{
+		keySet:  keySet,
+		options: verifyOptions(nil),
+	}, nil
 }
 
-func NewJwtTokenManager(secretKeyBase64 string) *JwtTokenManager {
-	keyBytes, _ := base64.StdEncoding.DecodeString(secretKeyBase64)
+// NewKeySetTokenManager verifies with options, nil accepts any token signed
+// by a key of the key set.
+func NewKeySetTokenManager(keySet *KeySet, options *VerifyOptions) *JwtTokenManager {
 	return &JwtTokenManager{
-		secretKey: keyBytes,
+		keySet:  keySet,
+		options: verifyOptions(options),
+	}
+}
+
+// JwtTokenVerifier verifies tokens without being able to sign them, e.g. with
+// the keys another service publishes as a RemoteKeySet.
+type JwtTokenVerifier struct {
+	resolver KeyResolver
+	options  *VerifyOptions
+}
+
+func NewJwtTokenVerifier(resolver KeyResolver, options *VerifyOptions) *JwtTokenVerifier {
+	return &JwtTokenVerifier{
+		resolver: resolver,
+		options:  verifyOptions(options),
 	}
 }
@@ -0,0 +1,132 @@
+package token_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clientTokenRenewal is how long before it expires a service token is
+	// fetched again, so it doesn't expire while a request is in flight.
+	clientTokenRenewal = 30 * time.Second
+	// a failed fetch is retried after clientFetchBackoff, doubled with every
+	// failure up to clientFetchMaxBackoff
+	clientFetchBackoff    = time.Second
+	clientFetchMaxBackoff = time.Minute
+)
+
+// ClientCredentials fetches service tokens from an OAuth 2.0 token endpoint
+// with the client credentials grant, and caches each one until shortly
+// before it expires. After a failed fetch, Token returns its error until the
+// backoff passed instead of asking the endpoint again.
+type ClientCredentials struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	scopes       []string
+	client       *http.Client
+	mu           sync.Mutex
+	token        string
+	expiresAt    time.Time
+	failures     int
+	fetchErr     error
+	retryAt      time.Time
+}
+
+// NewClientCredentials requests tokens with scopes, or with every scope of
+// the client when none are given.
+func NewClientCredentials(tokenUrl string, clientId string, clientSecret string,
+	scopes ...string) *ClientCredentials {
+	return &ClientCredentials{
+		tokenUrl:     tokenUrl,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Token returns the cached service token, or fetches a new one when it's
+// about to expire.
+func (c *ClientCredentials) Token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.token) > 0 && now.Before(c.expiresAt) {
+		return c.token, nil
+	}
+	if now.Before(c.retryAt) {
+		return "", c.fetchErr
+	}
+	if err := c.fetch(); err != nil {
+		c.failures++
+		c.fetchErr = err
+		c.retryAt = now.Add(min(clientFetchMaxBackoff, clientFetchBackoff<<min(c.failures-1, 6)))
+		return "", err
+	}
+	c.failures, c.fetchErr, c.retryAt = 0, nil, time.Time{}
+	return c.token, nil
+}
+
+// Invalidate drops serviceToken from the cache when a service rejected it,
+// e.g. because it was revoked, so the next Token fetches a new one.
+func (c *ClientCredentials) Invalidate(serviceToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == serviceToken {
+		c.token = ""
+	}
+}
+
+// Authorize sets the bearer token of request to a service token.
+func (c *ClientCredentials) Authorize(request *http.Request) error {
+	serviceToken, err := c.Token()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+serviceToken)
+	return nil
+}
+
+func (c *ClientCredentials) fetch() error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) > 0 {
+		form.Set("scope", scopeClaim(c.scopes))
+	}
+	request, err := http.NewRequest(http.MethodPost, c.tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(c.clientId), url.QueryEscape(c.clientSecret))
+
+	requestedAt := time.Now()
+	response, err := c.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to fetch service token, reason: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch service token, status: %d", response.StatusCode)
+	}
+	var issued struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&issued); err != nil {
+		return fmt.Errorf("failed to decode service token, reason: %w", err)
+	}
+	if len(issued.AccessToken) == 0 {
+		return fmt.Errorf("token endpoint returned no service token")
+	}
+	// a token shorter lived than the renewal margin is renewed halfway
+	lifetime := time.Duration(issued.ExpiresIn) * time.Second
+	c.token = issued.AccessToken
+	c.expiresAt = requestedAt.Add(lifetime - min(clientTokenRenewal, lifetime/2))
+	return nil
+}
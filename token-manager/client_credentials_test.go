@@ -0,0 +1,106 @@
+package token_manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientCredentials_Token(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		clientId, secret, ok := r.BasicAuth()
+		if !ok || clientId != "client-1" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "a b" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		expiresIn := 300
+		switch r.URL.Path {
+		case "/short":
+			expiresIn = 10
+		case "/expired":
+			expiresIn = 0
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token-" + string(rune('0'+requests)),
+			"token_type":   "Bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		secret       string
+		wantRequests int
+		wantErr      bool
+	}{
+		{name: "cached until it expires", path: "/", secret: "secret", wantRequests: 1},
+		{name: "short lived token cached until halfway", path: "/short", secret: "secret", wantRequests: 1},
+		{name: "fetched again when expired", path: "/expired", secret: "secret", wantRequests: 2},
+		{name: "invalid credentials backed off", path: "/", secret: "wrong", wantRequests: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			credentials := NewClientCredentials(server.URL+tt.path, "client-1", tt.secret, "a", "b")
+			for i := 0; i < 2; i++ {
+				request, _ := http.NewRequest(http.MethodGet, "http://service", nil)
+				err := credentials.Authorize(request)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Authorize() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err == nil && request.Header.Get("Authorization") != "Bearer token-"+string(rune('0'+requests)) {
+					t.Errorf("Authorize() header = %s", request.Header.Get("Authorization"))
+				}
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("token endpoint requested %d times, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestClientCredentials_Backoff(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 300})
+	}))
+	defer server.Close()
+
+	credentials := NewClientCredentials(server.URL, "client-1", "secret")
+	var backoffs []time.Duration
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		for j := 0; j < 3; j++ {
+			credentials.Token()
+		}
+		credentials.mu.Lock()
+		backoffs = append(backoffs, credentials.retryAt.Sub(start))
+		// skip the backoff
+		credentials.retryAt = time.Time{}
+		credentials.mu.Unlock()
+	}
+	if requests != 3 {
+		t.Errorf("token endpoint requested %d times, want once per backoff", requests)
+	}
+	if backoffs[0] < clientFetchBackoff || backoffs[1] < 2*clientFetchBackoff || backoffs[2] > 0 {
+		t.Errorf("backoffs = %v, want doubled after each failure and reset by a fetched token", backoffs)
+	}
+	if serviceToken, err := credentials.Token(); err != nil || serviceToken != "token" {
+		t.Errorf("Token() = %s, %v", serviceToken, err)
+	}
+}
@@ -1,5 +1,10 @@
 package token_manager
 
+import "fmt"
+
+// InvalidTokenError is the cause of every verification failure, the errors
+// below unwrap to it so errors.Is(err, &InvalidTokenError{}) matches all of
+// them.
 type InvalidTokenError struct {
 }
 
@@ -13,10 +18,160 @@ func (t *TokenExpiryError) Error() string {
 	return "token is expired"
 }
 
+func (t *TokenExpiryError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
 func (e *InvalidTokenError) Error() string {
 	return "token is not valid"
 }
 
+func (e *InvalidTokenError) Is(target error) bool {
+	_, ok := target.(*InvalidTokenError)
+	return ok
+}
+
 func (e *TokenDecodeError) Error() string {
 	return "failed to decode token"
 }
+
+func (e *TokenDecodeError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+type UnknownKeyError struct {
+	KeyId string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return "unknown signing key with id: " + e.KeyId
+}
+
+func (e *UnknownKeyError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+type TokenNotYetValidError struct {
+}
+
+func (e *TokenNotYetValidError) Error() string {
+	return "token is not valid yet"
+}
+
+func (e *TokenNotYetValidError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+type MalformedTokenError struct {
+}
+
+func (e *MalformedTokenError) Error() string {
+	return "token is malformed"
+}
+
+func (e *MalformedTokenError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+type InvalidSignatureError struct {
+}
+
+func (e *InvalidSignatureError) Error() string {
+	return "token signature is not valid"
+}
+
+func (e *InvalidSignatureError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+// InvalidAlgorithmError is a token signed with an algorithm that isn't
+// allowed, or that isn't the algorithm of the key it names.
+type InvalidAlgorithmError struct {
+	Algorithm string
+}
+
+func (e *InvalidAlgorithmError) Error() string {
+	return fmt.Sprintf("token algorithm: %q is not allowed", e.Algorithm)
+}
+
+func (e *InvalidAlgorithmError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+type InvalidIssuerError struct {
+	Issuer string
+}
+
+func (e *InvalidIssuerError) Error() string {
+	return fmt.Sprintf("token issuer: %q is not accepted", e.Issuer)
+}
+
+func (e *InvalidIssuerError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+type InvalidAudienceError struct {
+	Audience []string
+}
+
+func (e *InvalidAudienceError) Error() string {
+	return fmt.Sprintf("token audience: %q is not accepted", e.Audience)
+}
+
+func (e *InvalidAudienceError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+type MissingClaimError struct {
+	Claim string
+}
+
+func (e *MissingClaimError) Error() string {
+	return "token is missing claim: " + e.Claim
+}
+
+func (e *MissingClaimError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+// KeySetUnavailableError is a key set that couldn't be fetched to verify a
+// token with. The token may well be valid, so it doesn't unwrap to
+// InvalidTokenError.
+type KeySetUnavailableError struct {
+	Reason error
+}
+
+func (e *KeySetUnavailableError) Error() string {
+	return "key set is unavailable, reason: " + e.Reason.Error()
+}
+
+func (e *KeySetUnavailableError) Unwrap() error {
+	return e.Reason
+}
+
+// InactiveTokenError is a token its issuer no longer reports as active, e.g.
+// because it was revoked.
+type InactiveTokenError struct {
+}
+
+func (e *InactiveTokenError) Error() string {
+	return "token is not active"
+}
+
+func (e *InactiveTokenError) Unwrap() error {
+	return &InvalidTokenError{}
+}
+
+// IntrospectionError is an introspection endpoint that couldn't be asked
+// whether a token is active, it doesn't unwrap to InvalidTokenError either.
+type IntrospectionError struct {
+	Reason error
+}
+
+func (e *IntrospectionError) Error() string {
+	return "failed to introspect token, reason: " + e.Reason.Error()
+}
+
+func (e *IntrospectionError) Unwrap() error {
+	return e.Reason
+}
@@ -1,14 +1,26 @@
 package token_manager
 
 import (
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"github.com/dgrijalva/jwt-go"
 )
 
+// Generate signs claims, a random JTI is assigned to claims when it has none
+// so that the token can be revoked on its own.
 func (j *JwtTokenManager) Generate(claims *TokenClaims) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS512)
-	setClaims(claims, token)
-	tokenString, err := token.SignedString(j.secretKey)
+	if err := assignJTI(claims); err != nil {
+		return "", err
+	}
+	signingKey := j.keySet.signingKey()
+	token := jwt.New(signingKey.signingMethod())
+	if len(signingKey.KeyId) > 0 {
+		token.Header["kid"] = signingKey.KeyId
+	}
+	setClaims(claims, token.Claims.(jwt.MapClaims))
+	setPolicyClaims(claims, j.options, token.Claims.(jwt.MapClaims))
+	tokenString, err := token.SignedString(signingKey.SigningKey)
 	if err != nil {
 		return "", err
 	}
@@ -17,8 +29,7 @@ func (j *JwtTokenManager) Generate(claims *TokenClaims) (string, error) {
 	return base64.RawURLEncoding.EncodeToString([]byte(tokenString)), nil
 }
 
-func setClaims(tokenClaims *TokenClaims, token *jwt.Token) {
-	claims := token.Claims.(jwt.MapClaims)
+func setClaims(tokenClaims *TokenClaims, claims jwt.MapClaims) {
 	claims["iat"] = tokenClaims.IAT.Unix()
 	claims["exp"] = tokenClaims.EXP.Unix()
 	claims["authorized"] = true
@@ -29,7 +40,65 @@ func setClaims(tokenClaims *TokenClaims, token *jwt.Token) {
 	claims["kind"] = tokenClaims.Kind
 	// Added for compatibility
 	claims["machine_id"] = tokenClaims.MachineId
-	claims["jti"] = tokenClaims.App
+	claims["jti"] = tokenClaims.JTI
 	claims["sub"] = tokenClaims.Sub
 	claims["userId"] = tokenClaims.UserId
+	if tokenClaims.NBF != nil {
+		claims["nbf"] = tokenClaims.NBF.Unix()
+	}
+	if len(tokenClaims.Scopes) > 0 {
+		claims["scope"] = scopeClaim(tokenClaims.Scopes)
+	}
+}
+
+// setPolicyClaims names the issuer and audience of options, unless claims
+// name their own, so the token passes the manager's own verification.
+func setPolicyClaims(tokenClaims *TokenClaims, options *VerifyOptions, claims jwt.MapClaims) {
+	issuer := tokenClaims.Issuer
+	if len(issuer) == 0 {
+		issuer = options.Issuer
+	}
+	if len(issuer) > 0 {
+		claims["iss"] = issuer
+	}
+	audience := tokenClaims.Audience
+	if len(audience) == 0 && len(options.Audience) > 0 {
+		audience = []string{options.Audience}
+	}
+	switch len(audience) {
+	case 0:
+	case 1:
+		claims["aud"] = audience[0]
+	default:
+		claims["aud"] = audience
+	}
+}
+
+func assignJTI(claims *TokenClaims) error {
+	if len(claims.JTI) > 0 {
+		return nil
+	}
+	jti, err := NewJTI()
+	if err != nil {
+		return err
+	}
+	claims.JTI = jti
+	return nil
+}
+
+// NewJTI returns a random 128 bit token id.
+func NewJTI() (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(jti), nil
+}
+
+// IsJTI reports whether jti has the form of one returned by NewJTI. Tokens
+// issued before token ids were random carry their app as jti, which every
+// token of the app shares.
+func IsJTI(jti string) bool {
+	decoded, err := hex.DecodeString(jti)
+	return err == nil && len(decoded) == 16
 }
@@ -45,7 +45,10 @@ func TestJwtTokenManager_Generate(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			j := NewJwtTokenManager(tt.fields.secretKey)
+			j, err := NewJwtTokenManager(tt.fields.secretKey)
+			if err != nil {
+				t.Fatalf("NewJwtTokenManager() error = %v", err)
+			}
 			got, err := j.Generate(tt.args.claims)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Generate() error = %v, wantErr %v", err, tt.wantErr)
@@ -57,3 +60,52 @@ func TestJwtTokenManager_Generate(t *testing.T) {
 		})
 	}
 }
+
+func TestJwtTokenManager_GenerateJTI(t *testing.T) {
+	manager, err := NewJwtTokenManager("c2VjcmV0")
+	if err != nil {
+		t.Fatalf("NewJwtTokenManager() error = %v", err)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		claims := testClaims()
+		apiToken, err := manager.Generate(claims)
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		verified, err := manager.Verify(apiToken)
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if !IsJTI(verified.JTI) || verified.JTI != claims.JTI || seen[verified.JTI] {
+			t.Errorf("Generate() jti = %q, want a new random jti", verified.JTI)
+		}
+		seen[verified.JTI] = true
+	}
+}
+
+func TestIsJTI(t *testing.T) {
+	tests := []struct {
+		jti  string
+		want bool
+	}{
+		{jti: "0123456789abcdef0123456789abcdef", want: true},
+		{jti: "test-app", want: false},
+		{jti: "0123456789abcdef", want: false},
+		{jti: "0123456789abcdef0123456789abcdeg", want: false},
+		{jti: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsJTI(tt.jti); got != tt.want {
+			t.Errorf("IsJTI(%q) = %v, want %v", tt.jti, got, tt.want)
+		}
+	}
+}
+
+func TestNewJwtTokenManager(t *testing.T) {
+	for _, secret := range []string{"", "not base64!", "c2VjcmV0!"} {
+		if manager, err := NewJwtTokenManager(secret); err == nil || manager != nil {
+			t.Errorf("NewJwtTokenManager(%q) = %v, %v, want an error", secret, manager, err)
+		}
+	}
+}
@@ -2,4 +2,9 @@ module token-manager
 
 go 1.22.1
 
-require github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
+require (
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	golang.org/x/crypto v0.23.0
+)
+
+require golang.org/x/sys v0.20.0 // indirect
@@ -0,0 +1,81 @@
+package token_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IntrospectionVerifier verifies tokens with verifier and then asks their
+// issuer's RFC 7662 introspection endpoint whether they are still active, so
+// revoked tokens are rejected before they expire. It authenticates to the
+// endpoint with service tokens of credentials.
+type IntrospectionVerifier struct {
+	verifier         TokenVerifier
+	introspectionUrl string
+	credentials      *ClientCredentials
+	client           *http.Client
+}
+
+func NewIntrospectionVerifier(verifier TokenVerifier, introspectionUrl string,
+	credentials *ClientCredentials) *IntrospectionVerifier {
+	return &IntrospectionVerifier{
+		verifier:         verifier,
+		introspectionUrl: introspectionUrl,
+		credentials:      credentials,
+		client:           &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify only introspects tokens that verify, an invalid token costs no
+// request.
+func (i *IntrospectionVerifier) Verify(apiToken string) (*TokenClaims, error) {
+	claims, err := i.verifier.Verify(apiToken)
+	if err != nil {
+		return nil, err
+	}
+	active, err := i.introspect(apiToken)
+	if err != nil {
+		return nil, &IntrospectionError{Reason: err}
+	}
+	if !active {
+		return nil, &InactiveTokenError{}
+	}
+	return claims, nil
+}
+
+func (i *IntrospectionVerifier) introspect(apiToken string) (bool, error) {
+	form := url.Values{"token": {apiToken}, "token_type_hint": {"access_token"}}
+	request, err := http.NewRequest(http.MethodPost, i.introspectionUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	serviceToken, err := i.credentials.Token()
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Authorization", "Bearer "+serviceToken)
+	response, err := i.client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusUnauthorized {
+		// the service token was revoked, the next introspection fetches another
+		i.credentials.Invalidate(serviceToken)
+	}
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("status: %d", response.StatusCode)
+	}
+	var introspection struct {
+		Active bool `json:"active"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&introspection); err != nil {
+		return false, fmt.Errorf("failed to decode introspection, reason: %w", err)
+	}
+	return introspection.Active, nil
+}
@@ -0,0 +1,99 @@
+package token_manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestIntrospectionVerifier_Verify(t *testing.T) {
+	manager, err := NewJwtTokenManager("c2VjcmV0")
+	if err != nil {
+		t.Fatalf("NewJwtTokenManager() error = %v", err)
+	}
+	active, _ := manager.Generate(testClaims())
+	revoked, _ := manager.Generate(testClaims())
+	var introspections int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "service-token", "expires_in": 300})
+		case "/introspect":
+			introspections++
+			if r.Header.Get("Authorization") != "Bearer service-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": r.FormValue("token") == active})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	credentials := NewClientCredentials(server.URL+"/token", "client-1", "secret")
+
+	tests := []struct {
+		name               string
+		path               string
+		apiToken           string
+		wantErr            error
+		wantIntrospections int
+	}{
+		{name: "active token", path: "/introspect", apiToken: active, wantIntrospections: 1},
+		{name: "revoked token", path: "/introspect", apiToken: revoked, wantErr: &InactiveTokenError{},
+			wantIntrospections: 1},
+		{name: "invalid token", path: "/introspect", apiToken: "invalid", wantErr: &MalformedTokenError{}},
+		{name: "introspection failure", path: "/failing", apiToken: active, wantErr: &IntrospectionError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			introspections = 0
+			verifier := NewIntrospectionVerifier(manager, server.URL+tt.path, credentials)
+			claims, err := verifier.Verify(tt.apiToken)
+			if tt.wantErr == nil && (err != nil || claims.UserId != "test-user") {
+				t.Errorf("Verify() = %v, %v, want the token's claims", claims, err)
+			}
+			if tt.wantErr != nil && reflect.TypeOf(err) != reflect.TypeOf(tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %T", err, tt.wantErr)
+			}
+			if introspections != tt.wantIntrospections {
+				t.Errorf("introspected %d times, want %d", introspections, tt.wantIntrospections)
+			}
+		})
+	}
+}
+
+func TestIntrospectionVerifier_RevokedServiceToken(t *testing.T) {
+	manager, err := NewJwtTokenManager("c2VjcmV0")
+	if err != nil {
+		t.Fatalf("NewJwtTokenManager() error = %v", err)
+	}
+	active, _ := manager.Generate(testClaims())
+	var fetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fetches++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "service-token-" + string(rune('0'+fetches)), "expires_in": 300})
+			return
+		}
+		// the first service token was revoked
+		if r.Header.Get("Authorization") != "Bearer service-token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer server.Close()
+	verifier := NewIntrospectionVerifier(manager, server.URL+"/introspect",
+		NewClientCredentials(server.URL+"/token", "client-1", "secret"))
+
+	if _, err := verifier.Verify(active); reflect.TypeOf(err) != reflect.TypeOf(&IntrospectionError{}) {
+		t.Errorf("Verify() with a revoked service token error = %v, want IntrospectionError", err)
+	}
+	if _, err := verifier.Verify(active); err != nil || fetches != 2 {
+		t.Errorf("Verify() error = %v after %d service token fetches, want a new service token", err, fetches)
+	}
+}
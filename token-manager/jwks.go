@@ -0,0 +1,218 @@
+package token_manager
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JWK is the public part of a key as published in a JSON Web Key Set.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the key set, ordered by key id.
+func (k *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{Keys: []*JWK{}}
+	for _, key := range k.PublicKeys() {
+		jwks.Keys = append(jwks.Keys, key.jwk())
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyId < jwks.Keys[j].KeyId
+	})
+	return jwks
+}
+
+func (k *Key) jwk() *JWK {
+	jwk := &JWK{KeyId: k.KeyId, Use: "sig", Algorithm: k.Algorithm}
+	switch publicKey := k.VerificationKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(publicKey.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType, jwk.Curve = "EC", "P-256"
+		jwk.X = encode(publicKey.X.FillBytes(make([]byte, 32)))
+		jwk.Y = encode(publicKey.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		jwk.KeyType, jwk.Curve = "OKP", "Ed25519"
+		jwk.X = encode(publicKey)
+	}
+	return jwk
+}
+
+// Key parses the public key of jwk.
+func (j *JWK) Key() (*Key, error) {
+	var publicKey interface{}
+	switch {
+	case j.KeyType == "RSA":
+		n, nErr := decode(j.N)
+		e, eErr := decode(j.E)
+		if nErr != nil || eErr != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key with id: %s", j.KeyId)
+		}
+		publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case j.KeyType == "EC" && j.Curve == "P-256":
+		x, xErr := decode(j.X)
+		y, yErr := decode(j.Y)
+		if xErr != nil || yErr != nil || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid EC key with id: %s", j.KeyId)
+		}
+		// ecdh rejects points that aren't on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid EC key with id: %s, reason: %w", j.KeyId, err)
+		}
+		publicKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case j.KeyType == "OKP" && j.Curve == "Ed25519":
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 key with id: %s", j.KeyId)
+		}
+		publicKey = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %q with id: %s", j.KeyType, j.KeyId)
+	}
+	key, err := NewPublicKey(j.KeyId, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(j.Algorithm) > 0 && j.Algorithm != key.Algorithm {
+		return nil, fmt.Errorf("algorithm: %q doesn't match key with id: %s", j.Algorithm, j.KeyId)
+	}
+	return key, nil
+}
+
+const (
+	jwksCacheDuration   = time.Hour
+	jwksRefreshInterval = time.Minute
+)
+
+// RemoteKeySet resolves keys from a JWKS endpoint. The keys are cached for an
+// hour and fetched again early when a token names an unknown key id, at most
+// once a minute, so newly rolled out keys are picked up. One fetch runs at a
+// time, outside the lock, and cached keys keep resolving while it does.
+type RemoteKeySet struct {
+	url       string
+	client    *http.Client
+	mu        sync.Mutex
+	keys      map[string]*Key
+	fetchedAt time.Time
+	fetching  *keyFetch
+}
+
+// keyFetch is a fetch in flight, done is closed once err is set.
+type keyFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (r *RemoteKeySet) Resolve(keyId string) (*Key, error) {
+	r.mu.Lock()
+	age := time.Since(r.fetchedAt)
+	key, ok := r.keys[keyId]
+	if ok && age < jwksCacheDuration || !ok && age < jwksRefreshInterval {
+		r.mu.Unlock()
+		return resolved(key, keyId)
+	}
+	fetch := r.fetching
+	if fetch == nil {
+		fetch = &keyFetch{done: make(chan struct{})}
+		r.fetching = fetch
+		go r.fetch(fetch)
+	}
+	r.mu.Unlock()
+	if ok {
+		// keep verifying with the cached key while the key set is fetched,
+		// or while the endpoint is down
+		return key, nil
+	}
+
+	<-fetch.done
+	if fetch.err != nil {
+		return nil, fetch.err
+	}
+	r.mu.Lock()
+	key = r.keys[keyId]
+	r.mu.Unlock()
+	return resolved(key, keyId)
+}
+
+func (r *RemoteKeySet) fetch(fetch *keyFetch) {
+	keys, err := r.download()
+	r.mu.Lock()
+	r.fetchedAt = time.Now()
+	if err == nil {
+		r.keys = keys
+	}
+	r.fetching = nil
+	r.mu.Unlock()
+	fetch.err = err
+	close(fetch.done)
+}
+
+func (r *RemoteKeySet) download() (map[string]*Key, error) {
+	response, err := r.client.Get(r.url)
+	if err != nil {
+		return nil, &KeySetUnavailableError{Reason: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &KeySetUnavailableError{Reason: fmt.Errorf("status: %d", response.StatusCode)}
+	}
+	var jwks JWKS
+	if err := json.NewDecoder(response.Body).Decode(&jwks); err != nil {
+		return nil, &KeySetUnavailableError{Reason: fmt.Errorf("failed to decode key set, reason: %w", err)}
+	}
+	keys := map[string]*Key{}
+	for _, jwk := range jwks.Keys {
+		// skip keys we can't use rather than failing on all of them
+		if key, err := jwk.Key(); err == nil {
+			keys[key.KeyId] = key
+		}
+	}
+	return keys, nil
+}
+
+func resolved(key *Key, keyId string) (*Key, error) {
+	if key == nil {
+		return nil, &UnknownKeyError{KeyId: keyId}
+	}
+	return key, nil
+}
+
+func encode(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+func decode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
@@ -0,0 +1,246 @@
+package token_manager
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"os"
+	"strings"
+)
+
+const (
+	AlgorithmHS512 = "HS512"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key is a signing or verification key with its key id, the "kid" header of
+// the tokens it signs. SigningKey is nil for keys that only verify, e.g. the
+// public keys of a signing key being rotated out.
+//
+// Legacy keys verify tokens issued before scopes and service tokens existed,
+// the tokens they verify are granted neither.
+type Key struct {
+	KeyId           string
+	Algorithm       string
+	SigningKey      interface{}
+	VerificationKey interface{}
+	Legacy          bool
+}
+
+// KeyResolver returns the key a token names in its "kid" header, tokens
+// without one resolve the empty key id.
+type KeyResolver interface {
+	Resolve(keyId string) (*Key, error)
+}
+
+// KeySet signs with one key and verifies with all of them, so that a new
+// signing key can be rolled out while tokens of the previous one are valid.
+type KeySet struct {
+	signingKeyId string
+	keys         map[string]*Key
+}
+
+func NewKeySet(signingKeyId string, keys ...*Key) (*KeySet, error) {
+	keySet := &KeySet{signingKeyId: signingKeyId, keys: map[string]*Key{}}
+	for _, key := range keys {
+		if _, ok := keySet.keys[key.KeyId]; ok {
+			return nil, fmt.Errorf("duplicate key with id: %q", key.KeyId)
+		}
+		if err := key.validate(); err != nil {
+			return nil, err
+		}
+		keySet.keys[key.KeyId] = key
+	}
+	signingKey, ok := keySet.keys[signingKeyId]
+	if !ok || signingKey.SigningKey == nil {
+		return nil, fmt.Errorf("signing key with id: %q is not configured", signingKeyId)
+	}
+	return keySet, nil
+}
+
+// ParseKeySet reads PEM encoded keys given as "kid:path,kid:path". Private
+// keys can sign and verify, public keys only verify.
+func ParseKeySet(signingKeyId string, privateKeys string, publicKeys string, extraKeys ...*Key) (*KeySet, error) {
+	keys := extraKeys
+	for _, list := range []struct {
+		entries string
+		parse   func(keyId string, pemBytes []byte) (*Key, error)
+	}{{privateKeys, ParsePrivateKey}, {publicKeys, ParsePublicKey}} {
+		for _, entry := range strings.Split(list.entries, ",") {
+			entry = strings.TrimSpace(entry)
+			if len(entry) == 0 {
+				continue
+			}
+			keyId, path, found := strings.Cut(entry, ":")
+			if !found {
+				return nil, fmt.Errorf("invalid key entry: %q", entry)
+			}
+			pemBytes, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read key with id: %s, reason: %w", keyId, err)
+			}
+			key, err := list.parse(keyId, pemBytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+	return NewKeySet(signingKeyId, keys...)
+}
+
+// NewSecretKey is an HS512 key from a base64 encoded shared secret.
+func NewSecretKey(keyId string, secretKeyBase64 string) *Key {
+	keyBytes, err := base64.StdEncoding.DecodeString(secretKeyBase64)
+	if err != nil {
+		// left empty, so the key set rejects it
+		keyBytes = nil
+	}
+	return &Key{KeyId: keyId, Algorithm: AlgorithmHS512, SigningKey: keyBytes, VerificationKey: keyBytes}
+}
+
+// NewLegacySecretKey only verifies the tokens a shared secret signed before
+// it was replaced by a signing key.
+func NewLegacySecretKey(keyId string, secretKeyBase64 string) *Key {
+	key := NewSecretKey(keyId, secretKeyBase64)
+	key.SigningKey, key.Legacy = nil, true
+	return key
+}
+
+// ParsePrivateKey parses a PKCS#8, PKCS#1 or SEC 1 private key, the algorithm
+// follows from the key type: RS256 for RSA, ES256 for P-256 and EdDSA for
+// Ed25519.
+func ParsePrivateKey(keyId string, pemBytes []byte) (*Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("key with id: %s is not PEM encoded", keyId)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes); rsaErr == nil {
+			privateKey, err = rsaKey, nil
+		} else if ecKey, ecErr := x509.ParseECPrivateKey(block.Bytes); ecErr == nil {
+			privateKey, err = ecKey, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key with id: %s, reason: %w", keyId, err)
+	}
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return &Key{KeyId: keyId, Algorithm: AlgorithmRS256, SigningKey: privateKey,
+			VerificationKey: &privateKey.PublicKey}, nil
+	case *ecdsa.PrivateKey:
+		return &Key{KeyId: keyId, Algorithm: AlgorithmES256, SigningKey: privateKey,
+			VerificationKey: &privateKey.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{KeyId: keyId, Algorithm: AlgorithmEdDSA, SigningKey: privateKey,
+			VerificationKey: privateKey.Public()}, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T with id: %s", privateKey, keyId)
+}
+
+// ParsePublicKey parses a PKIX public key.
+func ParsePublicKey(keyId string, pemBytes []byte) (*Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("key with id: %s is not PEM encoded", keyId)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key with id: %s, reason: %w", keyId, err)
+	}
+	return NewPublicKey(keyId, publicKey)
+}
+
+// NewPublicKey is a verification key for an RSA, P-256 or Ed25519 public key.
+func NewPublicKey(keyId string, publicKey interface{}) (*Key, error) {
+	key := &Key{KeyId: keyId, VerificationKey: publicKey}
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = AlgorithmRS256
+	case *ecdsa.PublicKey:
+		key.Algorithm = AlgorithmES256
+	case ed25519.PublicKey:
+		key.Algorithm = AlgorithmEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T with id: %s", publicKey, keyId)
+	}
+	return key, key.validate()
+}
+
+func (k *KeySet) Resolve(keyId string) (*Key, error) {
+	key, ok := k.keys[keyId]
+	if !ok {
+		return nil, &UnknownKeyError{KeyId: keyId}
+	}
+	return key, nil
+}
+
+func (k *KeySet) signingKey() *Key {
+	return k.keys[k.signingKeyId]
+}
+
+// PublicKeys returns the asymmetric keys, shared secrets are never published.
+func (k *KeySet) PublicKeys() []*Key {
+	var keys []*Key
+	for _, key := range k.keys {
+		if key.Algorithm != AlgorithmHS512 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (k *Key) validate() error {
+	var ok bool
+	switch k.Algorithm {
+	case AlgorithmHS512:
+		// an empty secret would accept tokens anyone can sign
+		var secret []byte
+		secret, ok = k.VerificationKey.([]byte)
+		ok = ok && len(secret) > 0
+	case AlgorithmRS256:
+		_, ok = k.VerificationKey.(*rsa.PublicKey)
+	case AlgorithmES256:
+		var publicKey *ecdsa.PublicKey
+		publicKey, ok = k.VerificationKey.(*ecdsa.PublicKey)
+		ok = ok && publicKey.Curve == elliptic.P256()
+	case AlgorithmEdDSA:
+		var publicKey ed25519.PublicKey
+		publicKey, ok = k.VerificationKey.(ed25519.PublicKey)
+		ok = ok && len(publicKey) == ed25519.PublicKeySize
+	default:
+		return fmt.Errorf("unsupported algorithm: %q for key with id: %s", k.Algorithm, k.KeyId)
+	}
+	if !ok {
+		return fmt.Errorf("key with id: %s is not a valid %s key", k.KeyId, k.Algorithm)
+	}
+	return nil
+}
+
+func (k *Key) signingMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// tokenKey resolves the key of token and checks that the token is signed
+// with the key's algorithm, so a public key can't be used as an HMAC secret.
+func tokenKey(resolver KeyResolver, token *jwt.Token) (*Key, error) {
+	keyId, _ := token.Header["kid"].(string)
+	key, err := resolver.Resolve(keyId)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, &InvalidAlgorithmError{Algorithm: token.Method.Alg()}
+	}
+	return key, nil
+}
@@ -0,0 +1,292 @@
+package token_manager
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeySetTokenManager_GenerateVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       *Key
+		algorithm string
+	}{
+		{name: "RS256", key: rsaKey(t, "rsa-1"), algorithm: AlgorithmRS256},
+		{name: "ES256", key: ecKey(t, "ec-1"), algorithm: AlgorithmES256},
+		{name: "EdDSA", key: edKey(t, "ed-1"), algorithm: AlgorithmEdDSA},
+		{name: "HS512", key: NewSecretKey("hs-1", base64.StdEncoding.EncodeToString([]byte("secret"))),
+			algorithm: AlgorithmHS512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keySet, err := NewKeySet(tt.key.KeyId, tt.key)
+			if err != nil {
+				t.Fatalf("NewKeySet() error = %v", err)
+			}
+			manager := NewKeySetTokenManager(keySet, nil)
+			apiToken, err := manager.Generate(testClaims())
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			header := tokenHeader(t, apiToken)
+			if header["alg"] != tt.algorithm || header["kid"] != tt.key.KeyId {
+				t.Errorf("Generate() header = %v, want alg %s and kid %s", header, tt.algorithm, tt.key.KeyId)
+			}
+			claims, err := manager.Verify(apiToken)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.UserId != "test-user" {
+				t.Errorf("Verify() user = %s, want test-user", claims.UserId)
+			}
+		})
+	}
+}
+
+func TestKeySetTokenManager_Rotation(t *testing.T) {
+	oldKey, newKey := ecKey(t, "key-1"), edKey(t, "key-2")
+	oldKeySet, _ := NewKeySet("key-1", oldKey)
+	oldToken, _ := NewKeySetTokenManager(oldKeySet, nil).Generate(testClaims())
+
+	retired, _ := NewPublicKey("key-1", oldKey.VerificationKey)
+	keySet, err := NewKeySet("key-2", newKey, retired)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	manager := NewKeySetTokenManager(keySet, nil)
+	if _, err := manager.Verify(oldToken); err != nil {
+		t.Errorf("Verify() of token signed with the previous key error = %v", err)
+	}
+	newToken, _ := manager.Generate(testClaims())
+	if _, err := NewKeySetTokenManager(oldKeySet, nil).Verify(newToken); err == nil {
+		t.Errorf("Verify() of token signed with an unknown key error = nil")
+	}
+	if _, err := NewKeySet("key-1", newKey, retired); err == nil {
+		t.Errorf("NewKeySet() signing with a public key error = nil")
+	}
+	if _, err := NewKeySet("", NewSecretKey("", "")); err == nil {
+		t.Errorf("NewKeySet() with an empty secret error = nil")
+	}
+}
+
+func TestKeySetTokenManager_AlgorithmConfusion(t *testing.T) {
+	key := rsaKey(t, "rsa-1")
+	keySet, _ := NewKeySet("rsa-1", key)
+	publicKey, _ := x509.MarshalPKIXPublicKey(key.VerificationKey)
+
+	// an HMAC token keyed with the published RSA public key
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Header["kid"] = "rsa-1"
+	token.Claims.(jwt.MapClaims)["user"] = "attacker"
+	tokenString, _ := token.SignedString(publicKey)
+	forged := base64.RawURLEncoding.EncodeToString([]byte(tokenString))
+
+	if _, err := NewKeySetTokenManager(keySet, nil).Verify(forged); err == nil {
+		t.Errorf("Verify() of HMAC token with an RSA key id error = nil")
+	}
+}
+
+func TestKeySetTokenManager_LegacySecret(t *testing.T) {
+	keySet, _ := NewKeySet("ed-1", edKey(t, "ed-1"), NewLegacySecretKey("", "c2VjcmV0"))
+	claims := testClaims()
+	claims.Kind, claims.Scopes = KindService, []string{"endpoints:write"}
+	legacyManager, err := NewJwtTokenManager("c2VjcmV0")
+	if err != nil {
+		t.Fatalf("NewJwtTokenManager() error = %v", err)
+	}
+	legacyToken, _ := legacyManager.Generate(claims)
+	verified, err := NewKeySetTokenManager(keySet, nil).Verify(legacyToken)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if verified.Kind != KindUser || len(verified.Scopes) > 0 {
+		t.Errorf("Verify() kind = %s, scopes = %v, want a user token without scopes", verified.Kind, verified.Scopes)
+	}
+	if _, err := NewKeySet("", NewLegacySecretKey("", "c2VjcmV0")); err == nil {
+		t.Errorf("NewKeySet() signing with a legacy secret error = nil")
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	dir := t.TempDir()
+	rsaPrivate, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPrivate)})
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(edPrivate)
+	ecPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pkix, _ := x509.MarshalPKIXPublicKey(&ecPrivate.PublicKey)
+	writeFile(t, dir, "rsa.pem", pkcs1)
+	writeFile(t, dir, "ed.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	writeFile(t, dir, "ec.pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}))
+
+	keySet, err := ParseKeySet("ed",
+		"rsa:"+filepath.Join(dir, "rsa.pem")+", ed:"+filepath.Join(dir, "ed.pem"),
+		"ec:"+filepath.Join(dir, "ec.pub"),
+		NewSecretKey("", "c2VjcmV0"))
+	if err != nil {
+		t.Fatalf("ParseKeySet() error = %v", err)
+	}
+	for keyId, algorithm := range map[string]string{"rsa": AlgorithmRS256, "ed": AlgorithmEdDSA,
+		"ec": AlgorithmES256, "": AlgorithmHS512} {
+		if key, err := keySet.Resolve(keyId); err != nil || key.Algorithm != algorithm {
+			t.Errorf("Resolve(%q) = %v, %v, want %s", keyId, key, err, algorithm)
+		}
+	}
+	if _, err := ParseKeySet("missing", "rsa:"+filepath.Join(dir, "rsa.pem"), ""); err == nil {
+		t.Errorf("ParseKeySet() with unknown signing key error = nil")
+	}
+	if _, err := ParseKeySet("rsa", "rsa", ""); err == nil {
+		t.Errorf("ParseKeySet() with invalid entry error = nil")
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	keySet, _ := NewKeySet("ec-1", ecKey(t, "ec-1"), rsaKey(t, "rsa-1"), edKey(t, "ed-1"),
+		NewSecretKey("hs-1", "c2VjcmV0"))
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(keySet.JWKS())
+	}))
+	defer server.Close()
+
+	jwks := keySet.JWKS()
+	if len(jwks.Keys) != 3 {
+		t.Errorf("JWKS() has %d keys, want the 3 public keys", len(jwks.Keys))
+	}
+	apiToken, _ := NewKeySetTokenManager(keySet, nil).Generate(testClaims())
+	verifier := NewJwtTokenVerifier(NewRemoteKeySet(server.URL), nil)
+	for i := 0; i < 2; i++ {
+		if _, err := verifier.Verify(apiToken); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("key set fetched %d times, want 1", requests)
+	}
+
+	// an unknown key id is only fetched again after the refresh interval
+	unknown, _ := NewKeySet("ec-2", ecKey(t, "ec-2"))
+	unknownToken, _ := NewKeySetTokenManager(unknown, nil).Generate(testClaims())
+	_, err := NewRemoteKeySet(server.URL).Resolve("hs-1")
+	var unknownKeyErr *UnknownKeyError
+	if !errors.As(err, &unknownKeyErr) {
+		t.Errorf("Resolve() of a shared secret error = %v, want UnknownKeyError", err)
+	}
+	if _, err := verifier.Verify(unknownToken); err == nil || requests != 2 {
+		t.Errorf("Verify() with unknown key error = %v after %d requests", err, requests)
+	}
+
+	// a key set that can't be fetched doesn't make the token invalid
+	server.Close()
+	_, err = NewJwtTokenVerifier(NewRemoteKeySet(server.URL), nil).Verify(apiToken)
+	var unavailableErr *KeySetUnavailableError
+	if !errors.As(err, &unavailableErr) || errors.Is(err, &InvalidTokenError{}) {
+		t.Errorf("Verify() with unavailable key set error = %v, want KeySetUnavailableError", err)
+	}
+}
+
+func TestRemoteKeySet_SlowFetch(t *testing.T) {
+	keySet, _ := NewKeySet("ec-1", ecKey(t, "ec-1"))
+	release, refreshing := make(chan struct{}), make(chan struct{}, 8)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			refreshing <- struct{}{}
+			<-release
+		}
+		json.NewEncoder(w).Encode(keySet.JWKS())
+	}))
+	defer server.Close()
+	defer close(release)
+
+	remote := NewRemoteKeySet(server.URL)
+	if _, err := remote.Resolve("ec-1"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	remote.mu.Lock()
+	remote.fetchedAt = time.Now().Add(-2 * jwksCacheDuration)
+	remote.mu.Unlock()
+
+	// the refresh hangs, the cached key still resolves meanwhile
+	for i := 0; i < 3; i++ {
+		resolved := make(chan error)
+		go func() {
+			_, err := remote.Resolve("ec-1")
+			resolved <- err
+		}()
+		select {
+		case err := <-resolved:
+			if err != nil {
+				t.Errorf("Resolve() during a refresh error = %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Resolve() of a cached key waited for the refresh")
+		}
+	}
+	<-refreshing
+	if got := requests.Load(); got != 2 {
+		t.Errorf("key set fetched %d times, want one refresh at a time", got)
+	}
+}
+
+func testClaims() *TokenClaims {
+	iat := time.Now()
+	exp := iat.Add(time.Hour)
+	return &TokenClaims{UserId: "test-user", IAT: &iat, EXP: &exp, Kind: "USER", Sub: "test-user"}
+}
+
+func tokenHeader(t *testing.T, apiToken string) map[string]interface{} {
+	decoded, _ := base64.RawURLEncoding.DecodeString(apiToken)
+	token, _, err := new(jwt.Parser).ParseUnverified(string(decoded), jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	return token.Header
+}
+
+func rsaKey(t *testing.T, keyId string) *Key {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	return &Key{KeyId: keyId, Algorithm: AlgorithmRS256, SigningKey: privateKey, VerificationKey: &privateKey.PublicKey}
+}
+
+func ecKey(t *testing.T, keyId string) *Key {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	return &Key{KeyId: keyId, Algorithm: AlgorithmES256, SigningKey: privateKey, VerificationKey: &privateKey.PublicKey}
+}
+
+func edKey(t *testing.T, keyId string) *Key {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	return &Key{KeyId: keyId, Algorithm: AlgorithmEdDSA, SigningKey: privateKey, VerificationKey: publicKey}
+}
+
+func writeFile(t *testing.T, dir string, name string, content []byte) {
+	if err := os.WriteFile(filepath.Join(dir, name), content, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
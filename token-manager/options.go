@@ -0,0 +1,103 @@
+package token_manager
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// VerifyOptions is the policy tokens are verified with. Algorithms restricts
+// the signing algorithms on top of the key's own, Issuer and Audience are
+// required when set and also stamped on generated tokens that name none.
+// Leeway allows for clock skew when checking exp, nbf and iat, and
+// RequiredClaims lists claims a token must carry, e.g. "exp" or "jti".
+type VerifyOptions struct {
+	Algorithms     []string
+	Issuer         string
+	Audience       string
+	Leeway         time.Duration
+	RequiredClaims []string
+}
+
+var defaultVerifyOptions = &VerifyOptions{}
+
+func verifyOptions(options *VerifyOptions) *VerifyOptions {
+	if options == nil {
+		return defaultVerifyOptions
+	}
+	return options
+}
+
+func (o *VerifyOptions) allowsAlgorithm(algorithm string) bool {
+	if len(o.Algorithms) == 0 {
+		return true
+	}
+	for _, allowed := range o.Algorithms {
+		if allowed == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *VerifyOptions) validate(claims map[string]interface{}, now time.Time) error {
+	for _, claim := range o.RequiredClaims {
+		if value, ok := claims[claim]; !ok || value == nil || value == "" {
+			return &MissingClaimError{Claim: claim}
+		}
+	}
+	if exp, ok := timeClaim(claims, "exp"); ok && now.After(exp.Add(o.Leeway)) {
+		return &TokenExpiryError{}
+	}
+	for _, claim := range []string{"nbf", "iat"} {
+		if notBefore, ok := timeClaim(claims, claim); ok && now.Add(o.Leeway).Before(notBefore) {
+			return &TokenNotYetValidError{}
+		}
+	}
+	if len(o.Issuer) > 0 {
+		if issuer, _ := claims["iss"].(string); issuer != o.Issuer {
+			return &InvalidIssuerError{Issuer: issuer}
+		}
+	}
+	if len(o.Audience) > 0 {
+		audience := audienceClaim(claims)
+		for _, aud := range audience {
+			if aud == o.Audience {
+				return nil
+			}
+		}
+		return &InvalidAudienceError{Audience: audience}
+	}
+	return nil
+}
+
+func timeClaim(claims map[string]interface{}, claim string) (time.Time, bool) {
+	switch value := claims[claim].(type) {
+	case float64:
+		return time.Unix(int64(value), 0), true
+	case json.Number:
+		seconds, err := value.Int64()
+		return time.Unix(seconds, 0), err == nil
+	case string:
+		// PASETO times are RFC 3339 strings
+		at, err := time.Parse(time.RFC3339, value)
+		return at, err == nil
+	}
+	return time.Time{}, false
+}
+
+// audienceClaim reads "aud" as a single audience or a list of them.
+func audienceClaim(claims map[string]interface{}) []string {
+	switch value := claims["aud"].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var audience []string
+		for _, aud := range value {
+			if aud, ok := aud.(string); ok {
+				audience = append(audience, aud)
+			}
+		}
+		return audience
+	}
+	return nil
+}
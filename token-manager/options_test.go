@@ -0,0 +1,123 @@
+package token_manager
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJwtTokenManager_VerifyOptions(t *testing.T) {
+	keySet, _ := NewKeySet("hs-1", NewSecretKey("hs-1", "c2VjcmV0"))
+	now := time.Now()
+	at := func(offset time.Duration) *time.Time {
+		at := now.Add(offset)
+		return &at
+	}
+	sign := func(claims *TokenClaims) string {
+		apiToken, err := NewKeySetTokenManager(keySet, nil).Generate(claims)
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		return apiToken
+	}
+	policy := &VerifyOptions{Issuer: "user-server", Audience: "social-server", Leeway: time.Minute}
+	tests := []struct {
+		name    string
+		options *VerifyOptions
+		token   string
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			options: policy,
+			token:   sign(&TokenClaims{IAT: at(0), EXP: at(time.Hour), Issuer: "user-server", Audience: []string{"social-server"}}),
+		},
+		{
+			name:    "expired within leeway",
+			options: policy,
+			token:   sign(&TokenClaims{IAT: at(-time.Hour), EXP: at(-30 * time.Second), Issuer: "user-server", Audience: []string{"social-server"}}),
+		},
+		{
+			name:    "expired",
+			options: policy,
+			token:   sign(&TokenClaims{IAT: at(-time.Hour), EXP: at(-2 * time.Minute), Issuer: "user-server", Audience: []string{"social-server"}}),
+			wantErr: &TokenExpiryError{},
+		},
+		{
+			name:    "not yet valid",
+			options: policy,
+			token:   sign(&TokenClaims{IAT: at(0), NBF: at(2 * time.Minute), EXP: at(time.Hour), Issuer: "user-server", Audience: []string{"social-server"}}),
+			wantErr: &TokenNotYetValidError{},
+		},
+		{
+			name:    "wrong issuer",
+			options: policy,
+			token:   sign(&TokenClaims{IAT: at(0), EXP: at(time.Hour), Issuer: "other", Audience: []string{"social-server"}}),
+			wantErr: &InvalidIssuerError{Issuer: "other"},
+		},
+		{
+			name:    "wrong audience",
+			options: policy,
+			token:   sign(&TokenClaims{IAT: at(0), EXP: at(time.Hour), Issuer: "user-server", Audience: []string{"a", "b"}}),
+			wantErr: &InvalidAudienceError{Audience: []string{"a", "b"}},
+		},
+		{
+			name:    "algorithm not allowed",
+			options: &VerifyOptions{Algorithms: []string{AlgorithmES256}},
+			token:   sign(&TokenClaims{IAT: at(0), EXP: at(time.Hour)}),
+			wantErr: &InvalidAlgorithmError{Algorithm: AlgorithmHS512},
+		},
+		{
+			name:    "bad signature",
+			token:   tamper(sign(&TokenClaims{IAT: at(0), EXP: at(time.Hour)})),
+			wantErr: &InvalidSignatureError{},
+		},
+		{
+			name:    "malformed",
+			token:   base64.RawURLEncoding.EncodeToString([]byte("not-a-jwt")),
+			wantErr: &MalformedTokenError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeySetTokenManager(keySet, tt.options).Verify(tt.token)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Verify() error = %#v, want %#v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, &InvalidTokenError{}) {
+				t.Errorf("Verify() error = %v doesn't unwrap to InvalidTokenError", err)
+			}
+		})
+	}
+}
+
+func TestJwtTokenManager_GeneratePolicyClaims(t *testing.T) {
+	keySet, _ := NewKeySet("hs-1", NewSecretKey("hs-1", "c2VjcmV0"))
+	manager := NewKeySetTokenManager(keySet, &VerifyOptions{Issuer: "user-server", Audience: "social-server",
+		RequiredClaims: []string{"exp", "jti"}})
+	apiToken, err := manager.Generate(testClaims())
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	claims, err := manager.Verify(apiToken)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.Issuer != "user-server" || !reflect.DeepEqual(claims.Audience, []string{"social-server"}) {
+		t.Errorf("Verify() issuer = %s, audience = %v", claims.Issuer, claims.Audience)
+	}
+	_, err = NewKeySetTokenManager(keySet, &VerifyOptions{RequiredClaims: []string{"nbf"}}).Verify(apiToken)
+	if !reflect.DeepEqual(err, &MissingClaimError{Claim: "nbf"}) {
+		t.Errorf("Verify() without nbf error = %v, want MissingClaimError", err)
+	}
+}
+
+func tamper(apiToken string) string {
+	decoded, _ := base64.RawURLEncoding.DecodeString(apiToken)
+	parts := strings.Split(string(decoded), ".")
+	parts[2] = strings.Repeat("A", len(parts[2]))
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, ".")))
+}
@@ -0,0 +1,264 @@
+package token_manager
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmPasetoV4Public = "v4.public"
+	AlgorithmPasetoV4Local  = "v4.local"
+
+	pasetoLocalKeySize = 32
+	pasetoNonceSize    = 32
+	pasetoMacSize      = 32
+)
+
+// PasetoTokenManager issues PASETO v4 tokens with the same claims as the JWT
+// managers. v4.public tokens are signed with an Ed25519 key and name it in
+// a {"kid": ...} footer, v4.local tokens are encrypted with a shared key.
+type PasetoTokenManager struct {
+	purpose  string
+	keySet   *KeySet
+	resolver KeyResolver
+	localKey []byte
+	options  *VerifyOptions
+}
+
+// NewPasetoPublicTokenManager signs v4.public tokens with the signing key of
+// keySet, which must be an Ed25519 key.
+func NewPasetoPublicTokenManager(keySet *KeySet, options *VerifyOptions) (*PasetoTokenManager, error) {
+	if signingKey := keySet.signingKey(); signingKey.Algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("signing key with id: %s is not an Ed25519 key", signingKey.KeyId)
+	}
+	return &PasetoTokenManager{
+		purpose:  AlgorithmPasetoV4Public,
+		keySet:   keySet,
+		resolver: keySet,
+		options:  verifyOptions(options),
+	}, nil
+}
+
+// NewPasetoPublicTokenVerifier verifies v4.public tokens without being able
+// to sign them, e.g. with the Ed25519 keys of a RemoteKeySet.
+func NewPasetoPublicTokenVerifier(resolver KeyResolver, options *VerifyOptions) *PasetoTokenManager {
+	return &PasetoTokenManager{
+		purpose:  AlgorithmPasetoV4Public,
+		resolver: resolver,
+		options:  verifyOptions(options),
+	}
+}
+
+// NewPasetoLocalTokenManager encrypts v4.local tokens with a base64 encoded
+// 256 bit key, only services holding the key can read or verify them. Every
+// one of them can mint tokens as well, so like the tokens of legacy keys they
+// are verified without scopes and never as service tokens.
+func NewPasetoLocalTokenManager(keyBase64 string, options *VerifyOptions) (*PasetoTokenManager, error) {
+	key, err := base64.StdEncoding.DecodeString(keyBase64)
+	if err != nil || len(key) != pasetoLocalKeySize {
+		return nil, fmt.Errorf("paseto local key must be %d base64 encoded bytes", pasetoLocalKeySize)
+	}
+	return &PasetoTokenManager{
+		purpose:  AlgorithmPasetoV4Local,
+		localKey: key,
+		options:  verifyOptions(options),
+	}, nil
+}
+
+func (p *PasetoTokenManager) Generate(claims *TokenClaims) (string, error) {
+	if err := assignJTI(claims); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(pasetoClaims(claims, p.options))
+	if err != nil {
+		return "", err
+	}
+	header := p.purpose + "."
+	if p.purpose == AlgorithmPasetoV4Local {
+		return encryptLocal(header, p.localKey, payload)
+	}
+	if p.keySet == nil {
+		return "", fmt.Errorf("paseto verifier can't sign tokens")
+	}
+	signingKey := p.keySet.signingKey()
+	var footer []byte
+	if len(signingKey.KeyId) > 0 {
+		footer, _ = json.Marshal(map[string]string{"kid": signingKey.KeyId})
+	}
+	signature := ed25519.Sign(signingKey.SigningKey.(ed25519.PrivateKey), pae([]byte(header), payload, footer, nil))
+	return header + encode(append(payload, signature...)) + encodeFooter(footer), nil
+}
+
+func (p *PasetoTokenManager) Verify(apiToken string) (*TokenClaims, error) {
+	header := p.purpose + "."
+	if !strings.HasPrefix(apiToken, header) {
+		if strings.HasPrefix(apiToken, "v") && strings.Count(apiToken, ".") >= 2 {
+			return nil, &InvalidAlgorithmError{Algorithm: strings.Join(strings.SplitN(apiToken, ".", 3)[:2], ".")}
+		}
+		return nil, &MalformedTokenError{}
+	}
+	if !p.options.allowsAlgorithm(p.purpose) {
+		return nil, &InvalidAlgorithmError{Algorithm: p.purpose}
+	}
+	body, footerPart, _ := strings.Cut(strings.TrimPrefix(apiToken, header), ".")
+	message, bodyErr := strictDecode(body)
+	footer, footerErr := strictDecode(footerPart)
+	if bodyErr != nil || footerErr != nil {
+		return nil, &MalformedTokenError{}
+	}
+
+	var payload []byte
+	var err error
+	if p.purpose == AlgorithmPasetoV4Local {
+		payload, err = decryptLocal(header, p.localKey, message, footer)
+	} else {
+		payload, err = p.verifyPublic(header, message, footer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, &MalformedTokenError{}
+	}
+	if err := p.options.validate(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	tokenClaims := &TokenClaims{}
+	setJavaClaims(claims, tokenClaims)
+	setGoClaims(claims, tokenClaims)
+	setCommonClaims(claims, tokenClaims)
+	if p.purpose == AlgorithmPasetoV4Local {
+		tokenClaims.Kind, tokenClaims.Scopes = KindUser, nil
+	}
+	return tokenClaims, nil
+}
+
+func (p *PasetoTokenManager) verifyPublic(header string, message []byte, footer []byte) ([]byte, error) {
+	if len(message) < ed25519.SignatureSize {
+		return nil, &MalformedTokenError{}
+	}
+	var keyFooter struct {
+		KeyId string `json:"kid"`
+	}
+	if len(footer) > 0 && json.Unmarshal(footer, &keyFooter) != nil {
+		return nil, &MalformedTokenError{}
+	}
+	key, err := p.resolver.Resolve(keyFooter.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.VerificationKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, &InvalidAlgorithmError{Algorithm: key.Algorithm}
+	}
+	payload := message[:len(message)-ed25519.SignatureSize]
+	signature := message[len(message)-ed25519.SignatureSize:]
+	if !ed25519.Verify(publicKey, pae([]byte(header), payload, footer, nil), signature) {
+		return nil, &InvalidSignatureError{}
+	}
+	return payload, nil
+}
+
+func encryptLocal(header string, key []byte, payload []byte) (string, error) {
+	nonce := make([]byte, pasetoNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	encryptionKey, counterNonce, authKey := localKeys(key, nonce)
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(payload))
+	cipher.XORKeyStream(ciphertext, payload)
+	mac := keyedHash(authKey, pasetoMacSize, pae([]byte(header), nonce, ciphertext, nil, nil))
+
+	message := append(append(nonce, ciphertext...), mac...)
+	return header + encode(message), nil
+}
+
+func decryptLocal(header string, key []byte, message []byte, footer []byte) ([]byte, error) {
+	if len(message) < pasetoNonceSize+pasetoMacSize {
+		return nil, &MalformedTokenError{}
+	}
+	nonce := message[:pasetoNonceSize]
+	ciphertext := message[pasetoNonceSize : len(message)-pasetoMacSize]
+	mac := message[len(message)-pasetoMacSize:]
+	encryptionKey, counterNonce, authKey := localKeys(key, nonce)
+	expected := keyedHash(authKey, pasetoMacSize, pae([]byte(header), nonce, ciphertext, footer, nil))
+	if !hmac.Equal(mac, expected) {
+		return nil, &InvalidSignatureError{}
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(payload, ciphertext)
+	return payload, nil
+}
+
+// localKeys splits the key into an XChaCha20 key and nonce and a MAC key for
+// the token's nonce.
+func localKeys(key []byte, nonce []byte) ([]byte, []byte, []byte) {
+	encryption := keyedHash(key, 56, append([]byte("paseto-encryption-key"), nonce...))
+	authKey := keyedHash(key, 32, append([]byte("paseto-auth-key-for-aead"), nonce...))
+	return encryption[:32], encryption[32:], authKey
+}
+
+func keyedHash(key []byte, size int, message []byte) []byte {
+	hash, _ := blake2b.New(size, key)
+	hash.Write(message)
+	return hash.Sum(nil)
+}
+
+// pae is the pre-authentication encoding of pieces, it keeps them from being
+// moved between each other.
+func pae(pieces ...[]byte) []byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, uint64(len(pieces)))
+	for _, piece := range pieces {
+		binary.Write(&buffer, binary.LittleEndian, uint64(len(piece)))
+		buffer.Write(piece)
+	}
+	return buffer.Bytes()
+}
+
+// strictDecode rejects encodings with non-zero padding bits, a token has a
+// single encoding.
+func strictDecode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.Strict().DecodeString(value)
+}
+
+func encodeFooter(footer []byte) string {
+	if len(footer) == 0 {
+		return ""
+	}
+	return "." + encode(footer)
+}
+
+// pasetoClaims are the JWT claims with RFC 3339 times.
+func pasetoClaims(tokenClaims *TokenClaims, options *VerifyOptions) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	setClaims(tokenClaims, claims)
+	setPolicyClaims(tokenClaims, options, claims)
+	for _, claim := range []string{"iat", "exp", "nbf"} {
+		if seconds, ok := claims[claim].(int64); ok {
+			claims[claim] = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+		}
+	}
+	return claims
+}
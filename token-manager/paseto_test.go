@@ -0,0 +1,137 @@
+package token_manager
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasetoTokenManager_GenerateVerify(t *testing.T) {
+	keySet, _ := NewKeySet("ed-1", edKey(t, "ed-1"))
+	public, err := NewPasetoPublicTokenManager(keySet, nil)
+	if err != nil {
+		t.Fatalf("NewPasetoPublicTokenManager() error = %v", err)
+	}
+	local, err := NewPasetoLocalTokenManager(base64.StdEncoding.EncodeToString(make([]byte, 32)), nil)
+	if err != nil {
+		t.Fatalf("NewPasetoLocalTokenManager() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		manager TokenManager
+		prefix  string
+	}{
+		{name: "v4.public", manager: public, prefix: "v4.public."},
+		{name: "v4.local", manager: local, prefix: "v4.local."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims()
+			claims.EmailId, claims.MachineId, claims.App = "test-email", "test-machine", "test-app"
+			apiToken, err := tt.manager.Generate(claims)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if !strings.HasPrefix(apiToken, tt.prefix) {
+				t.Errorf("Generate() = %s, want prefix %s", apiToken, tt.prefix)
+			}
+			got, err := tt.manager.Verify(apiToken)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.UserId != claims.UserId || got.EmailId != claims.EmailId || got.MachineId != claims.MachineId ||
+				got.App != claims.App || got.JTI != claims.JTI || got.EXP.Unix() != claims.EXP.Unix() {
+				t.Errorf("Verify() = %+v, want %+v", *got, *claims)
+			}
+
+			_, err = tt.manager.Verify(flip(apiToken, len(tt.prefix)+40))
+			if !errors.As(err, new(*InvalidSignatureError)) {
+				t.Errorf("Verify() of a tampered token error = %v, want InvalidSignatureError", err)
+			}
+		})
+	}
+
+	publicToken, _ := public.Generate(testClaims())
+	if _, err := local.Verify(publicToken); !errors.As(err, new(*InvalidAlgorithmError)) {
+		t.Errorf("Verify() of a v4.public token by v4.local error = %v, want InvalidAlgorithmError", err)
+	}
+	jwtToken, _ := NewKeySetTokenManager(keySet, nil).Generate(testClaims())
+	if _, err := public.Verify(jwtToken); !errors.As(err, new(*MalformedTokenError)) {
+		t.Errorf("Verify() of a JWT error = %v, want MalformedTokenError", err)
+	}
+}
+
+func TestPasetoTokenManager_Policy(t *testing.T) {
+	key := edKey(t, "ed-1")
+	keySet, _ := NewKeySet("ed-1", key)
+	manager, _ := NewPasetoPublicTokenManager(keySet, &VerifyOptions{Issuer: "user-server"})
+	iat := time.Now().Add(-2 * time.Hour)
+	exp := iat.Add(time.Hour)
+	expired, _ := manager.Generate(&TokenClaims{UserId: "test-user", IAT: &iat, EXP: &exp})
+	if _, err := manager.Verify(expired); !errors.As(err, new(*TokenExpiryError)) {
+		t.Errorf("Verify() of an expired token error = %v, want TokenExpiryError", err)
+	}
+
+	apiToken, _ := manager.Generate(testClaims())
+	retired, _ := NewPublicKey("ed-1", key.VerificationKey)
+	verifierKeys, _ := NewKeySet("ed-2", edKey(t, "ed-2"), retired)
+	claims, err := NewPasetoPublicTokenVerifier(verifierKeys, &VerifyOptions{Issuer: "user-server"}).Verify(apiToken)
+	if err != nil || claims.Issuer != "user-server" {
+		t.Errorf("Verify() by key id = %v, %v", claims, err)
+	}
+	if _, err := NewPasetoPublicTokenManager(mustKeySet(t, rsaKey(t, "rsa-1")), nil); err == nil {
+		t.Errorf("NewPasetoPublicTokenManager() with an RSA key error = nil")
+	}
+}
+
+// 4-E-1 of the PASETO v4 test vectors
+func TestPasetoTokenManager_LocalServiceToken(t *testing.T) {
+	local, err := NewPasetoLocalTokenManager(base64.StdEncoding.EncodeToString(make([]byte, 32)), nil)
+	if err != nil {
+		t.Fatalf("NewPasetoLocalTokenManager() error = %v", err)
+	}
+	claims := testClaims()
+	claims.Kind, claims.Scopes = KindService, []string{"endpoints:write"}
+	apiToken, _ := local.Generate(claims)
+	got, err := local.Verify(apiToken)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got.Kind != KindUser || got.Scopes != nil {
+		t.Errorf("Verify() of a v4.local service token = %s with scopes %v, want a user token without scopes",
+			got.Kind, got.Scopes)
+	}
+}
+
+func TestPasetoTokenManager_LocalVector(t *testing.T) {
+	key, _ := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	apiToken := "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg"
+	message, _ := strictDecode(strings.TrimPrefix(apiToken, "v4.local."))
+	payload, err := decryptLocal("v4.local.", key, message, nil)
+	if err != nil {
+		t.Fatalf("decryptLocal() error = %v", err)
+	}
+	if want := `{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`; string(payload) != want {
+		t.Errorf("decryptLocal() = %s, want %s", payload, want)
+	}
+}
+
+func mustKeySet(t *testing.T, key *Key) *KeySet {
+	keySet, err := NewKeySet(key.KeyId, key)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	return keySet
+}
+
+// flip changes the character at i to another base64 character.
+func flip(apiToken string, i int) string {
+	replacement := "A"
+	if apiToken[i] == 'A' {
+		replacement = "B"
+	}
+	return apiToken[:i] + replacement + apiToken[i+1:]
+}
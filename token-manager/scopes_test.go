@@ -0,0 +1,93 @@
+package token_manager
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestTokenManager_Scopes(t *testing.T) {
+	local, err := NewPasetoLocalTokenManager(base64.StdEncoding.EncodeToString(make([]byte, 32)), nil)
+	if err != nil {
+		t.Fatalf("NewPasetoLocalTokenManager() error = %v", err)
+	}
+	jwt, err := NewJwtTokenManager("c2VjcmV0")
+	if err != nil {
+		t.Fatalf("NewJwtTokenManager() error = %v", err)
+	}
+	managers := map[string]TokenManager{
+		"jwt":    jwt,
+		"paseto": local,
+	}
+	tests := []struct {
+		name   string
+		scopes []string
+	}{
+		{name: "no scopes", scopes: nil},
+		{name: "one scope", scopes: []string{"endpoints:write"}},
+		{name: "many scopes", scopes: []string{"endpoints:write", "tokens:introspect"}},
+	}
+	for managerName, manager := range managers {
+		for _, tt := range tests {
+			t.Run(managerName+"/"+tt.name, func(t *testing.T) {
+				claims := testClaims()
+				claims.Scopes = tt.scopes
+				want := tt.scopes
+				if managerName == "paseto" {
+					// any holder of the shared key could have granted them
+					want = nil
+				}
+				apiToken, err := manager.Generate(claims)
+				if err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				got, err := manager.Verify(apiToken)
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if !reflect.DeepEqual(got.Scopes, want) {
+					t.Errorf("Verify() scopes = %v, want %v", got.Scopes, want)
+				}
+			})
+		}
+	}
+}
+
+func TestScopesClaim(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim interface{}
+		want  []string
+	}{
+		{name: "space separated", claim: "a  b", want: []string{"a", "b"}},
+		{name: "list", claim: []interface{}{"a", 1, "b"}, want: []string{"a", "b"}},
+		{name: "missing", claim: nil, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopesClaim(map[string]interface{}{"scope": tt.claim}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scopesClaim() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenClaims_HasScopes(t *testing.T) {
+	claims := &TokenClaims{Scopes: []string{"endpoints:write", "profile:read"}}
+	tests := []struct {
+		name   string
+		scopes []string
+		want   bool
+	}{
+		{name: "none required", scopes: nil, want: true},
+		{name: "granted", scopes: []string{"profile:read", "endpoints:write"}, want: true},
+		{name: "one missing", scopes: []string{"endpoints:write", "admin"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claims.HasScopes(tt.scopes...); got != tt.want {
+				t.Errorf("HasScopes(%v) = %v, want %v", tt.scopes, got, tt.want)
+			}
+		})
+	}
+}
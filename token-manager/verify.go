@@ -2,31 +2,78 @@ package token_manager
 
 import (
 	"encoding/base64"
+	"errors"
 	"github.com/dgrijalva/jwt-go"
+	"strings"
 	"time"
 )
 
 func (j *JwtTokenManager) Verify(apiToken string) (*TokenClaims, error) {
+	return verify(apiToken, j.keySet, j.options)
+}
+
+func (j *JwtTokenVerifier) Verify(apiToken string) (*TokenClaims, error) {
+	return verify(apiToken, j.resolver, j.options)
+}
+
+// verify checks the signature first and the claims against options after,
+// so the claims of a forged token are never looked at.
+func verify(apiToken string, resolver KeyResolver, options *VerifyOptions) (*TokenClaims, error) {
 	decodedToken, decodeErr := base64.RawURLEncoding.DecodeString(apiToken)
 	if decodeErr != nil {
 		return nil, &TokenDecodeError{}
 	}
-	token, err := jwt.Parse(string(decodedToken), func(token *jwt.Token) (interface{}, error) {
-		return j.secretKey, nil
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	var key *Key
+	token, err := parser.Parse(string(decodedToken), func(token *jwt.Token) (interface{}, error) {
+		if !options.allowsAlgorithm(token.Method.Alg()) {
+			return nil, &InvalidAlgorithmError{Algorithm: token.Method.Alg()}
+		}
+		var err error
+		if key, err = tokenKey(resolver, token); err != nil {
+			return nil, err
+		}
+		return key.VerificationKey, nil
 	})
 	if err != nil {
-		return nil, &InvalidTokenError{}
+		return nil, verificationError(err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if err := options.validate(claims, time.Now()); err != nil {
+		return nil, err
 	}
 	tokenClaims := &TokenClaims{}
-	if token.Valid {
-		claims := token.Claims.(jwt.MapClaims)
-		setJavaClaims(claims, tokenClaims)
-		setGoClaims(claims, tokenClaims)
-		setCommonClaims(claims, tokenClaims)
-		return tokenClaims, nil
-	} else {
-		return nil, &TokenExpiryError{}
+	setJavaClaims(claims, tokenClaims)
+	setGoClaims(claims, tokenClaims)
+	setCommonClaims(claims, tokenClaims)
+	if key.Legacy {
+		tokenClaims.Kind, tokenClaims.Scopes = KindUser, nil
 	}
+	return tokenClaims, nil
+}
+
+// verificationError maps a parse failure to the error of its cause.
+func verificationError(err error) error {
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) {
+		return &InvalidTokenError{}
+	}
+	var invalidErr *InvalidTokenError
+	var unavailableErr *KeySetUnavailableError
+	if validationErr.Inner != nil && (errors.As(validationErr.Inner, &invalidErr) ||
+		errors.As(validationErr.Inner, &unavailableErr)) {
+		return validationErr.Inner
+	}
+	switch {
+	case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+		return &MalformedTokenError{}
+	case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return &InvalidSignatureError{}
+	case validationErr.Errors&jwt.ValidationErrorUnverifiable != 0 && validationErr.Inner == nil:
+		// the header names an algorithm that isn't registered
+		return &InvalidAlgorithmError{}
+	}
+	return &InvalidTokenError{}
 }
 
 // Java claims for compatibility , should be removed in the future
@@ -75,21 +122,40 @@ func setGoClaims(claims jwt.MapClaims, tokenClaims *TokenClaims) {
 func setCommonClaims(claims jwt.MapClaims, tokenClaims *TokenClaims) {
 	tokenClaims.IAT = getIATClaim(claims)
 	tokenClaims.EXP = getEXPClaim(claims)
+	if nbf, ok := timeClaim(claims, "nbf"); ok {
+		tokenClaims.NBF = &nbf
+	}
+	tokenClaims.Issuer, _ = claims["iss"].(string)
+	tokenClaims.Audience = audienceClaim(claims)
+	tokenClaims.Scopes = scopesClaim(claims)
+}
+
+// scopesClaim reads "scope" as a space separated string or a list of scopes.
+func scopesClaim(claims jwt.MapClaims) []string {
+	switch value := claims["scope"].(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var scopes []string
+		for _, scope := range value {
+			if scope, ok := scope.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return nil
 }
 
 func getIATClaim(claims jwt.MapClaims) *time.Time {
-	iatClaim, ok := claims["iat"].(float64)
-	if ok {
-		var iatTime = time.Unix(int64(iatClaim), 0)
+	if iatTime, ok := timeClaim(claims, "iat"); ok {
 		return &iatTime
 	}
 	return nil
 }
 
 func getEXPClaim(claims jwt.MapClaims) *time.Time {
-	expClaim, ok := claims["exp"].(float64)
-	if ok {
-		var expTime = time.Unix(int64(expClaim), 0)
+	if expTime, ok := timeClaim(claims, "exp"); ok {
 		return &expTime
 	}
 	return nil
@@ -42,7 +42,10 @@ func TestJwtTokenManager_Verify(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			j := NewJwtTokenManager(tt.fields.secretKey)
+			j, err := NewJwtTokenManager(tt.fields.secretKey)
+			if err != nil {
+				t.Fatalf("NewJwtTokenManager() error = %v", err)
+			}
 			got, err := j.Verify(tt.args.apiToken)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
@@ -1,20 +1,51 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
+	"log"
 	"strings"
 	token "token-manager"
 	"user-server/common"
 )
 
+// RevocationChecker reports whether a token was revoked before it expired.
+type RevocationChecker interface {
+	IsRevoked(ctx *context.Context, claims *token.TokenClaims) (bool, error)
+}
+
+// AuthHandler accepts user tokens, or only service tokens when service is
+// set, the two are never accepted on the same route.
 type AuthHandler struct {
-	tokenManager token.TokenManager
+	tokenVerifier token.TokenVerifier
+	revocations   RevocationChecker
+	service       bool
+}
+
+func NewAuthHandler(tokenVerifier token.TokenVerifier) *AuthHandler {
+	return &AuthHandler{
+		tokenVerifier: tokenVerifier,
+	}
 }
 
-func NewAuthHandler(secretKey string) *AuthHandler {
+// NewRevocationCheckingAuthHandler also rejects tokens that were revoked.
+func NewRevocationCheckingAuthHandler(tokenVerifier token.TokenVerifier,
+	revocations RevocationChecker) *AuthHandler {
 	return &AuthHandler{
-		tokenManager: token.NewJwtTokenManager(secretKey),
+		tokenVerifier: tokenVerifier,
+		revocations:   revocations,
+	}
+}
+
+// NewServiceAuthHandler accepts only service tokens, for internal routes
+// called by other services.
+func NewServiceAuthHandler(tokenVerifier token.TokenVerifier,
+	revocations RevocationChecker) *AuthHandler {
+	return &AuthHandler{
+		tokenVerifier: tokenVerifier,
+		revocations:   revocations,
+		service:       true,
 	}
 }
 
@@ -33,21 +64,87 @@ func (a *AuthHandler) Handle() gin.HandlerFunc {
 		}
 
 		jwtToken, err := a.validate(extractedToken)
+		var unavailableErr *token.KeySetUnavailableError
+		var introspectionErr *token.IntrospectionError
+		if errors.As(err, &unavailableErr) || errors.As(err, &introspectionErr) {
+			log.Printf("failed to verify auth token, reason: %s", err)
+			common.ServiceUnavailable(c, "keys-unavailable", "Auth token can't be verified right now")
+			return
+		}
 		if err != nil {
-			if errors.Is(err, &token.InvalidTokenError{}) || errors.Is(err, &token.TokenDecodeError{}) {
-				common.Unauthorized(c, "invalid-token", "Auth token is not valid")
-				return
+			code, message := verificationFailure(err)
+			common.Unauthorized(c, code, message)
+			return
+		}
+		if isService := jwtToken.Kind == token.KindService; isService != a.service {
+			if isService {
+				common.Forbidden(c, "service-token", "Route requires a user token")
+			} else {
+				common.Forbidden(c, "service-token-required", "Route requires a service token")
 			}
-		} else {
-			c.Set("user", *jwtToken)
-			c.Next()
+			return
 		}
+		if a.revocations != nil && !a.checkRevocation(c, jwtToken) {
+			return
+		}
+		c.Set("user", *jwtToken)
+		c.Next()
+	}
+}
 
+// verificationFailure returns the response code and message for a token
+// that failed verification.
+func verificationFailure(err error) (string, string) {
+	var expiryErr *token.TokenExpiryError
+	var notYetValidErr *token.TokenNotYetValidError
+	var decodeErr *token.TokenDecodeError
+	var malformedErr *token.MalformedTokenError
+	var signatureErr *token.InvalidSignatureError
+	var algorithmErr *token.InvalidAlgorithmError
+	var unknownKeyErr *token.UnknownKeyError
+	var issuerErr *token.InvalidIssuerError
+	var audienceErr *token.InvalidAudienceError
+	var missingClaimErr *token.MissingClaimError
+	var inactiveErr *token.InactiveTokenError
+	switch {
+	case errors.As(err, &expiryErr):
+		return "token-expired", "Auth token is expired"
+	case errors.As(err, &notYetValidErr):
+		return "token-not-yet-valid", "Auth token is not valid yet"
+	case errors.As(err, &decodeErr), errors.As(err, &malformedErr):
+		return "malformed-token", "Auth token is malformed"
+	case errors.As(err, &signatureErr), errors.As(err, &algorithmErr), errors.As(err, &unknownKeyErr):
+		return "invalid-signature", "Auth token signature is not valid"
+	case errors.As(err, &issuerErr):
+		return "invalid-issuer", "Auth token is not issued by a trusted issuer"
+	case errors.As(err, &audienceErr):
+		return "invalid-audience", "Auth token is not meant for this service"
+	case errors.As(err, &missingClaimErr):
+		return "missing-claim", "Auth token is missing claim: " + missingClaimErr.Claim
+	case errors.As(err, &inactiveErr):
+		return "token-revoked", "Auth token is revoked"
+	}
+	return "invalid-token", "Auth token is not valid"
+}
+
+func (a *AuthHandler) checkRevocation(c *gin.Context, claims *token.TokenClaims) bool {
+	ctx := c.Request.Context()
+	revoked, err := a.revocations.IsRevoked(&ctx, claims)
+	if err != nil {
+		log.Printf("failed to check revocation of token for user: %s, reason: %s", claims.UserId, err)
+		common.InternalError(c, "failed to check auth token")
+		c.Abort()
+		return false
+	}
+	if revoked {
+		common.Unauthorized(c, "token-revoked", "Auth token is revoked")
+		return false
 	}
+	return true
 }
 
 func (a *AuthHandler) validate(token string) (*token.TokenClaims, error) {
-	jwtToken, err := a.tokenManager.Verify(token)
+	jwtToken, err := a.tokenVerifier.Verify(token)
 	return jwtToken, err
 }
 
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	token "token-manager"
+)
+
+func TestAuthHandler_TokenKind(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokenManager, err := token.NewJwtTokenManager("c2VjcmV0")
+	if err != nil {
+		t.Fatalf("NewJwtTokenManager() error = %v", err)
+	}
+	tests := []struct {
+		name       string
+		handler    *AuthHandler
+		kind       string
+		wantStatus int
+	}{
+		{name: "user token on user route", handler: NewAuthHandler(tokenManager), kind: token.KindUser,
+			wantStatus: http.StatusOK},
+		{name: "service token on user route", handler: NewAuthHandler(tokenManager), kind: token.KindService,
+			wantStatus: http.StatusForbidden},
+		{name: "service token on internal route", handler: NewServiceAuthHandler(tokenManager, nil),
+			kind: token.KindService, wantStatus: http.StatusOK},
+		{name: "user token on internal route", handler: NewServiceAuthHandler(tokenManager, nil),
+			kind: token.KindUser, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iat := time.Now()
+			exp := iat.Add(time.Minute)
+			apiToken, err := tokenManager.Generate(&token.TokenClaims{IAT: &iat, EXP: &exp, Kind: tt.kind})
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			router := gin.New()
+			router.GET("/route", tt.handler.Handle(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			request := httptest.NewRequest(http.MethodGet, "/route", nil)
+			request.Header.Set("Authorization", "Bearer "+apiToken)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Handle() status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_KeySetUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	keySet, _ := token.NewKeySet("key-1", token.NewSecretKey("key-1", "c2VjcmV0"))
+	iat := time.Now()
+	exp := iat.Add(time.Minute)
+	apiToken, err := token.NewKeySetTokenManager(keySet, nil).Generate(
+		&token.TokenClaims{IAT: &iat, EXP: &exp, Kind: token.KindUser})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	handler := NewAuthHandler(token.NewJwtTokenVerifier(token.NewRemoteKeySet(server.URL), nil))
+	router := gin.New()
+	router.GET("/route", handler.Handle(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/route", nil)
+	request.Header.Set("Authorization", "Bearer "+apiToken)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Handle() status = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+	token "token-manager"
+	"user-server/common"
+)
+
+// RequireScopes lets through requests whose token was granted every one of
+// scopes. It must follow AuthHandler.Handle, which sets the token's claims.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get("user")
+		claims, isClaims := value.(token.TokenClaims)
+		if !ok || !isClaims {
+			common.Unauthorized(c, "missing-token", "invalid or missing Bearer token")
+			return
+		}
+		if !claims.HasScopes(scopes...) {
+			common.Forbidden(c, "insufficient-scope", "Auth token requires scopes: "+strings.Join(scopes, " "))
+			return
+		}
+		c.Next()
+	}
+}
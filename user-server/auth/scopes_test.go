@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	token "token-manager"
+)
+
+func TestRequireScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		claims     *token.TokenClaims
+		wantStatus int
+	}{
+		{name: "granted", claims: &token.TokenClaims{Scopes: []string{"endpoints:write", "other"}}, wantStatus: http.StatusOK},
+		{name: "missing scope", claims: &token.TokenClaims{Scopes: []string{"other"}}, wantStatus: http.StatusForbidden},
+		{name: "no scopes", claims: &token.TokenClaims{}, wantStatus: http.StatusForbidden},
+		{name: "unauthenticated", claims: nil, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.PATCH("/endpoints", func(c *gin.Context) {
+				if tt.claims != nil {
+					c.Set("user", *tt.claims)
+				}
+			}, RequireScopes("endpoints:write"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPatch, "/endpoints", nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("RequireScopes() status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -15,7 +15,8 @@ func (a *AuthHandler) Verify(c *gin.Context) {
 		return
 	}
 	ctx := getRequestContext(c)
-	verifyResponse, err := a.authService.Verify(&ctx, verifyRequest.SessionId, verifyRequest.Otp)
+	verifyResponse, err := a.authService.Verify(&ctx, verifyRequest.SessionId, verifyRequest.Otp,
+		verifyRequest.FingerPrint)
 	if err != nil {
 		log.Printf("Failed to verify otp with sessionId: %s, reason: %s", verifyRequest.SessionId, err.Error())
 		handle(err, c)
@@ -42,4 +43,6 @@ func handle(err error, ctx *gin.Context) {
 type VerifyRequest struct {
 	SessionId string `json:"sessionId"`
 	Otp       uint64 `json:"otp"`
+	// FingerPrint is the device the refresh token is bound to
+	FingerPrint string `json:"fingerPrint" binding:"required"`
 }
@@ -7,20 +7,20 @@ import (
 	"otp-manager/otp"
 	"otp-manager/senders"
 	"otp-manager/sms"
-	token "token-manager"
 	"user-server/authenticator/handlers"
 	"user-server/authenticator/service"
 	"user-server/authenticator/sessiondb"
 	"user-server/common"
 	"user-server/config"
 	"user-server/signup/db"
+	"user-server/tokens"
 )
 
 var authHandler *handlers.AuthHandler
 
 func LoadHandlers(router *gin.Engine) {
 	ctx := context.Background()
-	authService := service.NewUserAuthenticator(getSmsOtpManager(&ctx), getEmailOtpManager(&ctx), getUserStore(), getTokenManager(),
+	authService := service.NewUserAuthenticator(getSmsOtpManager(&ctx), getEmailOtpManager(&ctx), getUserStore(), tokens.GetTokenService(),
 		getSessionMapping())
 	authHandler = handlers.NewAuthHandler(authService)
 	loadRoutes(router)
@@ -32,10 +32,6 @@ func getSessionMapping() sessiondb.SessionRepository {
 	return sessiondb.NewSessionMongoStore(sessionColl)
 }
 
-func getTokenManager() token.TokenManager {
-	return token.NewJwtTokenManager(config.Configuration.SecretKey)
-}
-
 func getUserStore() db.UserStore {
 	mongoConfig := config.Configuration.MongoConfig
 	userColl, _ := mongoConfig.GetCollection(common.UserCollection)
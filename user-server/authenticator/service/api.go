@@ -4,26 +4,29 @@ import (
 	"context"
 	"otp-manager/common"
 	"otp-manager/otp"
-	token "token-manager"
 	"user-server/authenticator/sessiondb"
 	"user-server/signup/db"
+	tokens "user-server/tokens/service"
 )
 
 type UserAuthenticator interface {
 	SendOTP(ctx *context.Context, contact *common.Contact) (*string, error)
-	Verify(ctx *context.Context, sessionId string, otp uint64) (*VerifyResponse, error)
+	Verify(ctx *context.Context, sessionId string, otp uint64, fingerPrint string) (*VerifyResponse, error)
 }
 
 type VerifyResponse struct {
 	UserId string `json:"userId"`
 	Token  string `json:"token"`
+	// RefreshToken is bound to the fingerprint the otp was verified with
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
 }
 
 type UserAuthenticatorImpl struct {
 	smsOtpManager   otp.OtpManager
 	emailOtpManager otp.OtpManager
 	userStore       db.UserStore
-	tokenManager    token.TokenManager
+	tokenService    tokens.TokenService
 	sessionMapping  sessiondb.SessionRepository
 }
 
@@ -31,14 +34,14 @@ func NewUserAuthenticator(
 	smsOtpManager otp.OtpManager,
 	emailOtpManager otp.OtpManager,
 	userStore db.UserStore,
-	tokenManager token.TokenManager,
+	tokenService tokens.TokenService,
 	sessionMapping sessiondb.SessionRepository,
 ) *UserAuthenticatorImpl {
 	return &UserAuthenticatorImpl{
 		smsOtpManager:   smsOtpManager,
 		emailOtpManager: emailOtpManager,
 		userStore:       userStore,
-		tokenManager:    tokenManager,
+		tokenService:    tokenService,
 		sessionMapping:  sessionMapping,
 	}
 }
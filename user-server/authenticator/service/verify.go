@@ -2,11 +2,11 @@ package service
 
 import (
 	"context"
-	"time"
-	token "token-manager"
+	tokens "user-server/tokens/service"
 )
 
-func (manager *UserAuthenticatorImpl) Verify(ctx *context.Context, sessionId string, otp uint64) (*VerifyResponse, error) {
+func (manager *UserAuthenticatorImpl) Verify(ctx *context.Context, sessionId string, otp uint64,
+	fingerPrint string) (*VerifyResponse, error) {
 	result, err := manager.sessionMapping.Get(ctx, sessionId)
 	if err != nil {
 		return nil, err
@@ -17,26 +17,18 @@ func (manager *UserAuthenticatorImpl) Verify(ctx *context.Context, sessionId str
 		return nil, err
 	}
 
-	claims := generateTokenClaims(result.UserId)
-	authToken, err := manager.tokenManager.Generate(claims)
+	issued, err := manager.tokenService.Issue(ctx, &tokens.Subject{
+		UserId:      result.UserId,
+		FingerPrint: fingerPrint,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &VerifyResponse{
-		UserId: result.UserId,
-		Token:  authToken,
+		UserId:       result.UserId,
+		Token:        issued.AccessToken,
+		RefreshToken: issued.RefreshToken,
+		ExpiresIn:    issued.ExpiresIn,
 	}, nil
 }
-
-func generateTokenClaims(userId string) *token.TokenClaims {
-	iat := time.Now()
-	exp := iat.Add(24 * 7 * time.Hour)
-	return &token.TokenClaims{
-		UserId: userId,
-		IAT:    &iat,
-		EXP:    &exp,
-		Kind:   "USER",
-		Sub:    userId,
-	}
-}
@@ -0,0 +1,23 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// ServiceClient is a service that authenticates with the client credentials
+// grant. Its secret is stored as a SHA-256 hash, Scopes are the most its
+// tokens are granted.
+type ServiceClient struct {
+	ClientId   string     `bson:"clientId"`
+	Name       string     `bson:"name"`
+	SecretHash string     `bson:"secretHash"`
+	Scopes     []string   `bson:"scopes,omitempty"`
+	CreatedOn  time.Time  `bson:"createdOn"`
+	DisabledOn *time.Time `bson:"disabledOn,omitempty"`
+}
+
+type ClientStore interface {
+	Insert(ctx *context.Context, client *ServiceClient) error
+	Get(ctx *context.Context, clientId string) (*ServiceClient, error)
+}
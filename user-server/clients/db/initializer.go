@@ -0,0 +1,25 @@
+package db
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"user-server/common"
+	"user-server/config"
+)
+
+func LoadDB(ctx *context.Context) {
+	clientColl, err := config.Configuration.MongoConfig.GetCollection(common.ServiceClientCollection)
+	if err != nil {
+		log.Panicf("failed to get collection %s , because of %s", common.ServiceClientCollection, err.Error())
+	}
+	_, err = clientColl.Indexes().CreateOne(*ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "clientId", Value: 1}},
+		Options: options.Index().SetName("clientId-index").SetUnique(true),
+	})
+	if err != nil {
+		log.Panicf("failed to create index on %s, reason: %s", common.ServiceClientCollection, err)
+	}
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"user-server/common"
+)
+
+type MongoClientStore struct {
+	clientColl *mongo.Collection
+}
+
+func NewMongoClientStore(clientColl *mongo.Collection) *MongoClientStore {
+	return &MongoClientStore{
+		clientColl: clientColl,
+	}
+}
+
+func (m *MongoClientStore) Insert(ctx *context.Context, client *ServiceClient) error {
+	_, err := m.clientColl.InsertOne(*ctx, client)
+	if mongo.IsDuplicateKeyError(err) {
+		return &common.AlreadyExistsError{Message: "Service client already exists"}
+	}
+	return err
+}
+
+func (m *MongoClientStore) Get(ctx *context.Context, clientId string) (*ServiceClient, error) {
+	filter := bson.D{{Key: "clientId", Value: clientId}}
+	var client ServiceClient
+	err := m.clientColl.FindOne(*ctx, filter).Decode(&client)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, &common.NotFoundError{Message: "Service client not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
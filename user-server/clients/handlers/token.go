@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"user-server/clients/service"
+	"user-server/common"
+)
+
+type ClientHandler struct {
+	clientService service.ClientService
+}
+
+func NewClientHandler(clientService service.ClientService) *ClientHandler {
+	return &ClientHandler{clientService: clientService}
+}
+
+// TokenRequest is a client credentials grant of RFC 6749, the client
+// authenticates with HTTP basic auth or with ClientId and ClientSecret.
+type TokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Scope        string `form:"scope"`
+	ClientId     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// Token issues a service token to a registered client.
+func (h *ClientHandler) Token(c *gin.Context) {
+	var request TokenRequest
+	if err := c.ShouldBind(&request); err != nil {
+		common.BadRequest(c, "invalid_request", "Invalid request: failed to parse request body")
+		return
+	}
+	if request.GrantType != "client_credentials" {
+		common.BadRequest(c, "unsupported_grant_type", "only the client_credentials grant is supported")
+		return
+	}
+	clientId, clientSecret := clientCredentials(c, &request)
+	if len(clientId) == 0 {
+		common.Unauthorized(c, "invalid_client", "client credentials not found")
+		return
+	}
+
+	ctx := c.Request.Context()
+	issued, err := h.clientService.IssueToken(&ctx, clientId, clientSecret, strings.Fields(request.Scope))
+	if err != nil {
+		handleTokenErrors(c, clientId, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, issued)
+}
+
+// clientCredentials prefers basic auth, whose credentials are form encoded.
+func clientCredentials(c *gin.Context, request *TokenRequest) (string, string) {
+	clientId, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		return request.ClientId, request.ClientSecret
+	}
+	clientId, idErr := url.QueryUnescape(clientId)
+	clientSecret, secretErr := url.QueryUnescape(clientSecret)
+	if idErr != nil || secretErr != nil {
+		return "", ""
+	}
+	return clientId, clientSecret
+}
+
+func handleTokenErrors(c *gin.Context, clientId string, err error) {
+	var clientErr *service.InvalidClientError
+	var scopeErr *service.InvalidScopeError
+	switch {
+	case errors.As(err, &clientErr):
+		log.Printf("client: %s failed to authenticate", clientId)
+		common.Unauthorized(c, "invalid_client", clientErr.Error())
+	case errors.As(err, &scopeErr):
+		common.BadRequest(c, "invalid_scope", scopeErr.Error())
+	default:
+		log.Printf("failed to issue token to client: %s, reason: %s", clientId, err.Error())
+		common.InternalError(c, "failed to issue token, reason: "+err.Error())
+	}
+}
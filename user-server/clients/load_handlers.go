@@ -0,0 +1,32 @@
+package clients
+
+import (
+	"github.com/gin-gonic/gin"
+	"time"
+	"user-server/clients/db"
+	"user-server/clients/handlers"
+	"user-server/clients/service"
+	"user-server/common"
+	"user-server/config"
+	"user-server/jwks"
+)
+
+var clientHandler *handlers.ClientHandler
+
+func LoadHandlers(router *gin.Engine) {
+	clientHandler = handlers.NewClientHandler(CreateClientService())
+	loadRoutes(router)
+}
+
+// CreateClientService issues service tokens with the configured lifetime, it
+// also registers clients from outside the server.
+func CreateClientService() *service.ClientServiceImpl {
+	clientColl, _ := config.Configuration.MongoConfig.GetCollection(common.ServiceClientCollection)
+	return service.NewClientService(jwks.GetTokenManager(), db.NewMongoClientStore(clientColl),
+		time.Duration(config.Configuration.TokenConfig.ServiceTokenTTL)*time.Minute)
+}
+
+func loadRoutes(router *gin.Engine) {
+	routes := router.Group("/api/v1/oauth")
+	routes.POST("/token", clientHandler.Token)
+}
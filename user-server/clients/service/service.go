@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+	token "token-manager"
+	"user-server/clients/db"
+	"user-server/common"
+)
+
+const clientSecretSize = 32
+
+// Credentials are returned once, when the client is registered, only the
+// hash of the secret is stored.
+type Credentials struct {
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+// ServiceToken is the access token response of RFC 6749.
+type ServiceToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds
+	ExpiresIn int64  `json:"expires_in"`
+	Scope     string `json:"scope,omitempty"`
+}
+
+// InvalidClientError is returned for an unknown or disabled client or a
+// wrong secret, without telling them apart.
+type InvalidClientError struct{}
+
+func (e *InvalidClientError) Error() string {
+	return "client authentication failed"
+}
+
+// InvalidScopeError is returned for a scope the client wasn't granted.
+type InvalidScopeError struct {
+	Scope string
+}
+
+func (e *InvalidScopeError) Error() string {
+	return "client is not granted scope: " + e.Scope
+}
+
+type ClientService interface {
+	Register(ctx *context.Context, name string, scopes []string) (*Credentials, error)
+	IssueToken(ctx *context.Context, clientId string, clientSecret string, scopes []string) (*ServiceToken, error)
+}
+
+// ClientServiceImpl issues short-lived SERVICE tokens to registered clients
+// with the client credentials grant, there's no refresh token.
+type ClientServiceImpl struct {
+	tokenManager token.TokenManager
+	clientStore  db.ClientStore
+	tokenTTL     time.Duration
+}
+
+func NewClientService(tokenManager token.TokenManager, clientStore db.ClientStore,
+	tokenTTL time.Duration) *ClientServiceImpl {
+	return &ClientServiceImpl{
+		tokenManager: tokenManager,
+		clientStore:  clientStore,
+		tokenTTL:     tokenTTL,
+	}
+}
+
+// Register creates a client that may request tokens with up to scopes.
+func (s *ClientServiceImpl) Register(ctx *context.Context, name string, scopes []string) (*Credentials, error) {
+	secret := make([]byte, clientSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	credentials := &Credentials{
+		ClientId:     primitive.NewObjectID().Hex(),
+		ClientSecret: base64.RawURLEncoding.EncodeToString(secret),
+	}
+	err := s.clientStore.Insert(ctx, &db.ServiceClient{
+		ClientId:   credentials.ClientId,
+		Name:       name,
+		SecretHash: hashSecret(credentials.ClientSecret),
+		Scopes:     scopes,
+		CreatedOn:  time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// IssueToken authenticates the client and issues a token with scopes, or
+// with every scope of the client when none are requested.
+func (s *ClientServiceImpl) IssueToken(ctx *context.Context, clientId string, clientSecret string,
+	scopes []string) (*ServiceToken, error) {
+	client, err := s.clientStore.Get(ctx, clientId)
+	var notFoundErr *common.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil, &InvalidClientError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	secretHash := hashSecret(clientSecret)
+	if client.DisabledOn != nil || subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.SecretHash)) != 1 {
+		return nil, &InvalidClientError{}
+	}
+
+	granted := &token.TokenClaims{Scopes: client.Scopes}
+	for _, scope := range scopes {
+		if !granted.HasScopes(scope) {
+			return nil, &InvalidScopeError{Scope: scope}
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	now := time.Now()
+	exp := now.Add(s.tokenTTL)
+	accessToken, err := s.tokenManager.Generate(&token.TokenClaims{
+		App:    client.Name,
+		IAT:    &now,
+		EXP:    &exp,
+		Kind:   token.KindService,
+		Sub:    client.ClientId,
+		Scopes: scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceToken{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.tokenTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+func hashSecret(clientSecret string) string {
+	hash := sha256.Sum256([]byte(clientSecret))
+	return hex.EncodeToString(hash[:])
+}
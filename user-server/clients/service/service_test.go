@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	token "token-manager"
+	"user-server/clients/db"
+	"user-server/common"
+)
+
+type memoryClientStore struct {
+	clients map[string]*db.ServiceClient
+}
+
+func (m *memoryClientStore) Insert(ctx *context.Context, client *db.ServiceClient) error {
+	stored := *client
+	m.clients[client.ClientId] = &stored
+	return nil
+}
+
+func (m *memoryClientStore) Get(ctx *context.Context, clientId string) (*db.ServiceClient, error) {
+	stored, ok := m.clients[clientId]
+	if !ok {
+		return nil, &common.NotFoundError{Message: "Service client not found"}
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func TestClientService_IssueToken(t *testing.T) {
+	ctx := context.Background()
+	tokenManager, err := token.NewJwtTokenManager("c2VjcmV0")
+	if err != nil {
+		t.Fatalf("NewJwtTokenManager() error = %v", err)
+	}
+	store := &memoryClientStore{clients: map[string]*db.ServiceClient{}}
+	s := NewClientService(tokenManager, store, 5*time.Minute)
+	credentials, err := s.Register(&ctx, "social-server", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if store.clients[credentials.ClientId].SecretHash == credentials.ClientSecret {
+		t.Errorf("client secret is stored in plain text")
+	}
+	disabled, _ := s.Register(&ctx, "retired", nil)
+	disabledOn := time.Now()
+	store.clients[disabled.ClientId].DisabledOn = &disabledOn
+
+	tests := []struct {
+		name       string
+		clientId   string
+		secret     string
+		scopes     []string
+		wantScopes []string
+		wantErr    interface{}
+	}{
+		{name: "all scopes", clientId: credentials.ClientId, secret: credentials.ClientSecret,
+			wantScopes: []string{"a", "b"}},
+		{name: "requested scopes", clientId: credentials.ClientId, secret: credentials.ClientSecret,
+			scopes: []string{"b"}, wantScopes: []string{"b"}},
+		{name: "scope not granted", clientId: credentials.ClientId, secret: credentials.ClientSecret,
+			scopes: []string{"b", "c"}, wantErr: new(*InvalidScopeError)},
+		{name: "wrong secret", clientId: credentials.ClientId, secret: "wrong",
+			wantErr: new(*InvalidClientError)},
+		{name: "unknown client", clientId: "unknown", secret: credentials.ClientSecret,
+			wantErr: new(*InvalidClientError)},
+		{name: "disabled client", clientId: disabled.ClientId, secret: disabled.ClientSecret,
+			wantErr: new(*InvalidClientError)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issued, err := s.IssueToken(&ctx, tt.clientId, tt.secret, tt.scopes)
+			if tt.wantErr != nil {
+				if !errors.As(err, tt.wantErr) {
+					t.Errorf("IssueToken() error = %v, want %T", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IssueToken() error = %v", err)
+			}
+			claims, err := tokenManager.Verify(issued.AccessToken)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Kind != token.KindService || claims.Sub != tt.clientId || len(claims.UserId) > 0 ||
+				!reflect.DeepEqual(claims.Scopes, tt.wantScopes) || issued.ExpiresIn != 5*60 {
+				t.Errorf("IssueToken() = %+v with claims %+v", issued, claims)
+			}
+		})
+	}
+}
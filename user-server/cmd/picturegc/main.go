@@ -0,0 +1,58 @@
+// picturegc removes profile pictures no profile points at anymore, using the
+// blob store and database configured for user-server:
+//
+//	picturegc -mode dry-run -grace 24h
+//	picturegc -mode delete -grace 24h -v
+//
+// It exits with 1 when the collection or a delete failed, and with 2 on
+// invalid arguments.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"user-server/profile"
+	"user-server/profile/gc"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("picturegc", flag.ContinueOnError)
+	mode := flags.String("mode", string(gc.ModeDryRun), `"dry-run" to only report orphans, "delete" to remove them`)
+	grace := flags.Duration("grace", 24*time.Hour, "keep pictures modified within this period")
+	verbose := flags.Bool("v", false, "list every orphaned picture")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	collector, err := profile.CreatePictureCollector(&gc.Options{Mode: gc.Mode(*mode), GracePeriod: *grace})
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := collector.Run(&ctx)
+	if *verbose {
+		for _, key := range report.Orphaned {
+			log.Printf("orphaned: %s", key)
+		}
+	}
+	log.Printf("%s: %s", *mode, report)
+	if err != nil {
+		log.Printf("collection failed, reason: %v", err)
+		return 1
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+// serviceclient registers a service that authenticates to user-server with
+// the client credentials grant, using the database configured for
+// user-server:
+//
+//	serviceclient -name social-server -scopes tokens:introspect
+//
+// The client id and secret are printed once, only a hash of the secret is
+// stored. It exits with 1 when the client couldn't be registered, and with 2
+// on invalid arguments.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"user-server/clients"
+	"user-server/clients/db"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("serviceclient", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the service, e.g. social-server")
+	scopes := flags.String("scopes", "", "comma separated scopes the client may request")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(*name) == 0 {
+		log.Print("-name is required")
+		return 2
+	}
+
+	ctx := context.Background()
+	db.LoadDB(&ctx)
+	credentials, err := clients.CreateClientService().Register(&ctx, *name, strings.FieldsFunc(*scopes,
+		func(r rune) bool { return r == ',' || r == ' ' }))
+	if err != nil {
+		log.Printf("failed to register client, reason: %v", err)
+		return 1
+	}
+	fmt.Printf("client id: %s\nclient secret: %s\n", credentials.ClientId, credentials.ClientSecret)
+	return 0
+}
@@ -7,4 +7,14 @@ const (
 	ProfileCollection       = "user-profile-collection"
 	UrlsCollection          = "urls-collection"
 	UserDeviceCollection    = "user-devices-collection"
+	StorageUsageCollection  = "storage-usage-collection"
+	RefreshTokenCollection  = "refresh-token-collection"
+	RevokedTokenCollection  = "revoked-token-collection"
+	ServiceClientCollection = "service-client-collection"
+)
+
+// Scopes granted to users for the routes that require them
+const (
+	EndpointsWriteScope  = "endpoints:write"
+	TokenIntrospectScope = "tokens:introspect"
 )
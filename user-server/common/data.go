@@ -5,6 +5,10 @@ type AuthenticatedUser struct {
 	EmailId     string       `json:"emailId"`
 	PhoneNumber *PhoneNumber `json:"phoneNumber"`
 	ApiKey      string       `json:"apiKey"`
+	// RefreshToken exchanges for a new ApiKey once it expires, ExpiresIn
+	// is the lifetime of the ApiKey in seconds.
+	RefreshToken string `json:"refreshToken,omitempty"`
+	ExpiresIn    int64  `json:"expiresIn,omitempty"`
 }
 
 type PhoneNumber struct {
@@ -16,7 +20,7 @@ type Device struct {
 	SerialNumber string     `json:"serialNumber"`
 	Name         string     `json:"name"`
 	OS           string     `json:"os"`
-	FingerPrint  string     `json:"fingerPrint"`
+	FingerPrint  string     `json:"fingerPrint" binding:"required"`
 	DeviceType   DeviceType `json:"deviceType"`
 }
 
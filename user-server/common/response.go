@@ -57,3 +57,43 @@ func Unauthorized(ctx *gin.Context, code, message string) {
 	}
 	ctx.AbortWithStatusJSON(http.StatusUnauthorized, response)
 }
+
+func Forbidden(ctx *gin.Context, code, message string) {
+	response := &Result{
+		Code:    code,
+		Message: message,
+	}
+	ctx.AbortWithStatusJSON(http.StatusForbidden, response)
+}
+
+func UnsupportedMediaType(c *gin.Context, message string) {
+	response := &Result{
+		Code:    "unsupported-media-type",
+		Message: message,
+	}
+	c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, response)
+}
+
+func NotImplemented(c *gin.Context, message string) {
+	response := &Result{
+		Code:    "not-implemented",
+		Message: message,
+	}
+	c.AbortWithStatusJSON(http.StatusNotImplemented, response)
+}
+
+func PayloadTooLarge(c *gin.Context, message string) {
+	response := &Result{
+		Code:    "payload-too-large",
+		Message: message,
+	}
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, response)
+}
+
+func ServiceUnavailable(c *gin.Context, code, message string) {
+	response := &Result{
+		Code:    code,
+		Message: message,
+	}
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, response)
+}
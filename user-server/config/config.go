@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 )
 
 var Configuration *ServerConfig
@@ -20,6 +21,109 @@ type ServerConfig struct {
 	SendgridConfig *SendgridConfig
 	MongoConfig    *mongodb.MongoConfig
 	AWSConfig      *aws.AWSConfig
+	BlobConfig     *BlobConfig
+	ProfileConfig  *ProfileConfig
+	JwtConfig      *JwtConfig
+	TokenConfig    *TokenConfig
+}
+
+// TokenConfig sets the lifetime of access and service tokens in minutes and
+// of refresh tokens in hours. RevocationRefreshInterval is how often, in
+// seconds, revocations made by other instances are loaded.
+type TokenConfig struct {
+	AccessTokenTTL            int
+	RefreshTokenTTL           int
+	ServiceTokenTTL           int
+	RevocationRefreshInterval int
+}
+
+// JwtConfig lists PEM key files as "kid:path,kid:path". Tokens are signed
+// with SigningKeyId, or with HS512 and SECRET_KEY when it's empty, and
+// PublicKeys only verify, e.g. while a retired signing key's tokens expire.
+// AcceptLegacySecret keeps SECRET_KEY verifying next to SigningKeyId, the
+// tokens it verifies are granted no scopes and are never service tokens.
+//
+// Tokens are verified against Issuer and Audience when set, Algorithms and
+// RequiredClaims are comma separated lists and Leeway is in seconds.
+//
+// Format is "jwt", "paseto-public", signed with the Ed25519 key
+// SigningKeyId, or "paseto-local", encrypted with the base64 PasetoLocalKey.
+// Every service holding that key can mint paseto-local tokens, so they are
+// verified without scopes and never as service tokens.
+type JwtConfig struct {
+	Format             string
+	PasetoLocalKey     string
+	SigningKeyId       string
+	AcceptLegacySecret bool
+	PrivateKeys        string
+	PublicKeys         string
+	Issuer             string
+	Audience           string
+	Algorithms         []string
+	RequiredClaims     []string
+	Leeway             int
+}
+
+type ProfileConfig struct {
+	// PictureRetention is the number of picture versions kept per user
+	PictureRetention int
+	GCConfig         *PictureGCConfig
+}
+
+// PictureGCConfig schedules the orphaned picture collection, durations are
+// in minutes and an Interval of 0 disables it. Mode is "dry-run" or "delete".
+type PictureGCConfig struct {
+	Interval    int
+	GracePeriod int
+	Mode        string
+}
+
+type BlobConfig struct {
+	Store    string
+	LocalDir string
+	// Replicas and Consistency configure the "replicated" store, Replicas
+	// lists the stores in read priority order, e.g. "s3,gcs".
+	Replicas    []string
+	Consistency string
+	GCSConfig   *GCSConfig
+	// EncryptionKeyId and EncryptionKeys enable client-side encryption,
+	// keys are given as "id:base64key,id:base64key". EncryptionAllowPlaintext
+	// serves unencrypted objects while a bucket is being migrated.
+	EncryptionKeyId          string
+	EncryptionKeys           string
+	EncryptionAllowPlaintext bool
+	CacheConfig              *BlobCacheConfig
+	RetryConfig              *BlobRetryConfig
+	PolicyConfig             *BlobPolicyConfig
+}
+
+// BlobPolicyConfig limits uploads, sizes are in bytes and a UserQuota of 0 is
+// unlimited. MaxObjectSize is required, uploads are buffered up to it.
+type BlobPolicyConfig struct {
+	MaxObjectSize       int64
+	AllowedContentTypes []string
+	UserQuota           int64
+}
+
+type BlobCacheConfig struct {
+	Enabled      bool
+	MaxBytes     int64
+	Dir          string
+	ValidateETag bool
+}
+
+// BlobRetryConfig durations are in milliseconds, MaxAttempts of 1 disables
+// retries and an AttemptTimeout of 0 leaves attempts unbounded.
+type BlobRetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff int
+	MaxBackoff     int
+	AttemptTimeout int
+}
+
+type GCSConfig struct {
+	CredentialsFile string
+	BucketName      string
 }
 
 type Msg91Config struct {
@@ -59,17 +163,130 @@ func loadConfig() {
 		SendgridConfig: getSendgridConfig(),
 		MongoConfig:    getMongoConfig(),
 		AWSConfig:      getAWSConfig(),
+		BlobConfig:     getBlobConfig(),
+		ProfileConfig:  getProfileConfig(),
+		JwtConfig: &JwtConfig{
+			SigningKeyId:       os.Getenv("JWT_SIGNING_KEY_ID"),
+			AcceptLegacySecret: os.Getenv("JWT_ACCEPT_LEGACY_SECRET") == "true",
+			PrivateKeys:        os.Getenv("JWT_PRIVATE_KEYS"),
+			PublicKeys:         os.Getenv("JWT_PUBLIC_KEYS"),
+			Format:             getTokenFormat(),
+			PasetoLocalKey:     os.Getenv("PASETO_LOCAL_KEY"),
+			Issuer:             os.Getenv("JWT_ISSUER"),
+			Audience:           os.Getenv("JWT_AUDIENCE"),
+			Algorithms:         getList(os.Getenv("JWT_ALGORITHMS")),
+			RequiredClaims:     getList(os.Getenv("JWT_REQUIRED_CLAIMS")),
+			Leeway:             getInt("JWT_LEEWAY_SECONDS", 0),
+		},
+		TokenConfig: &TokenConfig{
+			AccessTokenTTL:            getInt("ACCESS_TOKEN_TTL_MINUTES", 15),
+			RefreshTokenTTL:           getInt("REFRESH_TOKEN_TTL_HOURS", 30*24),
+			ServiceTokenTTL:           getInt("SERVICE_TOKEN_TTL_MINUTES", 5),
+			RevocationRefreshInterval: getInt("REVOCATION_REFRESH_INTERVAL_SECONDS", 30),
+		},
 	}
 }
 
 func getAWSConfig() *aws.AWSConfig {
 	return &aws.AWSConfig{
-		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
-		AccessKeySecret: os.Getenv("AWS_ACCESS_KEY_SECRET"),
-		Region:          os.Getenv("AWS_REGION"),
-		BucketName:      os.Getenv("AWS_BUCKET_NAME"),
-		UploadTimeout:   1000000,
-		BaseURL:         os.Getenv("AWS_BASE_URL"),
+		AccessKeyID:      os.Getenv("AWS_ACCESS_KEY_ID"),
+		AccessKeySecret:  os.Getenv("AWS_ACCESS_KEY_SECRET"),
+		Region:           os.Getenv("AWS_REGION"),
+		BucketName:       os.Getenv("AWS_BUCKET_NAME"),
+		UploadTimeout:    getInt("AWS_UPLOAD_TIMEOUT_MS", 1000000),
+		OperationTimeout: getInt("AWS_OPERATION_TIMEOUT_MS", 30000),
+		Endpoint:         os.Getenv("AWS_ENDPOINT"),
+		ForcePathStyle:   os.Getenv("AWS_S3_FORCE_PATH_STYLE") == "true",
+	}
+}
+
+func getBlobConfig() *BlobConfig {
+	store := os.Getenv("BLOB_STORE")
+	if store == "" {
+		store = "s3"
+	}
+	return &BlobConfig{
+		Store:       store,
+		LocalDir:    os.Getenv("LOCAL_BLOB_DIR"),
+		Replicas:    getList(os.Getenv("BLOB_REPLICAS")),
+		Consistency: os.Getenv("BLOB_CONSISTENCY"),
+		GCSConfig: &GCSConfig{
+			CredentialsFile: os.Getenv("GCS_CREDENTIALS_FILE"),
+			BucketName:      os.Getenv("GCS_BUCKET_NAME"),
+		},
+		EncryptionKeyId:          os.Getenv("BLOB_ENCRYPTION_KEY_ID"),
+		EncryptionKeys:           os.Getenv("BLOB_ENCRYPTION_KEYS"),
+		EncryptionAllowPlaintext: os.Getenv("BLOB_ENCRYPTION_ALLOW_PLAINTEXT") == "true",
+		CacheConfig:              getBlobCacheConfig(),
+		RetryConfig: &BlobRetryConfig{
+			MaxAttempts:    getInt("BLOB_RETRY_MAX_ATTEMPTS", 3),
+			InitialBackoff: getInt("BLOB_RETRY_INITIAL_BACKOFF_MS", 100),
+			MaxBackoff:     getInt("BLOB_RETRY_MAX_BACKOFF_MS", 2000),
+			AttemptTimeout: getInt("BLOB_RETRY_ATTEMPT_TIMEOUT_MS", 0),
+		},
+		PolicyConfig: &BlobPolicyConfig{
+			MaxObjectSize:       int64(getInt("BLOB_MAX_OBJECT_SIZE", 10<<20)),
+			AllowedContentTypes: getList(os.Getenv("BLOB_ALLOWED_CONTENT_TYPES")),
+			UserQuota:           int64(getInt("BLOB_USER_QUOTA", 100<<20)),
+		},
+	}
+}
+
+func getBlobCacheConfig() *BlobCacheConfig {
+	maxBytes, err := strconv.ParseInt(os.Getenv("BLOB_CACHE_MAX_BYTES"), 10, 64)
+	if err != nil {
+		maxBytes = 64 << 20
+	}
+	return &BlobCacheConfig{
+		Enabled:      os.Getenv("BLOB_CACHE_ENABLED") == "true",
+		MaxBytes:     maxBytes,
+		Dir:          os.Getenv("BLOB_CACHE_DIR"),
+		ValidateETag: os.Getenv("BLOB_CACHE_VALIDATE_ETAG") != "false",
+	}
+}
+
+func getTokenFormat() string {
+	format := os.Getenv("TOKEN_FORMAT")
+	if format == "" {
+		format = "jwt"
+	}
+	return format
+}
+
+func getInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getProfileConfig() *ProfileConfig {
+	retention, err := strconv.Atoi(os.Getenv("PICTURE_VERSION_RETENTION"))
+	if err != nil {
+		retention = 5
+	}
+	gcMode := os.Getenv("PICTURE_GC_MODE")
+	if gcMode == "" {
+		gcMode = "dry-run"
+	}
+	return &ProfileConfig{
+		PictureRetention: retention,
+		GCConfig: &PictureGCConfig{
+			Interval:    getInt("PICTURE_GC_INTERVAL_MINUTES", 0),
+			GracePeriod: getInt("PICTURE_GC_GRACE_PERIOD_MINUTES", 24*60),
+			Mode:        gcMode,
+		},
 	}
 }
 
@@ -2,14 +2,17 @@ package endpoints
 
 import (
 	"github.com/gin-gonic/gin"
+	"user-server/auth"
 	"user-server/common"
 	"user-server/config"
 	"user-server/endpoints/db"
 	"user-server/endpoints/handlers"
 	"user-server/endpoints/service"
+	"user-server/tokens"
 )
 
 var handler *handlers.UrlHandler
+var authHandler *auth.AuthHandler
 
 func LoadHandlers(router *gin.Engine) {
 	mongoConfig := config.Configuration.MongoConfig
@@ -17,11 +20,13 @@ func LoadHandlers(router *gin.Engine) {
 	urlStore := db.NewUrlMongoStore(urlColl)
 	urlService := service.NewUrlService(urlStore)
 	handler = handlers.NewUrlHandler(urlService)
+	authHandler = tokens.GetAuthHandler()
 	loadRoutes(router)
 }
 
 func loadRoutes(router *gin.Engine) {
 	group := router.Group("/api/v1")
-	group.PATCH("/endpoints", handler.Upsert)
 	group.GET("/endpoints", handler.GetAll)
+	// rewriting service urls is restricted to administrators
+	group.PATCH("/endpoints", authHandler.Handle(), auth.RequireScopes(common.EndpointsWriteScope), handler.Upsert)
 }
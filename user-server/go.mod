@@ -27,6 +27,7 @@ require (
 	github.com/gin-gonic/gin v1.10.0
 	github.com/joho/godotenv v1.5.1
 	go.mongodb.org/mongo-driver v1.16.1
+	golang.org/x/image v0.23.0
 	google.golang.org/appengine v1.6.8
 )
 
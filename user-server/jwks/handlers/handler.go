@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	token "token-manager"
+)
+
+const jwksMaxAge = "public, max-age=300"
+
+type JwksHandler struct {
+	keySet *token.KeySet
+}
+
+func NewJwksHandler(keySet *token.KeySet) *JwksHandler {
+	return &JwksHandler{
+		keySet: keySet,
+	}
+}
+
+// GetJwks serves the public keys tokens are verified with. Verifiers cache
+// them, so a new signing key should be published before it signs.
+func (j *JwksHandler) GetJwks(c *gin.Context) {
+	c.Header("Cache-Control", jwksMaxAge)
+	c.JSON(http.StatusOK, j.keySet.JWKS())
+}
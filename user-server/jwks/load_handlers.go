@@ -0,0 +1,96 @@
+package jwks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"sync"
+	"time"
+	token "token-manager"
+	"user-server/config"
+	"user-server/jwks/handlers"
+)
+
+// committedSecretKeyHash is the sha256 of the SECRET_KEY that used to be
+// committed to config/.env, anyone can sign tokens with it.
+const committedSecretKeyHash = "6a704cf08601cf0bbc47dcc4bc98551a08de880916301bb8eecf409794c70d8f"
+
+var handler *handlers.JwksHandler
+
+var keySet *token.KeySet
+var loadKeySet sync.Once
+
+func LoadHandlers(router *gin.Engine) {
+	handler = handlers.NewJwksHandler(GetKeySet())
+	loadRoutes(router)
+}
+
+// GetKeySet loads the configured keys once.
+func GetKeySet() *token.KeySet {
+	loadKeySet.Do(func() {
+		var err error
+		keySet, err = newKeySet(config.Configuration.JwtConfig, config.Configuration.SecretKey)
+		if err != nil {
+			log.Panicf("failed to load jwt keys, reason: %s", err)
+		}
+	})
+	return keySet
+}
+
+// newKeySet signs tokens with SECRET_KEY when there is no SigningKeyId. Once
+// one is configured, SECRET_KEY only verifies the tokens it signed before
+// when AcceptLegacySecret is set, which should be for no longer than they
+// take to expire, and grants them no scopes.
+func newKeySet(jwtConfig *config.JwtConfig, secretKey string) (*token.KeySet, error) {
+	var secretKeys []*token.Key
+	if len(jwtConfig.SigningKeyId) == 0 || jwtConfig.AcceptLegacySecret {
+		hash := sha256.Sum256([]byte(secretKey))
+		if hex.EncodeToString(hash[:]) == committedSecretKeyHash {
+			return nil, errors.New("SECRET_KEY is the key that was committed to the repository, replace it")
+		}
+	}
+	if len(jwtConfig.SigningKeyId) == 0 {
+		secretKeys = append(secretKeys, token.NewSecretKey("", secretKey))
+	} else if jwtConfig.AcceptLegacySecret {
+		secretKeys = append(secretKeys, token.NewLegacySecretKey("", secretKey))
+	}
+	return token.ParseKeySet(jwtConfig.SigningKeyId, jwtConfig.PrivateKeys, jwtConfig.PublicKeys, secretKeys...)
+}
+
+// GetTokenManager issues tokens in the configured format. A PASETO manager
+// only verifies tokens of its own purpose, switching the format signs out
+// access tokens of the previous one.
+func GetTokenManager() token.TokenManager {
+	jwtConfig := config.Configuration.JwtConfig
+	options := &token.VerifyOptions{
+		Algorithms:     jwtConfig.Algorithms,
+		Issuer:         jwtConfig.Issuer,
+		Audience:       jwtConfig.Audience,
+		Leeway:         time.Duration(jwtConfig.Leeway) * time.Second,
+		RequiredClaims: jwtConfig.RequiredClaims,
+	}
+	switch jwtConfig.Format {
+	case "jwt":
+		return token.NewKeySetTokenManager(GetKeySet(), options)
+	case "paseto-public":
+		manager, err := token.NewPasetoPublicTokenManager(GetKeySet(), options)
+		if err != nil {
+			log.Panicf("failed to create paseto token manager, reason: %s", err)
+		}
+		return manager
+	case "paseto-local":
+		manager, err := token.NewPasetoLocalTokenManager(jwtConfig.PasetoLocalKey, options)
+		if err != nil {
+			log.Panicf("failed to create paseto token manager, reason: %s", err)
+		}
+		return manager
+	}
+	log.Panicf("unsupported token format: %q", jwtConfig.Format)
+	return nil
+}
+
+func loadRoutes(router *gin.Engine) {
+	router.GET("/.well-known/jwks.json", handler.GetJwks)
+}
@@ -0,0 +1,125 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	token "token-manager"
+	"user-server/auth"
+	"user-server/common"
+	"user-server/config"
+)
+
+func TestNewKeySet_ForgedSecretTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	privateKeys := "ed-1:" + writeSigningKey(t)
+	secretKey := "c2VjcmV0"
+	forger, err := token.NewJwtTokenManager(secretKey)
+	if err != nil {
+		t.Fatalf("NewJwtTokenManager() error = %v", err)
+	}
+	tests := []struct {
+		name       string
+		jwtConfig  *config.JwtConfig
+		signer     func(keySet *token.KeySet) token.TokenManager
+		wantStatus int
+	}{
+		{
+			name:      "signed with the signing key",
+			jwtConfig: &config.JwtConfig{SigningKeyId: "ed-1", PrivateKeys: privateKeys},
+			signer: func(keySet *token.KeySet) token.TokenManager {
+				return token.NewKeySetTokenManager(keySet, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "signed with the secret",
+			jwtConfig:  &config.JwtConfig{SigningKeyId: "ed-1", PrivateKeys: privateKeys},
+			signer:     func(*token.KeySet) token.TokenManager { return forger },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "signed with the accepted legacy secret",
+			jwtConfig: &config.JwtConfig{SigningKeyId: "ed-1", PrivateKeys: privateKeys,
+				AcceptLegacySecret: true},
+			signer:     func(*token.KeySet) token.TokenManager { return forger },
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keySet, err := newKeySet(tt.jwtConfig, secretKey)
+			if err != nil {
+				t.Fatalf("newKeySet() error = %v", err)
+			}
+			verifier := token.NewKeySetTokenManager(keySet, nil)
+			router := gin.New()
+			router.PATCH("/api/v1/endpoints", auth.NewAuthHandler(verifier).Handle(),
+				auth.RequireScopes(common.EndpointsWriteScope), ok)
+			router.POST("/api/v1/auth/introspect", auth.NewServiceAuthHandler(verifier, nil).Handle(),
+				auth.RequireScopes(common.TokenIntrospectScope), ok)
+
+			signer := tt.signer(keySet)
+			userToken := signToken(t, signer, token.KindUser, common.EndpointsWriteScope)
+			if status := serve(router, http.MethodPatch, "/api/v1/endpoints", userToken); status != tt.wantStatus {
+				t.Errorf("PATCH /api/v1/endpoints status = %d, want %d", status, tt.wantStatus)
+			}
+			serviceToken := signToken(t, signer, token.KindService, common.TokenIntrospectScope)
+			if status := serve(router, http.MethodPost, "/api/v1/auth/introspect", serviceToken); status != tt.wantStatus {
+				t.Errorf("POST /api/v1/auth/introspect status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNewKeySet_CommittedSecret(t *testing.T) {
+	committed := "uNxxCyuO5i1YvM6QpwTsnq5njXwYjnun7k8zMT7vZsO6YD9CiZlOBcJwxQpUfrh5ZMZ6BgDXn4NK2vwweMTaT0rkCJuGnray"
+	if _, err := newKeySet(&config.JwtConfig{}, committed); err == nil {
+		t.Errorf("newKeySet() with the committed secret error = nil")
+	}
+	jwtConfig := &config.JwtConfig{SigningKeyId: "ed-1", PrivateKeys: "ed-1:" + writeSigningKey(t)}
+	if _, err := newKeySet(jwtConfig, committed); err != nil {
+		t.Errorf("newKeySet() with an unused committed secret error = %v", err)
+	}
+}
+
+func ok(c *gin.Context) {
+	c.Status(http.StatusOK)
+}
+
+func signToken(t *testing.T, signer token.TokenManager, kind string, scope string) string {
+	iat := time.Now()
+	exp := iat.Add(time.Minute)
+	apiToken, err := signer.Generate(&token.TokenClaims{UserId: "attacker", IAT: &iat, EXP: &exp, Kind: kind,
+		Scopes: []string{scope}})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	return apiToken
+}
+
+func serve(router *gin.Engine, method string, path string, apiToken string) int {
+	request := httptest.NewRequest(method, path, nil)
+	request.Header.Set("Authorization", "Bearer "+apiToken)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func writeSigningKey(t *testing.T) string {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	path := filepath.Join(t.TempDir(), "ed.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
@@ -10,13 +10,18 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"user-server/authenticator"
+	"user-server/clients"
+	clientsDb "user-server/clients/db"
 	"user-server/config"
 	"user-server/endpoints"
 	endpointsdb "user-server/endpoints/db"
+	"user-server/jwks"
 	"user-server/profile"
 	profileDb "user-server/profile/db"
 	"user-server/signin"
 	"user-server/signup"
+	"user-server/tokens"
+	tokensDb "user-server/tokens/db"
 )
 
 func main() {
@@ -38,6 +43,14 @@ func main() {
 	endpointsdb.LoadDB(&ctx)
 	endpoints.LoadHandlers(router)
 
+	jwks.LoadHandlers(router)
+
+	tokensDb.LoadDB(&ctx)
+	tokens.LoadHandlers(router)
+
+	clientsDb.LoadDB(&ctx)
+	clients.LoadHandlers(router)
+
 	// Health
 	public := router.Group("/api/v1")
 	public.GET("/health", Health)
@@ -5,12 +5,23 @@ import (
 	"time"
 )
 
+// Profile keeps every stored picture in PictureVersions, PictureVersion is
+// the current one and empty when the picture was removed. Profiles from
+// before versioning have neither, their picture is stored under the userId.
 type Profile struct {
-	UserId           string     `bson:"userId"`
-	FirstName        string     `bson:"firstName"`
-	LastName         string     `bson:"lastName"`
-	UpdatedOn        *time.Time `bson:"updatedOn"`
-	PictureUpdatedOn *time.Time `bson:"pictureUpdatedOn"`
+	UserId           string           `bson:"userId"`
+	FirstName        string           `bson:"firstName"`
+	LastName         string           `bson:"lastName"`
+	UpdatedOn        *time.Time       `bson:"updatedOn"`
+	PictureUpdatedOn *time.Time       `bson:"pictureUpdatedOn"`
+	PictureVersion   string           `bson:"pictureVersion,omitempty"`
+	PictureVersions  []PictureVersion `bson:"pictureVersions,omitempty"`
+}
+
+type PictureVersion struct {
+	VersionId   string    `bson:"versionId"`
+	ContentType string    `bson:"contentType"`
+	CreatedOn   time.Time `bson:"createdOn"`
 }
 
 type ProfileStore interface {
@@ -18,4 +29,7 @@ type ProfileStore interface {
 	Get(ctx *context.Context, userId string) (*Profile, error)
 	GetByUserId(ctx *context.Context, userId string, time time.Time) (*Profile, error)
 	Delete(ctx *context.Context, userId string) error
+	AddPictureVersion(ctx *context.Context, userId string, version *PictureVersion) error
+	SetPictureVersion(ctx *context.Context, userId string, versionId string, updatedOn time.Time) error
+	RemovePictureVersions(ctx *context.Context, userId string, versionIds []string) error
 }
@@ -33,4 +33,16 @@ func LoadDB(ctx *context.Context) {
 	if err != nil {
 		log.Panicf("failed to create index on %s, reason: %s", common.ProfileCollection, err)
 	}
+
+	usageColl, err := mongoConfig.GetCollection(common.StorageUsageCollection)
+	if err != nil {
+		log.Panicf("failed to get collection %s , because of %s", common.StorageUsageCollection, err.Error())
+	}
+	_, err = usageColl.Indexes().CreateOne(*ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}},
+		Options: options.Index().SetName("userId-index").SetUnique(true),
+	})
+	if err != nil {
+		log.Panicf("failed to create index on %s, reason: %s", common.StorageUsageCollection, err)
+	}
 }
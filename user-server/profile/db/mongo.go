@@ -81,6 +81,59 @@ func (p *MongoProfileStore) GetByUserId(ctx *context.Context, userId string,
 	return &result, err
 }
 
+// AddPictureVersion records version and makes it the current picture.
+func (p *MongoProfileStore) AddPictureVersion(ctx *context.Context, userId string,
+	version *PictureVersion) error {
+	filter := bson.D{{
+		Key: "userId", Value: userId,
+	}}
+	update := bson.D{
+		{Key: "$push", Value: bson.D{{Key: "pictureVersions", Value: version}}},
+		{Key: "$set", Value: bson.D{
+			{Key: "pictureVersion", Value: version.VersionId},
+			{Key: "pictureUpdatedOn", Value: version.CreatedOn},
+		}},
+	}
+	_, err := p.profileColl.UpdateOne(*ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// SetPictureVersion makes an existing version the current picture, an empty
+// versionId removes the current picture and keeps the history.
+func (p *MongoProfileStore) SetPictureVersion(ctx *context.Context, userId string,
+	versionId string, updatedOn time.Time) error {
+	filter := bson.D{{
+		Key: "userId", Value: userId,
+	}}
+	if len(versionId) > 0 {
+		filter = append(filter, bson.E{Key: "pictureVersions.versionId", Value: versionId})
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "pictureVersion", Value: versionId},
+		{Key: "pictureUpdatedOn", Value: updatedOn},
+	}}}
+	result, err := p.profileColl.UpdateOne(*ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return &common.NotFoundError{Message: "Profile picture version not found"}
+	}
+	return nil
+}
+
+func (p *MongoProfileStore) RemovePictureVersions(ctx *context.Context, userId string,
+	versionIds []string) error {
+	filter := bson.D{{
+		Key: "userId", Value: userId,
+	}}
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "pictureVersions", Value: bson.D{
+		{Key: "versionId", Value: bson.D{{Key: "$in", Value: versionIds}}},
+	}}}}}
+	_, err := p.profileColl.UpdateOne(*ctx, filter, update)
+	return err
+}
+
 func (p *MongoProfileStore) Delete(ctx *context.Context, userId string) error {
 	filter := bson.D{{
 		Key: "userId", Value: userId,
@@ -195,3 +195,106 @@ func TestMongoProfileStoreIntegration_Delete(t *testing.T) {
 		t.Error("Delete() failed - profile still exists")
 	}
 }
+
+func TestMongoProfileStoreIntegration_PictureVersions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	config := &mongodb.MongoConfig{
+		ConnectionString: "mongodb://localhost:27017",
+		Database:         "user-server-test",
+	}
+
+	coll, err := config.GetCollection("profile-versions-integration-test")
+	if err != nil {
+		t.Fatalf("failed to get collection: %v", err)
+	}
+	defer coll.Drop(ctx)
+
+	store := NewMongoProfileStore(coll)
+	now := time.Now().Truncate(time.Millisecond)
+	for i, versionId := range []string{"v1", "v2", "v3"} {
+		version := &PictureVersion{
+			VersionId:   versionId,
+			ContentType: "image/png",
+			CreatedOn:   now.Add(time.Duration(i) * time.Second),
+		}
+		if err := store.AddPictureVersion(&ctx, "user-versions", version); err != nil {
+			t.Fatalf("AddPictureVersion() error = %v", err)
+		}
+	}
+
+	profile, err := store.Get(&ctx, "user-versions")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if profile.PictureVersion != "v3" || len(profile.PictureVersions) != 3 {
+		t.Errorf("Get() got version %s with %d versions, want v3 with 3", profile.PictureVersion,
+			len(profile.PictureVersions))
+	}
+
+	if err := store.SetPictureVersion(&ctx, "user-versions", "v1", time.Now()); err != nil {
+		t.Errorf("SetPictureVersion() error = %v", err)
+	}
+	if err := store.SetPictureVersion(&ctx, "user-versions", "missing", time.Now()); err == nil {
+		t.Errorf("SetPictureVersion() with unknown version error = nil, want NotFoundError")
+	}
+	if err := store.RemovePictureVersions(&ctx, "user-versions", []string{"v2", "v3"}); err != nil {
+		t.Errorf("RemovePictureVersions() error = %v", err)
+	}
+
+	profile, err = store.Get(&ctx, "user-versions")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if profile.PictureVersion != "v1" || len(profile.PictureVersions) != 1 {
+		t.Errorf("Get() got version %s with %v, want v1 only", profile.PictureVersion, profile.PictureVersions)
+	}
+}
+
+func TestMongoStorageUsageStoreIntegration_Set(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	config := &mongodb.MongoConfig{
+		ConnectionString: "mongodb://localhost:27017",
+		Database:         "user-server-test",
+	}
+
+	coll, err := config.GetCollection("storage-usage-integration-test")
+	if err != nil {
+		t.Fatalf("failed to get collection: %v", err)
+	}
+	defer coll.Drop(ctx)
+
+	store := NewMongoStorageUsageStore(coll)
+	steps := []struct {
+		fileName     string
+		size         int64
+		wantErr      bool
+		wantPrevious int64
+		wantBytes    int64
+	}{
+		{fileName: "a", size: 60, wantBytes: 60},
+		{fileName: "b", size: 40, wantBytes: 100},
+		{fileName: "c", size: 1, wantErr: true, wantBytes: 100},
+		{fileName: "a", size: 30, wantPrevious: 60, wantBytes: 70},
+		{fileName: "a", size: 60, wantPrevious: 30, wantBytes: 100},
+		{fileName: "b", size: 0, wantPrevious: 40, wantBytes: 60},
+		{fileName: "b", size: 0, wantBytes: 60},
+	}
+	for _, step := range steps {
+		previous, err := store.Set(&ctx, "user-usage", step.fileName, step.size, 100)
+		if (err != nil) != step.wantErr || previous != step.wantPrevious {
+			t.Errorf("Set(%s, %d) = %d, %v, want %d, wantErr %v", step.fileName, step.size, previous, err,
+				step.wantPrevious, step.wantErr)
+		}
+		if got, _ := store.Get(&ctx, "user-usage"); got != step.wantBytes {
+			t.Errorf("Get() after Set(%s, %d) = %d, want %d", step.fileName, step.size, got, step.wantBytes)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	blobError "blob-manager/common"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StorageUsage is the number of blob bytes stored for a user, and the size
+// of each of their objects.
+type StorageUsage struct {
+	UserId  string        `bson:"userId"`
+	Bytes   int64         `bson:"bytes"`
+	Objects []ObjectUsage `bson:"objects"`
+}
+
+type ObjectUsage struct {
+	Name string `bson:"name"`
+	Size int64  `bson:"size"`
+}
+
+// MongoStorageUsageStore implements blobmanager.UsageStore, replacing the
+// size of an object and checking the quota is a single conditional update.
+type MongoStorageUsageStore struct {
+	usageColl *mongo.Collection
+}
+
+func NewMongoStorageUsageStore(usageColl *mongo.Collection) *MongoStorageUsageStore {
+	return &MongoStorageUsageStore{
+		usageColl: usageColl,
+	}
+}
+
+func (m *MongoStorageUsageStore) Get(ctx *context.Context, userId string) (int64, error) {
+	filter := bson.D{{Key: "userId", Value: userId}}
+	var usage StorageUsage
+	err := m.usageColl.FindOne(*ctx, filter).Decode(&usage)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return usage.Bytes, nil
+}
+
+func (m *MongoStorageUsageStore) Set(ctx *context.Context, userId string, fileName string,
+	size int64, limit int64) (int64, error) {
+	// create the document first, so the conditional update can match it
+	filter := bson.D{{Key: "userId", Value: userId}}
+	_, err := m.usageColl.UpdateOne(*ctx, filter,
+		bson.D{{Key: "$setOnInsert", Value: bson.D{{Key: "bytes", Value: int64(0)}, {Key: "objects", Value: bson.A{}}}}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return 0, err
+	}
+
+	objects := bson.D{{Key: "$ifNull", Value: bson.A{"$objects", bson.A{}}}}
+	previous := bson.D{{Key: "$reduce", Value: bson.D{
+		{Key: "input", Value: objects},
+		{Key: "initialValue", Value: int64(0)},
+		{Key: "in", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{"$$this.name", fileName}}}, "$$this.size", "$$value"}}}},
+	}}}
+	bytes := bson.D{{Key: "$add", Value: bson.A{
+		bson.D{{Key: "$ifNull", Value: bson.A{"$bytes", int64(0)}}},
+		bson.D{{Key: "$subtract", Value: bson.A{size, previous}}}}}}
+	others := bson.D{{Key: "$filter", Value: bson.D{
+		{Key: "input", Value: objects},
+		{Key: "cond", Value: bson.D{{Key: "$ne", Value: bson.A{"$$this.name", fileName}}}},
+	}}}
+	replaced := bson.A{}
+	if size > 0 {
+		replaced = bson.A{bson.D{{Key: "name", Value: fileName}, {Key: "size", Value: size}}}
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "bytes", Value: bson.D{{Key: "$max", Value: bson.A{int64(0), bytes}}}},
+		{Key: "objects", Value: bson.D{{Key: "$concatArrays", Value: bson.A{others, replaced}}}},
+	}}}}
+	if limit > 0 {
+		// shrinking is always allowed, growing only within the limit
+		filter = append(filter, bson.E{Key: "$expr", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "$lte", Value: bson.A{size, previous}}},
+			bson.D{{Key: "$lte", Value: bson.A{bytes, limit}}},
+		}}}})
+	}
+
+	var before StorageUsage
+	err = m.usageColl.FindOneAndUpdate(*ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		used, _ := m.Get(ctx, userId)
+		return 0, &blobError.QuotaExceededError{
+			Owner:   userId,
+			Message: fmt.Sprintf("%d of %d bytes used, %d for %s requested", used, limit, size, fileName)}
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, object := range before.Objects {
+		if object.Name == fileName {
+			return object.Size, nil
+		}
+	}
+	return 0, nil
+}
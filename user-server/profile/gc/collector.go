@@ -0,0 +1,164 @@
+package gc
+
+import (
+	blobmanager "blob-manager"
+	blobError "blob-manager/common"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"user-server/common"
+	"user-server/profile/db"
+	"user-server/profile/service"
+)
+
+type Mode string
+
+const (
+	// ModeDryRun only reports the orphaned pictures.
+	ModeDryRun Mode = "dry-run"
+	// ModeDelete deletes the orphaned pictures.
+	ModeDelete Mode = "delete"
+)
+
+// Options configure a collection. Blobs modified within GracePeriod are kept,
+// a picture is stored before its version is recorded on the profile.
+type Options struct {
+	Mode        Mode
+	GracePeriod time.Duration
+}
+
+// Report lists the orphaned blob keys, which were deleted unless the
+// collection was a dry run.
+type Report struct {
+	Scanned    int
+	Referenced int
+	Recent     int
+	Orphaned   []string
+	Bytes      int64
+	Deleted    int
+	Failed     int
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("scanned: %d, referenced: %d, recent: %d, orphaned: %d (%d bytes), deleted: %d, failed: %d",
+		r.Scanned, r.Referenced, r.Recent, len(r.Orphaned), r.Bytes, r.Deleted, r.Failed)
+}
+
+// Collector removes profile pictures no profile points at anymore, left
+// behind by deleted profiles, pruned versions that failed to delete and
+// uploads that failed halfway.
+type Collector struct {
+	blobManager  *blobmanager.BlobManager
+	profileStore db.ProfileStore
+	options      *Options
+}
+
+func NewCollector(blobManager *blobmanager.BlobManager, profileStore db.ProfileStore,
+	options *Options) (*Collector, error) {
+	if options.Mode != ModeDryRun && options.Mode != ModeDelete {
+		return nil, fmt.Errorf("unknown collection mode: %q", options.Mode)
+	}
+	if options.GracePeriod < 0 {
+		return nil, fmt.Errorf("negative grace period: %s", options.GracePeriod)
+	}
+	return &Collector{
+		blobManager:  blobManager,
+		profileStore: profileStore,
+		options:      options,
+	}, nil
+}
+
+// Run lists every blob and cross-checks it against the owner's profile.
+// Deletes go through the blob manager, so they are taken off the owner's
+// storage usage as well.
+func (c *Collector) Run(ctx *context.Context) (*Report, error) {
+	report := &Report{}
+	now := time.Now()
+	for pageToken := ""; ; {
+		page, err := c.blobManager.List(ctx, "", pageToken)
+		if err != nil {
+			return report, err
+		}
+		// keys of one owner are listed next to each other, profiles are
+		// only looked up once per page
+		profiles := map[string]*db.Profile{}
+		for _, info := range page.Objects {
+			report.Scanned++
+			if info.LastModified.IsZero() || now.Sub(info.LastModified) < c.options.GracePeriod {
+				report.Recent++
+				continue
+			}
+			profile, err := c.getProfile(ctx, profiles, service.PictureOwner(info.Name))
+			if err != nil {
+				return report, err
+			}
+			if service.PictureReferenced(info.Name, profile) {
+				report.Referenced++
+				continue
+			}
+			report.Orphaned = append(report.Orphaned, info.Name)
+			report.Bytes += info.Size
+			if c.options.Mode == ModeDelete {
+				c.delete(ctx, info.Name, report)
+			}
+		}
+		if len(page.NextPageToken) == 0 {
+			return report, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// RunPeriodically calls Run every interval until ctx is done.
+func (c *Collector) RunPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.Run(&ctx)
+			if err != nil {
+				log.Printf("failed to collect orphaned pictures, reason: %v", err)
+			}
+			if len(report.Orphaned) > 0 || report.Failed > 0 {
+				log.Printf("collected orphaned pictures in %s mode, %s", c.options.Mode, report)
+			}
+		}
+	}
+}
+
+// getProfile returns nil when owner has no profile.
+func (c *Collector) getProfile(ctx *context.Context, profiles map[string]*db.Profile,
+	owner string) (*db.Profile, error) {
+	if len(owner) == 0 {
+		return nil, nil
+	}
+	if profile, ok := profiles[owner]; ok {
+		return profile, nil
+	}
+	profile, err := c.profileStore.Get(ctx, owner)
+	var notFoundErr *common.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		profile, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profiles[owner] = profile
+	return profile, nil
+}
+
+func (c *Collector) delete(ctx *context.Context, key string, report *Report) {
+	err := c.blobManager.Delete(ctx, key)
+	var notFoundErr *blobError.ObjectNotFound
+	if err != nil && !errors.As(err, &notFoundErr) {
+		report.Failed++
+		log.Printf("failed to delete orphaned picture: %s, reason: %v", key, err)
+		return
+	}
+	report.Deleted++
+}
@@ -0,0 +1,121 @@
+package gc
+
+import (
+	blobmanager "blob-manager"
+	"blob-manager/local"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+	"user-server/common"
+	"user-server/profile/db"
+	"user-server/profile/service"
+)
+
+type memoryProfileStore struct {
+	db.ProfileStore
+	profiles map[string]*db.Profile
+}
+
+func (m *memoryProfileStore) Get(ctx *context.Context, userId string) (*db.Profile, error) {
+	if profile, ok := m.profiles[userId]; ok {
+		return profile, nil
+	}
+	return nil, &common.NotFoundError{Message: "User Profile not found"}
+}
+
+func TestCollector_Run(t *testing.T) {
+	var ctx = context.Background()
+	now := time.Now()
+	alice, bob, carol, dave := "64b7f0c2a1e4d3b2c1a09f01", "64b7f0c2a1e4d3b2c1a09f02",
+		"64b7f0c2a1e4d3b2c1a09f03", "64b7f0c2a1e4d3b2c1a09f04"
+	profiles := &memoryProfileStore{profiles: map[string]*db.Profile{
+		alice: {UserId: alice, PictureVersion: "v2", PictureVersions: []db.PictureVersion{
+			{VersionId: "v1"}, {VersionId: "v2"}}},
+		bob: {UserId: bob, PictureUpdatedOn: &now},
+	}}
+	old := []string{
+		"pictures/" + alice + "/v1", "pictures/" + alice + "/v1_256", "pictures/" + alice + "/v2",
+		"pictures/" + alice + "/v3", "pictures/" + alice + "/v3_256",
+		"pictures/" + carol + "/v1",
+		bob, bob + "_256", carol, carol + "_64", "uploads/" + bob,
+		// not pictures, whatever their owner's profile says
+		carol + "_backup", "favicon.ico", "exports/report.csv",
+	}
+	recent := []string{"pictures/" + alice + "/v4", "pictures/" + dave + "/v1", "uploads/" + alice}
+	wantOrphaned := []string{carol, carol + "_64", "pictures/" + alice + "/v3", "pictures/" + alice + "/v3_256",
+		"pictures/" + carol + "/v1", "uploads/" + bob}
+
+	tests := []struct {
+		name        string
+		mode        Mode
+		wantDeleted int
+	}{
+		{name: "dry run", mode: ModeDryRun},
+		{name: "delete", mode: ModeDelete, wantDeleted: len(wantOrphaned)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobManager := newBlobManager(t, old, recent)
+			collector, err := NewCollector(blobManager, profiles, &Options{Mode: tt.mode, GracePeriod: time.Hour})
+			if err != nil {
+				t.Fatalf("NewCollector() error = %v", err)
+			}
+			report, err := collector.Run(&ctx)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if !slices.Equal(report.Orphaned, wantOrphaned) {
+				t.Errorf("Run() orphaned = %v, want %v", report.Orphaned, wantOrphaned)
+			}
+			if report.Scanned != len(old)+len(recent) || report.Recent != len(recent) ||
+				report.Deleted != tt.wantDeleted || report.Failed != 0 {
+				t.Errorf("Run() report = %s", report)
+			}
+			for _, key := range append(old, recent...) {
+				exists, _ := blobManager.Exists(&ctx, key)
+				if want := tt.mode == ModeDryRun || !slices.Contains(wantOrphaned, key); exists != want {
+					t.Errorf("Exists(%s) = %v, want %v", key, exists, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewCollector_InvalidOptions(t *testing.T) {
+	if _, err := NewCollector(nil, nil, &Options{Mode: "purge"}); err == nil {
+		t.Errorf("NewCollector() with unknown mode error = nil")
+	}
+	if _, err := NewCollector(nil, nil, &Options{Mode: ModeDelete, GracePeriod: -time.Hour}); err == nil {
+		t.Errorf("NewCollector() with negative grace period error = nil")
+	}
+}
+
+// newBlobManager stores old keys as modified a day ago and recent keys now.
+func newBlobManager(t *testing.T, old []string, recent []string) *blobmanager.BlobManager {
+	var ctx = context.Background()
+	dir := t.TempDir()
+	store, err := local.CreateFileSystemClient(dir)
+	if err != nil {
+		t.Fatalf("CreateFileSystemClient() error = %v", err)
+	}
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	for _, key := range append(append([]string{}, old...), recent...) {
+		content := []byte("picture")
+		file := service.NewUploadableFile(key, io.NopCloser(bytes.NewReader(content)),
+			int64(len(content)), "image/png")
+		if err := store.Upload(&ctx, file); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		if slices.Contains(old, key) {
+			if err := os.Chtimes(filepath.Join(dir, "objects", key), dayAgo, dayAgo); err != nil {
+				t.Fatalf("Chtimes() error = %v", err)
+			}
+		}
+	}
+	return &blobmanager.BlobManager{BlobStore: store}
+}
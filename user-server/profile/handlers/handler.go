@@ -3,12 +3,15 @@ package handlers
 import (
 	blobError "blob-manager/common"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 	token "token-manager"
 	"user-server/common"
+	"user-server/profile/imaging"
 	"user-server/profile/service"
 )
 
@@ -33,6 +36,9 @@ func (p *ProfileHandler) UpdateProfile(ctx *gin.Context) {
 	requestCtx := ctx.Request.Context()
 	err := p.profileService.UpsertProfile(&requestCtx, userId, &userProfile)
 	if err != nil {
+		if handlePictureError(ctx, err) {
+			return
+		}
 		var uploadErr *blobError.UploadError
 		if errors.As(err, &uploadErr) {
 			common.InternalError(ctx, "Profile Picture Upload failed")
@@ -47,9 +53,13 @@ func (p *ProfileHandler) UpdateProfile(ctx *gin.Context) {
 
 func (p *ProfileHandler) GetProfile(ctx *gin.Context) {
 	userId := getUserIdFromContext(ctx)
+	pictureSize, ok := getPictureSize(ctx)
+	if !ok {
+		return
+	}
 
 	requestCtx := ctx.Request.Context()
-	profile, err := p.profileService.GetProfileByUserId(&requestCtx, userId)
+	profile, err := p.profileService.GetProfileByUserId(&requestCtx, userId, pictureSize)
 	if err != nil {
 		var notFoundErr *common.NotFoundError
 		if errors.As(err, &notFoundErr) {
@@ -75,10 +85,14 @@ func (p *ProfileHandler) GetProfile(ctx *gin.Context) {
 
 func (p *ProfileHandler) GetProfileByUserId(ctx *gin.Context) {
 	userId := getUserIdFromContext(ctx)
+	pictureSize, ok := getPictureSize(ctx)
+	if !ok {
+		return
+	}
 
 	requestCtx := ctx.Request.Context()
 	providedTime := epochToTime(ctx.Param("time"))
-	profile, err := p.profileService.GetProfile(&requestCtx, userId, providedTime)
+	profile, err := p.profileService.GetProfile(&requestCtx, userId, providedTime, pictureSize)
 	if err != nil {
 		var notFoundErr *common.NotFoundError
 		if errors.As(err, &notFoundErr) {
@@ -103,6 +117,141 @@ func (p *ProfileHandler) GetProfileByUserId(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, profile)
 }
 
+type PictureUploadRequest struct {
+	ContentType string `json:"contentType" binding:"required"`
+}
+
+func (p *ProfileHandler) GetPictureUploadUrl(ctx *gin.Context) {
+	userId := getUserIdFromContext(ctx)
+	var request PictureUploadRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		common.BadRequest(ctx, "bad-request", "Failed to parse request body")
+		return
+	}
+
+	requestCtx := ctx.Request.Context()
+	uploadUrl, err := p.profileService.GetPictureUploadUrl(&requestCtx, userId, request.ContentType)
+	if err != nil {
+		if handlePictureError(ctx, err) {
+			return
+		}
+		var unsupportedErr *blobError.UnsupportedOperationError
+		if errors.As(err, &unsupportedErr) {
+			common.NotImplemented(ctx, "Direct profile picture uploads are not supported")
+			return
+		}
+		common.InternalError(ctx, "Failed to create upload url, reason: "+err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, uploadUrl)
+}
+
+func (p *ProfileHandler) CommitProfilePicture(ctx *gin.Context) {
+	userId := getUserIdFromContext(ctx)
+
+	requestCtx := ctx.Request.Context()
+	err := p.profileService.CommitProfilePicture(&requestCtx, userId)
+	if err != nil {
+		if handlePictureError(ctx, err) {
+			return
+		}
+		var notFoundErr *common.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			common.NotFound(ctx, err.Error())
+			return
+		}
+		common.InternalError(ctx, "Failed to commit profile picture, reason: "+err.Error())
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (p *ProfileHandler) ListPictureVersions(ctx *gin.Context) {
+	userId := getUserIdFromContext(ctx)
+
+	requestCtx := ctx.Request.Context()
+	versions, err := p.profileService.ListPictureVersions(&requestCtx, userId)
+	if err != nil {
+		var notFoundErr *common.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			common.NotFound(ctx, err.Error())
+			return
+		}
+		common.InternalError(ctx, "Failed to list profile pictures, reason: "+err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, versions)
+}
+
+func (p *ProfileHandler) RestorePictureVersion(ctx *gin.Context) {
+	userId := getUserIdFromContext(ctx)
+
+	requestCtx := ctx.Request.Context()
+	err := p.profileService.RestorePictureVersion(&requestCtx, userId, ctx.Param("versionId"))
+	if err != nil {
+		var notFoundErr *common.NotFoundError
+		if errors.As(err, &notFoundErr) {
+			common.NotFound(ctx, err.Error())
+			return
+		}
+		common.InternalError(ctx, "Failed to restore profile picture, reason: "+err.Error())
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// handlePictureError responds to pictures rejected by the image pipeline or
+// the upload policy and reports whether err was one.
+func handlePictureError(ctx *gin.Context, err error) bool {
+	var formatErr *imaging.UnsupportedFormatError
+	if errors.As(err, &formatErr) {
+		common.UnsupportedMediaType(ctx, err.Error())
+		return true
+	}
+	var tooLargeErr *imaging.TooLargeError
+	if errors.As(err, &tooLargeErr) {
+		common.PayloadTooLarge(ctx, err.Error())
+		return true
+	}
+	var invalidErr *imaging.InvalidImageError
+	if errors.As(err, &invalidErr) {
+		common.BadRequest(ctx, "invalid-picture", err.Error())
+		return true
+	}
+	var contentTypeErr *blobError.ContentTypeNotAllowedError
+	if errors.As(err, &contentTypeErr) {
+		common.UnsupportedMediaType(ctx, err.Error())
+		return true
+	}
+	var objectTooLargeErr *blobError.ObjectTooLargeError
+	var quotaErr *blobError.QuotaExceededError
+	if errors.As(err, &objectTooLargeErr) || errors.As(err, &quotaErr) {
+		common.PayloadTooLarge(ctx, err.Error())
+		return true
+	}
+	return false
+}
+
+// getPictureSize reads the optional size query parameter, the original
+// picture is returned without it.
+func getPictureSize(ctx *gin.Context) (int, bool) {
+	size := ctx.Query("size")
+	if len(size) == 0 {
+		return 0, true
+	}
+	pictureSize, err := strconv.Atoi(size)
+	if err == nil && slices.Contains(imaging.RenditionSizes, pictureSize) {
+		return pictureSize, true
+	}
+	common.BadRequest(ctx, "invalid-picture-size",
+		fmt.Sprintf("Picture size must be one of %v", imaging.RenditionSizes))
+	return 0, false
+}
+
 func epochToTime(epoch string) time.Time {
 	epochTime, _ := strconv.ParseInt(epoch, 10, 64)
 	return time.UnixMilli(epochTime)
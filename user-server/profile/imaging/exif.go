@@ -0,0 +1,108 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+const orientationTag = 0x0112
+
+// exifOrientation returns the EXIF orientation of a JPEG, 1 (upright) when
+// it has none or the EXIF block can't be read.
+func exifOrientation(content []byte) int {
+	offset := 2
+	for offset+4 <= len(content) {
+		if content[offset] != 0xFF {
+			return 1
+		}
+		marker := content[offset+1]
+		// start of scan, the markers before it hold all metadata
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(content[offset+2:]))
+		end := offset + 2 + length
+		if length < 2 || end > len(content) {
+			return 1
+		}
+		segment := content[offset+4 : end]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		offset = end
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != orientationTag {
+			continue
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
+
+// orient turns img upright according to an EXIF orientation, orientations
+// 5 to 8 swap width and height.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	oriented := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var srcX, srcY int
+			switch orientation {
+			case 2:
+				srcX, srcY = width-1-x, y
+			case 3:
+				srcX, srcY = width-1-x, height-1-y
+			case 4:
+				srcX, srcY = x, height-1-y
+			case 5:
+				srcX, srcY = y, x
+			case 6:
+				srcX, srcY = y, height-1-x
+			case 7:
+				srcX, srcY = width-1-y, height-1-x
+			case 8:
+				srcX, srcY = width-1-y, x
+			}
+			oriented.Set(x, y, img.At(bounds.Min.X+srcX, bounds.Min.Y+srcY))
+		}
+	}
+	return oriented
+}
@@ -0,0 +1,211 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	WebP = "image/webp"
+)
+
+// RenditionSizes are the longest sides, in pixels, of the scaled down copies
+// stored next to every picture.
+var RenditionSizes = []int{64, 256, 1024}
+
+type Options struct {
+	MaxBytes     int
+	MaxDimension int
+	Renditions   []int
+	JPEGQuality  int
+}
+
+var DefaultOptions = &Options{
+	MaxBytes:     10 << 20,
+	MaxDimension: 4096,
+	Renditions:   RenditionSizes,
+	JPEGQuality:  85,
+}
+
+// Picture is a processed picture. Original is the full size picture,
+// re-encoded, so EXIF and any other embedded metadata is gone. Renditions
+// are keyed by size and share the ContentType of the Original.
+type Picture struct {
+	ContentType string
+	Width       int
+	Height      int
+	Original    []byte
+	Renditions  map[int][]byte
+}
+
+type UnsupportedFormatError struct {
+	ContentType string
+}
+
+func (e *UnsupportedFormatError) Error() string {
+	return "unsupported picture format: " + e.ContentType
+}
+
+type TooLargeError struct {
+	Message string
+}
+
+func (e *TooLargeError) Error() string {
+	return e.Message
+}
+
+type InvalidImageError struct {
+	Message string
+}
+
+func (e *InvalidImageError) Error() string {
+	return "invalid picture, reason: " + e.Message
+}
+
+// Sniff detects the format from the magic bytes, the declared content type
+// is never trusted. It returns an empty string for anything else.
+func Sniff(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG
+	case bytes.HasPrefix(content, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG
+	case len(content) >= 12 && bytes.Equal(content[:4], []byte("RIFF")) &&
+		bytes.Equal(content[8:12], []byte("WEBP")):
+		return WebP
+	}
+	return ""
+}
+
+func IsSupported(contentType string) bool {
+	return contentType == JPEG || contentType == PNG || contentType == WebP
+}
+
+// Process validates content, applies its EXIF orientation and produces the
+// original and every rendition. WebP pictures are stored as PNG, there is no
+// WebP encoder.
+func Process(content []byte, options *Options) (*Picture, error) {
+	if len(content) > options.MaxBytes {
+		return nil, &TooLargeError{
+			Message: fmt.Sprintf("picture is %d bytes, at most %d are allowed", len(content), options.MaxBytes)}
+	}
+	format := Sniff(content)
+	if !IsSupported(format) {
+		return nil, &UnsupportedFormatError{ContentType: detectedType(content)}
+	}
+
+	// check the header before decoding, so a small file can't claim a huge canvas
+	config, err := decodeConfig(format, content)
+	if err != nil {
+		return nil, &InvalidImageError{Message: err.Error()}
+	}
+	if config.Width > options.MaxDimension || config.Height > options.MaxDimension {
+		return nil, &TooLargeError{
+			Message: fmt.Sprintf("picture is %dx%d, at most %dx%d is allowed",
+				config.Width, config.Height, options.MaxDimension, options.MaxDimension)}
+	}
+	img, err := decode(format, content)
+	if err != nil {
+		return nil, &InvalidImageError{Message: err.Error()}
+	}
+	if format == JPEG {
+		img = orient(img, exifOrientation(content))
+	}
+
+	contentType := format
+	if format == WebP {
+		contentType = PNG
+	}
+	original, err := encode(contentType, img, options)
+	if err != nil {
+		return nil, err
+	}
+	picture := &Picture{
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Original:    original,
+		Renditions:  map[int][]byte{},
+	}
+	for _, size := range options.Renditions {
+		rendition, err := encode(contentType, resize(img, size), options)
+		if err != nil {
+			return nil, err
+		}
+		picture.Renditions[size] = rendition
+	}
+	return picture, nil
+}
+
+func detectedType(content []byte) string {
+	if len(content) == 0 {
+		return "empty content"
+	}
+	return http.DetectContentType(content)
+}
+
+func decodeConfig(format string, content []byte) (image.Config, error) {
+	reader := bytes.NewReader(content)
+	switch format {
+	case JPEG:
+		return jpeg.DecodeConfig(reader)
+	case PNG:
+		return png.DecodeConfig(reader)
+	default:
+		return webp.DecodeConfig(reader)
+	}
+}
+
+func decode(format string, content []byte) (image.Image, error) {
+	reader := bytes.NewReader(content)
+	switch format {
+	case JPEG:
+		return jpeg.Decode(reader)
+	case PNG:
+		return png.Decode(reader)
+	default:
+		return webp.Decode(reader)
+	}
+}
+
+func encode(contentType string, img image.Image, options *Options) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	if contentType == JPEG {
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: options.JPEGQuality})
+	} else {
+		err = png.Encode(&buffer, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode picture, reason: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// resize scales img so its longest side is size, smaller pictures are not
+// scaled up.
+func resize(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
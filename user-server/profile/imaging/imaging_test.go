@@ -0,0 +1,186 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{name: "jpeg", content: encodeJPEG(t, 4, 4, nil), want: JPEG},
+		{name: "png", content: encodePNG(t, 4, 4), want: PNG},
+		{name: "webp", content: webpPicture(t), want: WebP},
+		{name: "gif", content: []byte("GIF89a\x01\x00\x01\x00"), want: ""},
+		{name: "empty", content: nil, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sniff(tt.content); got != tt.want {
+				t.Errorf("Sniff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         []byte
+		wantContentType string
+		wantWidth       int
+		wantHeight      int
+		wantRenditions  map[int]image.Point
+	}{
+		{
+			name:            "png",
+			content:         encodePNG(t, 300, 200),
+			wantContentType: PNG,
+			wantWidth:       300,
+			wantHeight:      200,
+			wantRenditions: map[int]image.Point{
+				64: {X: 64, Y: 42}, 256: {X: 256, Y: 170}, 1024: {X: 300, Y: 200}},
+		},
+		{
+			name:            "jpeg rotated by exif",
+			content:         encodeJPEG(t, 80, 40, exifSegment(6)),
+			wantContentType: JPEG,
+			wantWidth:       40,
+			wantHeight:      80,
+			wantRenditions: map[int]image.Point{
+				64: {X: 32, Y: 64}, 256: {X: 40, Y: 80}, 1024: {X: 40, Y: 80}},
+		},
+		{
+			name:            "webp stored as png",
+			content:         webpPicture(t),
+			wantContentType: PNG,
+			wantWidth:       1,
+			wantHeight:      1,
+			wantRenditions: map[int]image.Point{
+				64: {X: 1, Y: 1}, 256: {X: 1, Y: 1}, 1024: {X: 1, Y: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picture, err := Process(tt.content, DefaultOptions)
+			if err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if picture.ContentType != tt.wantContentType || picture.Width != tt.wantWidth ||
+				picture.Height != tt.wantHeight {
+				t.Errorf("Process() got = %s %dx%d, want %s %dx%d", picture.ContentType,
+					picture.Width, picture.Height, tt.wantContentType, tt.wantWidth, tt.wantHeight)
+			}
+			if bytes.Contains(picture.Original, []byte("Exif")) {
+				t.Errorf("Process() original still carries EXIF")
+			}
+			if Sniff(picture.Original) != tt.wantContentType {
+				t.Errorf("Process() original is %q, want %q", Sniff(picture.Original), tt.wantContentType)
+			}
+			for size, want := range tt.wantRenditions {
+				config, _, err := image.DecodeConfig(bytes.NewReader(picture.Renditions[size]))
+				if err != nil {
+					t.Fatalf("rendition %d: DecodeConfig() error = %v", size, err)
+				}
+				if config.Width != want.X || config.Height != want.Y {
+					t.Errorf("rendition %d = %dx%d, want %dx%d", size, config.Width, config.Height, want.X, want.Y)
+				}
+			}
+		})
+	}
+}
+
+func TestProcess_Rejected(t *testing.T) {
+	options := &Options{MaxBytes: 4096, MaxDimension: 100, Renditions: RenditionSizes, JPEGQuality: 85}
+	truncated := encodePNG(t, 10, 10)
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr error
+	}{
+		{name: "too many bytes", content: make([]byte, 4097), wantErr: &TooLargeError{}},
+		{name: "too many pixels", content: encodePNG(t, 101, 1), wantErr: &TooLargeError{}},
+		{name: "gif", content: []byte("GIF89a\x01\x00\x01\x00"), wantErr: &UnsupportedFormatError{}},
+		{name: "truncated png", content: truncated[:len(truncated)/2], wantErr: &InvalidImageError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Process(tt.content, options)
+			var tooLarge *TooLargeError
+			var unsupported *UnsupportedFormatError
+			var invalid *InvalidImageError
+			var matched bool
+			switch tt.wantErr.(type) {
+			case *TooLargeError:
+				matched = errors.As(err, &tooLarge)
+			case *UnsupportedFormatError:
+				matched = errors.As(err, &unsupported)
+			case *InvalidImageError:
+				matched = errors.As(err, &invalid)
+			}
+			if !matched {
+				t.Errorf("Process() error = %v, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, gradient(width, height)); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// encodeJPEG inserts segment, e.g. an EXIF block, right after the SOI marker.
+func encodeJPEG(t *testing.T, width, height int, segment []byte) []byte {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, gradient(width, height), nil); err != nil {
+		t.Fatalf("jpeg.Encode() error = %v", err)
+	}
+	encoded := buffer.Bytes()
+	return append(append(append([]byte{}, encoded[:2]...), segment...), encoded[2:]...)
+}
+
+// exifSegment is an APP1 segment holding a big endian TIFF header with a
+// single orientation entry.
+func exifSegment(orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x01,
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, orientation, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(payload) + 2
+	return append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, payload...)
+}
+
+// webpPicture is a 1x1 lossless WebP.
+func webpPicture(t *testing.T) []byte {
+	content, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if err != nil {
+		t.Fatalf("DecodeString() error = %v", err)
+	}
+	return content
+}
+
+func gradient(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
@@ -3,37 +3,204 @@ package profile
 import (
 	blob_manager "blob-manager"
 	"blob-manager/aws"
+	"blob-manager/gcs"
+	"blob-manager/local"
+	"context"
 	"github.com/gin-gonic/gin"
+	"log"
+	"time"
 	"user-server/auth"
 	"user-server/common"
 	"user-server/config"
 	"user-server/profile/db"
+	"user-server/profile/gc"
 	"user-server/profile/handlers"
 	"user-server/profile/service"
+	"user-server/tokens"
 )
 
+const replicaRepairInterval = time.Minute
+
 var profileHandler *handlers.ProfileHandler
 var authHandler *auth.AuthHandler
 
 func LoadHandlers(router *gin.Engine) {
-	mongoConfig := config.Configuration.MongoConfig
-	profileColl, _ := mongoConfig.GetCollection(common.ProfileCollection)
-	var profileStore = db.NewMongoProfileStore(profileColl)
-	var profileService = service.NewProfileService(profileStore, getBlobManager())
+	var profileStore = getProfileStore()
+	var blobManager = getBlobManager()
+	var profileService = service.NewProfileService(profileStore, blobManager,
+		config.Configuration.ProfileConfig.PictureRetention)
 	profileHandler = handlers.NewProfileHandler(profileService)
-	authHandler = auth.NewAuthHandler(config.Configuration.SecretKey)
+	authHandler = tokens.GetAuthHandler()
 	loadRoutes(router)
+	startPictureCollector(profileStore, blobManager)
+}
+
+// CreatePictureCollector builds a collector over the configured blob and
+// profile stores, for running a collection outside the server.
+func CreatePictureCollector(options *gc.Options) (*gc.Collector, error) {
+	return gc.NewCollector(getBlobManager(), getProfileStore(), options)
+}
+
+func startPictureCollector(profileStore db.ProfileStore, blobManager *blob_manager.BlobManager) {
+	gcConfig := config.Configuration.ProfileConfig.GCConfig
+	if gcConfig.Interval <= 0 {
+		return
+	}
+	collector, err := gc.NewCollector(blobManager, profileStore, &gc.Options{
+		Mode:        gc.Mode(gcConfig.Mode),
+		GracePeriod: time.Duration(gcConfig.GracePeriod) * time.Minute,
+	})
+	if err != nil {
+		log.Panicf("failed to create picture collector, reason: %s", err)
+	}
+	go collector.RunPeriodically(context.Background(), time.Duration(gcConfig.Interval)*time.Minute)
+}
+
+func getProfileStore() db.ProfileStore {
+	profileColl, err := config.Configuration.MongoConfig.GetCollection(common.ProfileCollection)
+	if err != nil {
+		log.Panicf("failed to get collection %s, reason: %s", common.ProfileCollection, err)
+	}
+	return db.NewMongoProfileStore(profileColl)
 }
 
 func getBlobManager() *blob_manager.BlobManager {
-	var blobStore blob_manager.BlobStore
-	blobStore = aws.CreateS3Client(getAwsConfig())
 	blobManager := &blob_manager.BlobManager{
-		BlobStore: blobStore,
+		BlobStore: getBlobStore(),
 	}
 	return blobManager
 }
 
+// getPolicyBlobStore enforces the upload policy in front of every other
+// layer, so sizes and quotas are in plaintext bytes.
+func getPolicyBlobStore(blobStore blob_manager.BlobStore) blob_manager.BlobStore {
+	policyConfig := config.Configuration.BlobConfig.PolicyConfig
+	usageColl, err := config.Configuration.MongoConfig.GetCollection(common.StorageUsageCollection)
+	if err != nil {
+		log.Panicf("failed to get collection %s, reason: %s", common.StorageUsageCollection, err)
+	}
+	policyStore, err := blob_manager.CreatePolicyBlobStore(blobStore, &blob_manager.UploadPolicy{
+		MaxObjectSize:       policyConfig.MaxObjectSize,
+		AllowedContentTypes: policyConfig.AllowedContentTypes,
+		Quota:               policyConfig.UserQuota,
+		Owner:               service.PictureOwner,
+	}, db.NewMongoStorageUsageStore(usageColl))
+	if err != nil {
+		log.Panicf("failed to create policy blob store, reason: %s", err)
+	}
+	return policyStore
+}
+
+// getBlobStore caches below the encryption layer, so neither cache tier
+// holds decrypted pictures. The encryption and retry layers buffer uploads in
+// memory, the policy's MaxObjectSize bounds what reaches them.
+func getBlobStore() blob_manager.BlobStore {
+	return getPolicyBlobStore(getEncryptingBlobStore(getCachingBlobStore(getBackingBlobStore())))
+}
+
+func getEncryptingBlobStore(blobStore blob_manager.BlobStore) blob_manager.BlobStore {
+	blobConfig := config.Configuration.BlobConfig
+	if len(blobConfig.EncryptionKeys) == 0 {
+		return blobStore
+	}
+	keyring, err := blob_manager.ParseKeyring(blobConfig.EncryptionKeyId, blobConfig.EncryptionKeys)
+	if err != nil {
+		log.Panicf("failed to load blob encryption keys, reason: %s", err)
+	}
+	encryptingStore, err := blob_manager.CreateEncryptingBlobStore(blobStore, keyring,
+		&blob_manager.EncryptionOptions{
+			AllowPlaintext: blobConfig.EncryptionAllowPlaintext,
+			MaxObjectSize:  blobConfig.PolicyConfig.MaxObjectSize,
+		})
+	if err != nil {
+		log.Panicf("failed to create encrypting blob store, reason: %s", err)
+	}
+	return encryptingStore
+}
+
+func getCachingBlobStore(blobStore blob_manager.BlobStore) blob_manager.BlobStore {
+	cacheConfig := config.Configuration.BlobConfig.CacheConfig
+	if !cacheConfig.Enabled {
+		return blobStore
+	}
+	options := &blob_manager.CacheOptions{
+		MaxBytes:     cacheConfig.MaxBytes,
+		ValidateETag: cacheConfig.ValidateETag,
+	}
+	if len(cacheConfig.Dir) > 0 {
+		diskTier, err := local.CreateFileSystemClient(cacheConfig.Dir)
+		if err != nil {
+			log.Panicf("failed to create blob cache directory, reason: %s", err)
+		}
+		options.DiskTier = diskTier
+	}
+	cachingStore, err := blob_manager.CreateCachingBlobStore(blobStore, options)
+	if err != nil {
+		log.Panicf("failed to create caching blob store, reason: %s", err)
+	}
+	return cachingStore
+}
+
+func getBackingBlobStore() blob_manager.BlobStore {
+	blobConfig := config.Configuration.BlobConfig
+	if blobConfig.Store != "replicated" {
+		return createBlobStore(blobConfig.Store)
+	}
+
+	var replicas []blob_manager.BlobStore
+	for _, replica := range blobConfig.Replicas {
+		replicas = append(replicas, createBlobStore(replica))
+	}
+	consistency := blob_manager.ConsistencyQuorum
+	if blobConfig.Consistency == "all" {
+		consistency = blob_manager.ConsistencyAll
+	}
+	blobStore, err := blob_manager.CreateReplicatedBlobStore(consistency,
+		blob_manager.NewMemoryRepairQueue(), replicas...)
+	if err != nil {
+		log.Panicf("failed to create replicated blob store, reason: %s", err)
+	}
+	go blobStore.RunRepairs(context.Background(), replicaRepairInterval)
+	return blobStore
+}
+
+// createBlobStore retries each backend on its own, so a replicated store
+// retries a failing replica before queueing it for repair.
+func createBlobStore(store string) blob_manager.BlobStore {
+	retryConfig := config.Configuration.BlobConfig.RetryConfig
+	return blob_manager.CreateRetryingBlobStore(createBackend(store), &blob_manager.RetryPolicy{
+		MaxAttempts:    retryConfig.MaxAttempts,
+		InitialBackoff: time.Duration(retryConfig.InitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(retryConfig.MaxBackoff) * time.Millisecond,
+		AttemptTimeout: time.Duration(retryConfig.AttemptTimeout) * time.Millisecond,
+		OnRetry: func(attempt *blob_manager.RetryAttempt) {
+			log.Printf("retrying %s of object: %s on %s store in %s, attempt %d failed, reason: %v",
+				attempt.Operation, attempt.FileName, store, attempt.Backoff, attempt.Attempt, attempt.Err)
+		},
+	})
+}
+
+func createBackend(store string) blob_manager.BlobStore {
+	blobConfig := config.Configuration.BlobConfig
+	switch store {
+	case "local":
+		blobStore, err := local.CreateFileSystemClient(blobConfig.LocalDir)
+		if err != nil {
+			log.Panicf("failed to create local blob store, reason: %s", err)
+		}
+		return blobStore
+	case "gcs":
+		ctx := context.Background()
+		return gcs.CreateGCSClient(&ctx, blobConfig.GCSConfig.CredentialsFile, blobConfig.GCSConfig.BucketName)
+	default:
+		blobStore, err := aws.CreateS3Client(getAwsConfig())
+		if err != nil {
+			log.Panicf("failed to create s3 blob store, reason: %s", err)
+		}
+		return blobStore
+	}
+}
+
 func getAwsConfig() *aws.AWSConfig {
 	return config.Configuration.AWSConfig
 }
@@ -45,5 +212,9 @@ func loadRoutes(router *gin.Engine) {
 		group.PATCH("/profile", profileHandler.UpdateProfile)
 		group.GET("/profile", profileHandler.GetProfile)
 		group.GET("/profile/:time", profileHandler.GetProfileByUserId)
+		group.POST("/profile/picture/upload-url", profileHandler.GetPictureUploadUrl)
+		group.POST("/profile/picture/commit", profileHandler.CommitProfilePicture)
+		group.GET("/profile/picture/versions", profileHandler.ListPictureVersions)
+		group.POST("/profile/picture/versions/:versionId/restore", profileHandler.RestorePictureVersion)
 	}
 }
@@ -2,36 +2,68 @@ package service
 
 import (
 	blobmanager "blob-manager"
+	blobError "blob-manager/common"
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"google.golang.org/appengine/log"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"time"
+	"user-server/common"
 	"user-server/profile/db"
+	"user-server/profile/imaging"
 )
 
+const pictureUrlExpiry = 15 * time.Minute
+
+// UserProfile is both the update request and the profile response. A nil
+// ProfilePicture leaves the picture untouched and an empty one removes it.
+// Responses carry ProfilePictureUrl when the blob store can sign urls and
+// fall back to the base64 encoded ProfilePicture otherwise.
 type UserProfile struct {
-	FirstName      string `json:"firstName"`
-	LastName       string `json:"lastName"`
-	ProfilePicture string `json:"profilePicture"`
+	FirstName         string  `json:"firstName"`
+	LastName          string  `json:"lastName"`
+	ProfilePicture    *string `json:"profilePicture,omitempty"`
+	ProfilePictureUrl string  `json:"profilePictureUrl,omitempty"`
+	PictureVersion    string  `json:"pictureVersion,omitempty"`
+}
+
+type PictureUploadUrl struct {
+	Url         string    `json:"url"`
+	Method      string    `json:"method"`
+	ContentType string    `json:"contentType"`
+	ExpiresAt   time.Time `json:"expiresAt"`
 }
 
 type ProfileService interface {
 	UpsertProfile(ctx *context.Context, userId string, profile *UserProfile) error
-	GetProfileByUserId(ctx *context.Context, userId string) (*UserProfile, error)
-	GetProfile(ctx *context.Context, userId string, currentTime time.Time) (*UserProfile, error)
+	GetProfileByUserId(ctx *context.Context, userId string, pictureSize int) (*UserProfile, error)
+	GetProfile(ctx *context.Context, userId string, currentTime time.Time, pictureSize int) (*UserProfile, error)
 	DeleteProfileByUserId(ctx *context.Context, userId string) error
+	GetPictureUploadUrl(ctx *context.Context, userId string, contentType string) (*PictureUploadUrl, error)
+	CommitProfilePicture(ctx *context.Context, userId string) error
+	ListPictureVersions(ctx *context.Context, userId string) ([]*PictureVersion, error)
+	RestorePictureVersion(ctx *context.Context, userId string, versionId string) error
 }
 
 type ProfileServiceImpl struct {
 	profileStore db.ProfileStore
 	blobManager  *blobmanager.BlobManager
+	// pictureRetention is the number of picture versions kept per user
+	pictureRetention int
 }
 
-func NewProfileService(profileStore db.ProfileStore, blobManager *blobmanager.BlobManager) *ProfileServiceImpl {
-	return &ProfileServiceImpl{profileStore: profileStore, blobManager: blobManager}
+func NewProfileService(profileStore db.ProfileStore, blobManager *blobmanager.BlobManager,
+	pictureRetention int) *ProfileServiceImpl {
+	return &ProfileServiceImpl{
+		profileStore:     profileStore,
+		blobManager:      blobManager,
+		pictureRetention: pictureRetention,
+	}
 }
 
 func (s *ProfileServiceImpl) UpsertProfile(ctx *context.Context,
@@ -45,35 +77,54 @@ func (s *ProfileServiceImpl) UpsertProfile(ctx *context.Context,
 	if len(profile.FirstName) > 0 || len(profile.LastName) > 0 {
 		dbProfile.UpdatedOn = &currTime
 	}
-	if len(profile.ProfilePicture) > 0 {
+	if profile.ProfilePicture != nil {
 		dbProfile.PictureUpdatedOn = &currTime
 	}
 
+	// process the picture first, a rejected picture must not update the profile
+	var picture *imaging.Picture
+	if profile.ProfilePicture != nil && len(*profile.ProfilePicture) > 0 {
+		var err error
+		if picture, err = decodePicture(*profile.ProfilePicture); err != nil {
+			return err
+		}
+	}
+	version := &db.PictureVersion{VersionId: newVersionId(), CreatedOn: currTime}
+
 	var errChan = make(chan error, 2)
 
 	s.updateProfile(ctx, dbProfile, errChan)
-	s.updateProfilePic(ctx, userId, profile.ProfilePicture, errChan)
+	s.updateProfilePic(ctx, userId, version, picture, errChan)
 	for i := 0; i < 2; i++ {
 		err := <-errChan
 		if err != nil {
 			return err
 		}
 	}
+
+	// the version is recorded once its blobs and the profile are stored
+	switch {
+	case picture != nil:
+		version.ContentType = picture.ContentType
+		return s.addPictureVersion(ctx, userId, version)
+	case profile.ProfilePicture != nil:
+		return s.removePicture(ctx, userId, currTime)
+	}
 	return nil
 }
 
 func (s *ProfileServiceImpl) GetProfileByUserId(ctx *context.Context,
-	userId string) (*UserProfile, error) {
+	userId string, pictureSize int) (*UserProfile, error) {
 	profile, err := s.profileStore.Get(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.mapProfile(ctx, profile)
+	return s.mapProfile(ctx, profile, pictureSize)
 }
 
 func (s *ProfileServiceImpl) GetProfile(ctx *context.Context, userId string,
-	currentTime time.Time) (*UserProfile, error) {
+	currentTime time.Time, pictureSize int) (*UserProfile, error) {
 	profile, err := s.profileStore.GetByUserId(ctx, userId, currentTime)
 	if err != nil {
 		return nil, err
@@ -86,7 +137,7 @@ func (s *ProfileServiceImpl) GetProfile(ctx *context.Context, userId string,
 	}
 
 	if profile.PictureUpdatedOn != nil && profile.PictureUpdatedOn.After(currentTime) {
-		err := s.setProfilePicture(ctx, userId, userProfile)
+		err := s.setProfilePicture(ctx, profile, pictureSize, userProfile)
 		if err != nil {
 			return nil, err
 		}
@@ -106,66 +157,216 @@ func (s *ProfileServiceImpl) updateProfile(ctx *context.Context, profile *db.Pro
 	}()
 }
 
-func (s *ProfileServiceImpl) updateProfilePic(ctx *context.Context,
-	userId string, profilePicture string, errChan chan error) {
+func (s *ProfileServiceImpl) GetPictureUploadUrl(ctx *context.Context, userId string,
+	contentType string) (*PictureUploadUrl, error) {
+	if !imaging.IsSupported(contentType) {
+		return nil, &imaging.UnsupportedFormatError{ContentType: contentType}
+	}
+
+	expiresAt := time.Now().Add(pictureUrlExpiry)
+	signedUrl, err := s.blobManager.SignedUploadURL(ctx, uploadKey(userId), &blobmanager.SignOptions{
+		Expiry:      pictureUrlExpiry,
+		ContentType: contentType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PictureUploadUrl{
+		Url:         signedUrl,
+		Method:      http.MethodPut,
+		ContentType: contentType,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// CommitProfilePicture runs a picture uploaded through a signed url through
+// the image pipeline and stores the processed original and its renditions as
+// a new version, so that GetProfile picks it up.
+func (s *ProfileServiceImpl) CommitProfilePicture(ctx *context.Context, userId string) error {
+	exists, err := s.blobManager.Exists(ctx, uploadKey(userId))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return &common.NotFoundError{Message: "Profile picture has not been uploaded"}
+	}
+
+	file, err := s.downloadFile(ctx, uploadKey(userId))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// read one byte past the limit, so oversized uploads fail in Process
+	content, err := io.ReadAll(io.LimitReader(file, int64(imaging.DefaultOptions.MaxBytes)+1))
+	if err != nil {
+		return err
+	}
+	picture, err := imaging.Process(content, imaging.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	version := &db.PictureVersion{
+		VersionId:   newVersionId(),
+		ContentType: picture.ContentType,
+		CreatedOn:   time.Now(),
+	}
+	if err := s.storePicture(ctx, versionKey(userId, version.VersionId), picture); err != nil {
+		return err
+	}
+	if err := s.addPictureVersion(ctx, userId, version); err != nil {
+		return err
+	}
+	s.deleteBlob(ctx, uploadKey(userId))
+	return nil
+}
+
+func (s *ProfileServiceImpl) updateProfilePic(ctx *context.Context, userId string,
+	version *db.PictureVersion, picture *imaging.Picture, errChan chan error) {
 	go func() {
-		if len(profilePicture) == 0 {
-			err := s.blobManager.Delete(ctx, userId)
-			if err != nil {
-				log.Errorf(*ctx, "ERROR: Failed to remove profile picture, reason: %s",
-					err.Error())
-			}
-			errChan <- nil
-		}
-		if len(profilePicture) > 0 {
-			file := getFile(userId, profilePicture)
-			err := s.blobManager.Upload(ctx, file)
-			if err != nil {
-				errChan <- err
-			}
+		if picture == nil {
 			errChan <- nil
+			return
 		}
+		errChan <- s.storePicture(ctx, versionKey(userId, version.VersionId), picture)
 	}()
 }
 
+// storePicture uploads the renditions before the original, whose presence
+// marks the picture as stored. Renditions of a picture that couldn't be
+// stored are removed again, so they don't count against the user's quota.
+func (s *ProfileServiceImpl) storePicture(ctx *context.Context, key string,
+	picture *imaging.Picture) error {
+	for _, size := range imaging.RenditionSizes {
+		rendition := picture.Renditions[size]
+		file := NewUploadableFile(pictureKey(key, size), getReadCloserFromByteArray(rendition),
+			int64(len(rendition)), picture.ContentType)
+		if err := s.blobManager.Upload(ctx, file); err != nil {
+			s.deletePicture(ctx, key)
+			return err
+		}
+	}
+	err := s.blobManager.Upload(ctx, NewUploadableFile(key, getReadCloserFromByteArray(picture.Original),
+		int64(len(picture.Original)), picture.ContentType))
+	if err != nil {
+		s.deletePicture(ctx, key)
+	}
+	return err
+}
+
+// deletePicture removes the original and every rendition stored under key.
+func (s *ProfileServiceImpl) deletePicture(ctx *context.Context, key string) {
+	for _, size := range append([]int{0}, imaging.RenditionSizes...) {
+		s.deleteBlob(ctx, pictureKey(key, size))
+	}
+}
+
+func (s *ProfileServiceImpl) deleteBlob(ctx *context.Context, key string) {
+	err := s.blobManager.Delete(ctx, key)
+	var notFoundErr *blobError.ObjectNotFound
+	if err != nil && !errors.As(err, &notFoundErr) {
+		log.Errorf(*ctx, "ERROR: Failed to remove profile picture, reason: %s",
+			err.Error())
+	}
+}
+
+// setProfilePicture sets the rendition of pictureSize of the current
+// picture, or the original for size 0. Pictures stored before renditions
+// existed fall back to the original.
 func (s *ProfileServiceImpl) setProfilePicture(ctx *context.Context,
-	userId string, profile *UserProfile) error {
-	file, err := s.downloadFile(ctx, userId)
+	dbProfile *db.Profile, pictureSize int, profile *UserProfile) error {
+	baseKey := currentPictureKey(dbProfile)
+	if len(baseKey) == 0 {
+		return nil
+	}
+	key := pictureKey(baseKey, pictureSize)
+	exists, err := s.blobManager.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists && pictureSize != 0 {
+		key = baseKey
+		exists, err = s.blobManager.Exists(ctx, key)
+	}
+	if err != nil || !exists {
+		return err
+	}
+	signedUrl, err := s.blobManager.SignedDownloadURL(ctx, key,
+		&blobmanager.SignOptions{Expiry: pictureUrlExpiry})
+	var unsupportedErr *blobError.UnsupportedOperationError
+	if errors.As(err, &unsupportedErr) {
+		return s.setPictureContent(ctx, dbProfile, key, profile)
+	}
 	if err != nil {
 		return err
 	}
+	profile.PictureVersion = dbProfile.PictureVersion
+	profile.ProfilePictureUrl = signedUrl
+	return nil
+}
+
+// setPictureContent embeds the picture for stores that can't sign urls.
+func (s *ProfileServiceImpl) setPictureContent(ctx *context.Context, dbProfile *db.Profile,
+	key string, profile *UserProfile) error {
+	file, err := s.downloadFile(ctx, key)
+	var notFoundErr *blobError.ObjectNotFound
+	if errors.As(err, &notFoundErr) {
+		// deleted since it was found
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	profile.PictureVersion = dbProfile.PictureVersion
 	fileContent, err := ioutil.ReadAll(file)
 	if err != nil {
 		return err
 	}
-	profile.ProfilePicture = base64.StdEncoding.EncodeToString(fileContent)
+	encoded := base64.StdEncoding.EncodeToString(fileContent)
+	profile.ProfilePicture = &encoded
 	return nil
 }
 
 func (s *ProfileServiceImpl) downloadFile(ctx *context.Context,
-	userId string) (blobmanager.File, error) {
-	file, err := s.blobManager.Download(ctx, userId)
+	key string) (blobmanager.File, error) {
+	file, err := s.blobManager.Download(ctx, key)
 	if err != nil {
 		return nil, err
 	}
 	return file, nil
 }
 
-func (s *ProfileServiceImpl) mapProfile(ctx *context.Context, profile *db.Profile) (*UserProfile, error) {
+func (s *ProfileServiceImpl) mapProfile(ctx *context.Context, profile *db.Profile,
+	pictureSize int) (*UserProfile, error) {
 	userProfile := &UserProfile{}
 	userProfile.FirstName = profile.FirstName
 	userProfile.LastName = profile.LastName
 
-	err := s.setProfilePicture(ctx, profile.UserId, userProfile)
+	if profile.PictureUpdatedOn == nil {
+		return userProfile, nil
+	}
+	err := s.setProfilePicture(ctx, profile, pictureSize, userProfile)
 	if err != nil {
 		return nil, err
 	}
 	return userProfile, nil
 }
 
-func getFile(userId, fileContent string) blobmanager.File {
-	decodedBytes, _ := base64.StdEncoding.DecodeString(fileContent)
-	return NewUploadableFile(userId, getReadCloserFromByteArray(decodedBytes), int64(len(decodedBytes)), "image/*")
+// pictureKey is the blob key of a rendition of the picture stored under key,
+// size 0 is the original.
+func pictureKey(key string, size int) string {
+	if size == 0 {
+		return key
+	}
+	return fmt.Sprintf("%s_%d", key, size)
+}
+
+func decodePicture(fileContent string) (*imaging.Picture, error) {
+	decodedBytes, err := base64.StdEncoding.DecodeString(fileContent)
+	if err != nil {
+		return nil, &imaging.InvalidImageError{Message: "profile picture is not valid base64"}
+	}
+	return imaging.Process(decodedBytes, imaging.DefaultOptions)
 }
 
 func getReadCloserFromByteArray(data []byte) io.ReadCloser {
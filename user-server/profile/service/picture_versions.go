@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/appengine/log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"user-server/profile/db"
+	"user-server/profile/imaging"
+)
+
+type PictureVersion struct {
+	VersionId   string    `json:"versionId"`
+	ContentType string    `json:"contentType"`
+	CreatedOn   time.Time `json:"createdOn"`
+	Current     bool      `json:"current"`
+}
+
+// ListPictureVersions returns the stored versions, newest first.
+func (s *ProfileServiceImpl) ListPictureVersions(ctx *context.Context,
+	userId string) ([]*PictureVersion, error) {
+	profile, err := s.profileStore.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]*PictureVersion, 0, len(profile.PictureVersions))
+	for _, version := range profile.PictureVersions {
+		versions = append(versions, &PictureVersion{
+			VersionId:   version.VersionId,
+			ContentType: version.ContentType,
+			CreatedOn:   version.CreatedOn,
+			Current:     version.VersionId == profile.PictureVersion,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].CreatedOn.After(versions[j].CreatedOn)
+	})
+	return versions, nil
+}
+
+// RestorePictureVersion makes a previous version the current picture again.
+func (s *ProfileServiceImpl) RestorePictureVersion(ctx *context.Context, userId string,
+	versionId string) error {
+	return s.profileStore.SetPictureVersion(ctx, userId, versionId, time.Now())
+}
+
+func (s *ProfileServiceImpl) addPictureVersion(ctx *context.Context, userId string,
+	version *db.PictureVersion) error {
+	if err := s.profileStore.AddPictureVersion(ctx, userId, version); err != nil {
+		return err
+	}
+	s.prunePictureVersions(ctx, userId)
+	return nil
+}
+
+// removePicture unsets the current picture, the version stays in the history
+// so it can be restored. A picture from before versioning is deleted.
+func (s *ProfileServiceImpl) removePicture(ctx *context.Context, userId string,
+	updatedOn time.Time) error {
+	profile, err := s.profileStore.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if len(profile.PictureVersions) == 0 {
+		s.deletePicture(ctx, userId)
+	}
+	return s.profileStore.SetPictureVersion(ctx, userId, "", updatedOn)
+}
+
+// prunePictureVersions deletes the oldest versions beyond the retention,
+// the current version is always kept. Failures are only logged, pruning is
+// retried on the next upload.
+func (s *ProfileServiceImpl) prunePictureVersions(ctx *context.Context, userId string) {
+	if s.pictureRetention <= 0 {
+		return
+	}
+	profile, err := s.profileStore.Get(ctx, userId)
+	if err != nil {
+		log.Errorf(*ctx, "ERROR: Failed to prune profile pictures, reason: %s", err.Error())
+		return
+	}
+	versions := append([]db.PictureVersion{}, profile.PictureVersions...)
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].CreatedOn.After(versions[j].CreatedOn)
+	})
+
+	var pruned []string
+	kept := 0
+	for _, version := range versions {
+		if kept < s.pictureRetention || version.VersionId == profile.PictureVersion {
+			kept++
+			continue
+		}
+		pruned = append(pruned, version.VersionId)
+	}
+	if len(pruned) == 0 {
+		return
+	}
+	// forget the versions first, a blob without a version is only garbage
+	if err := s.profileStore.RemovePictureVersions(ctx, userId, pruned); err != nil {
+		log.Errorf(*ctx, "ERROR: Failed to prune profile pictures, reason: %s", err.Error())
+		return
+	}
+	for _, versionId := range pruned {
+		s.deletePicture(ctx, versionKey(userId, versionId))
+	}
+}
+
+// currentPictureKey is the blob key of the current picture, empty when there
+// is none.
+func currentPictureKey(profile *db.Profile) string {
+	if len(profile.PictureVersion) > 0 {
+		return versionKey(profile.UserId, profile.PictureVersion)
+	}
+	if len(profile.PictureVersions) == 0 && profile.PictureUpdatedOn != nil {
+		return profile.UserId
+	}
+	return ""
+}
+
+func versionKey(userId string, versionId string) string {
+	return "pictures/" + userId + "/" + versionId
+}
+
+// uploadKey is where a picture uploaded through a signed url waits to be
+// committed.
+func uploadKey(userId string) string {
+	return "uploads/" + userId
+}
+
+// PictureOwner is the user whose storage quota a blob key counts against.
+// Signed uploads waiting to be committed don't count, they bypass the upload
+// policy and are deleted on commit.
+func PictureOwner(key string) string {
+	if strings.HasPrefix(key, "uploads/") {
+		return ""
+	}
+	if versioned, ok := strings.CutPrefix(key, "pictures/"); ok {
+		userId, _, _ := strings.Cut(versioned, "/")
+		return userId
+	}
+	userId, _ := legacyPictureOwner(key)
+	return userId
+}
+
+// legacyPictureOwner is the user of a picture from before versioning, those
+// are stored as userId and userId_size for the rendition sizes.
+func legacyPictureOwner(key string) (string, bool) {
+	userId, size, sized := strings.Cut(key, "_")
+	if !primitive.IsValidObjectID(userId) {
+		return "", false
+	}
+	if !sized {
+		return userId, true
+	}
+	for _, renditionSize := range imaging.RenditionSizes {
+		if size == strconv.Itoa(renditionSize) {
+			return userId, true
+		}
+	}
+	return "", false
+}
+
+// PictureReferenced reports whether profile still points at the blob key,
+// profile is nil when the key's owner has no profile. Versions in the history
+// are referenced, staged uploads never are, and keys outside the picture
+// layout are always treated as referenced so they are left alone.
+func PictureReferenced(key string, profile *db.Profile) bool {
+	if strings.HasPrefix(key, "uploads/") {
+		return false
+	}
+	if versioned, ok := strings.CutPrefix(key, "pictures/"); ok {
+		_, version, _ := strings.Cut(versioned, "/")
+		versionId, _, _ := strings.Cut(version, "_")
+		if profile == nil {
+			return false
+		}
+		for _, pictureVersion := range profile.PictureVersions {
+			if pictureVersion.VersionId == versionId {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := legacyPictureOwner(key); !ok {
+		return true
+	}
+	return profile != nil && currentPictureKey(profile) == profile.UserId
+}
+
+func newVersionId() string {
+	return primitive.NewObjectID().Hex()
+}
@@ -2,12 +2,12 @@ package signin
 
 import (
 	"github.com/gin-gonic/gin"
-	token_manager "token-manager"
 	"user-server/common"
 	"user-server/config"
 	"user-server/signin/handlers"
 	"user-server/signin/service"
 	"user-server/signup/db"
+	"user-server/tokens"
 )
 
 var signInHandler *handlers.SignInHandler
@@ -16,8 +16,7 @@ func LoadHandlers(router *gin.Engine) {
 	mongoConfig := config.Configuration.MongoConfig
 	userCollection, _ := mongoConfig.GetCollection(common.UserCollection)
 	userStore := db.NewMongoUserStore(userCollection)
-	tokenManager := token_manager.NewJwtTokenManager(config.Configuration.SecretKey)
-	signInManager := service.NewMongoSignInManager(userStore, tokenManager)
+	signInManager := service.NewMongoSignInManager(userStore, tokens.GetTokenService())
 	signInHandler = handlers.NewSignInHandler(signInManager)
 	loadRoutes(router)
 }
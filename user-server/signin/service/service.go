@@ -2,11 +2,10 @@ package service
 
 import (
 	"context"
-	"time"
-	token "token-manager"
 	"user-server/common"
 	"user-server/signin/api"
 	"user-server/signup/db"
+	tokens "user-server/tokens/service"
 )
 
 type SignInManager interface {
@@ -15,11 +14,11 @@ type SignInManager interface {
 
 type MongoSignInManager struct {
 	userStore    db.UserStore
-	tokenManager token.TokenManager
+	tokenService tokens.TokenService
 }
 
-func NewMongoSignInManager(userStore db.UserStore, tokenManager token.TokenManager) *MongoSignInManager {
-	return &MongoSignInManager{userStore: userStore, tokenManager: tokenManager}
+func NewMongoSignInManager(userStore db.UserStore, tokenService tokens.TokenService) *MongoSignInManager {
+	return &MongoSignInManager{userStore: userStore, tokenService: tokenService}
 }
 
 func (m *MongoSignInManager) SignIn(ctx *context.Context, request *api.SignInRequest) (*common.AuthenticatedUser, error) {
@@ -34,7 +33,7 @@ func (m *MongoSignInManager) SignIn(ctx *context.Context, request *api.SignInReq
 	authenticatedUser.PhoneNumber = user.PhoneNumber
 
 	errCh := make(chan error, 1)
-	m.createApiKey(authenticatedUser, user.UserId, user.EmailId, request.Device.FingerPrint, request.App, errCh)
+	m.createApiKey(ctx, authenticatedUser, user.UserId, user.EmailId, request.Device.FingerPrint, request.App, errCh)
 
 	for i := 0; i < 1; i++ {
 		e := <-errCh
@@ -45,30 +44,21 @@ func (m *MongoSignInManager) SignIn(ctx *context.Context, request *api.SignInReq
 	return authenticatedUser, nil
 }
 
-func (m *MongoSignInManager) createApiKey(
+func (m *MongoSignInManager) createApiKey(ctx *context.Context,
 	result *common.AuthenticatedUser,
 	userId string, emailId string, machineId string, appId string, errCh chan<- error) {
 	go func() {
-		claims := getClaims(userId, emailId, machineId, appId)
-		apiKey, err := m.tokenManager.Generate(claims)
+		issued, err := m.tokenService.Issue(ctx, &tokens.Subject{
+			UserId:      userId,
+			EmailId:     emailId,
+			FingerPrint: machineId,
+			App:         appId,
+		})
 		if err == nil {
-			result.ApiKey = apiKey
+			result.ApiKey = issued.AccessToken
+			result.RefreshToken = issued.RefreshToken
+			result.ExpiresIn = issued.ExpiresIn
 		}
 		errCh <- err
 	}()
 }
-
-func getClaims(userId string, emailId string, machineId string, appId string) *token.TokenClaims {
-	iat := time.Now()
-	exp := iat.Add(24 * 7 * time.Hour)
-	return &token.TokenClaims{
-		UserId:    userId,
-		EmailId:   emailId,
-		MachineId: machineId,
-		App:       appId,
-		IAT:       &iat,
-		EXP:       &exp,
-		Kind:      "USER",
-		Sub:       userId,
-	}
-}
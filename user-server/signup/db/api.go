@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 	"user-server/common"
 )
 
@@ -9,6 +10,13 @@ type User struct {
 	UserId      string              `json:"userId" bson:"userId"`
 	EmailId     string              `json:"emailId" bson:"emailId"`
 	PhoneNumber *common.PhoneNumber `json:"phoneNumber" bson:"phoneNumber"`
+	// Scopes are granted to the user's access tokens, they're set by an
+	// administrator, e.g. "endpoints:write"
+	Scopes []string `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	// DisabledOn is set by an administrator in the users collection to
+	// disable the account, no flow of this service sets it. Its tokens are
+	// no longer introspected as active
+	DisabledOn *time.Time `json:"-" bson:"disabledOn,omitempty"`
 }
 
 type SearchKey string
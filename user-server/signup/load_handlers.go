@@ -7,7 +7,6 @@ import (
 	"otp-manager/otp"
 	"otp-manager/senders"
 	"otp-manager/sms"
-	token_manager "token-manager"
 	"user-server/common"
 	"user-server/config"
 	device_store "user-server/devices/db"
@@ -15,6 +14,7 @@ import (
 	"user-server/signup/db"
 	"user-server/signup/handlers"
 	"user-server/signup/service"
+	"user-server/tokens"
 )
 
 var signUpHandler *handlers.SignUpHandler
@@ -38,12 +38,11 @@ func LoadHandlers(router *gin.Engine) {
 	mailOtpSender := senders.NewMailOtpSender(&ctx, sendGridSender)
 	emailOtpManager := otp.NewMongoOtpManager(otpStore, mailOtpSender)
 	smsOtpManager := otp.NewMongoOtpManager(otpStore, smsOtpSender)
-	tokenManager := token_manager.NewJwtTokenManager(config.Configuration.SecretKey)
 	deviceCollection, _ := mongoConfig.GetCollection(common.UserDeviceCollection)
 	userDeviceStore := device_store.NewMongoUserDeviceStore(deviceCollection)
 	deviceManager := device_manager.NewUserDeviceManager(userDeviceStore)
 
-	signUpManager := service.NewMongoSignupManager(userStore, emailOtpManager, smsOtpManager, tokenManager, deviceManager)
+	signUpManager := service.NewMongoSignupManager(userStore, emailOtpManager, smsOtpManager, tokens.GetTokenService(), deviceManager)
 	signUpHandler = handlers.NewSignUpHandler(signUpManager)
 	loadRoutes(router)
 }
@@ -5,12 +5,11 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	otpCommon "otp-manager/common"
 	"otp-manager/otp"
-	"time"
-	token "token-manager"
 	"user-server/common"
 	"user-server/devices/service"
 	"user-server/signup/api"
 	"user-server/signup/db"
+	tokens "user-server/tokens/service"
 )
 
 type SignUpManager interface {
@@ -23,18 +22,18 @@ type MongoSignupManager struct {
 	userStore       db.UserStore
 	emailOtpManager otp.OtpManager
 	smsOtpManager   otp.OtpManager
-	tokenManager    token.TokenManager
+	tokenService    tokens.TokenService
 	deviceManager   *service.UserDeviceManager
 }
 
 func NewMongoSignupManager(userStore db.UserStore,
-	emailOtpManager otp.OtpManager, smsOtpManager otp.OtpManager, tokenManager token.TokenManager,
+	emailOtpManager otp.OtpManager, smsOtpManager otp.OtpManager, tokenService tokens.TokenService,
 	deviceManager *service.UserDeviceManager) *MongoSignupManager {
 	return &MongoSignupManager{
 		userStore:       userStore,
 		emailOtpManager: emailOtpManager,
 		smsOtpManager:   smsOtpManager,
-		tokenManager:    tokenManager,
+		tokenService:    tokenService,
 		deviceManager:   deviceManager,
 	}
 }
@@ -73,7 +72,7 @@ func (m *MongoSignupManager) SignUp(ctx *context.Context, signUpRequest *api.Sig
 
 	var result common.AuthenticatedUser
 	m.insertUser(ctx, user, errCh)
-	m.createApiKey(&result, user.UserId, user.EmailId, signUpRequest.Device.FingerPrint, signUpRequest.App, errCh)
+	m.createApiKey(ctx, &result, user.UserId, user.EmailId, signUpRequest.Device.FingerPrint, signUpRequest.App, errCh)
 
 	for i := 0; i < 2; i++ {
 		err := <-errCh
@@ -112,30 +111,21 @@ func (m *MongoSignupManager) insertUser(ctx *context.Context, user *db.User, err
 	}()
 }
 
-func (m *MongoSignupManager) createApiKey(
+func (m *MongoSignupManager) createApiKey(ctx *context.Context,
 	result *common.AuthenticatedUser,
 	userId string, emailId string, machineId string, appId string, errCh chan<- error) {
 	go func() {
-		claims := getClaims(userId, emailId, machineId, appId)
-		apiKey, err := m.tokenManager.Generate(claims)
+		issued, err := m.tokenService.Issue(ctx, &tokens.Subject{
+			UserId:      userId,
+			EmailId:     emailId,
+			FingerPrint: machineId,
+			App:         appId,
+		})
 		if err == nil {
-			result.ApiKey = apiKey
+			result.ApiKey = issued.AccessToken
+			result.RefreshToken = issued.RefreshToken
+			result.ExpiresIn = issued.ExpiresIn
 		}
 		errCh <- err
 	}()
 }
-
-func getClaims(userId string, emailId string, machineId string, appId string) *token.TokenClaims {
-	iat := time.Now()
-	exp := iat.Add(24 * 7 * time.Hour)
-	return &token.TokenClaims{
-		UserId:    userId,
-		EmailId:   emailId,
-		MachineId: machineId,
-		App:       appId,
-		IAT:       &iat,
-		EXP:       &exp,
-		Kind:      "USER",
-		Sub:       userId,
-	}
-}
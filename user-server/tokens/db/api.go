@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// RefreshToken is stored by the SHA-256 hash of the opaque token. Every
+// rotation issues a new token in the same FamilyId, RotatedOn marks a token
+// that was exchanged already and must not be presented again.
+type RefreshToken struct {
+	TokenHash   string     `bson:"tokenHash"`
+	FamilyId    string     `bson:"familyId"`
+	UserId      string     `bson:"userId"`
+	EmailId     string     `bson:"emailId"`
+	FingerPrint string     `bson:"fingerPrint"`
+	App         string     `bson:"app"`
+	CreatedOn   time.Time  `bson:"createdOn"`
+	ExpiresOn   time.Time  `bson:"expiresOn"`
+	RotatedOn   *time.Time `bson:"rotatedOn,omitempty"`
+	RevokedOn   *time.Time `bson:"revokedOn,omitempty"`
+}
+
+type RefreshTokenStore interface {
+	Insert(ctx *context.Context, token *RefreshToken) error
+	Get(ctx *context.Context, tokenHash string) (*RefreshToken, error)
+	// MarkRotated marks an active token as rotated and reports false when it
+	// was rotated or revoked already, so a token is only exchanged once.
+	MarkRotated(ctx *context.Context, tokenHash string, rotatedOn time.Time) (bool, error)
+	RevokeFamily(ctx *context.Context, familyId string, revokedOn time.Time) error
+	// RevokeSubject revokes the user's tokens on the device with fingerPrint,
+	// or on all devices when fingerPrint is empty.
+	RevokeSubject(ctx *context.Context, userId string, fingerPrint string, revokedOn time.Time) error
+}
+
+const (
+	RevokedToken  = "jti"
+	RevokedUser   = "user"
+	RevokedDevice = "device"
+)
+
+// Revocation revokes the token with Jti, or every token issued to UserId, on
+// the device with FingerPrint for a device revocation, up to RevokedOn. It's
+// kept until ExpiresOn, when the tokens it revokes have expired.
+type Revocation struct {
+	Kind        string    `bson:"kind"`
+	Jti         string    `bson:"jti,omitempty"`
+	UserId      string    `bson:"userId,omitempty"`
+	FingerPrint string    `bson:"fingerPrint,omitempty"`
+	RevokedOn   time.Time `bson:"revokedOn"`
+	ExpiresOn   time.Time `bson:"expiresOn"`
+}
+
+type RevocationStore interface {
+	Insert(ctx *context.Context, revocation *Revocation) error
+	// ListSince returns the unexpired revocations made on or after since.
+	ListSince(ctx *context.Context, since time.Time) ([]*Revocation, error)
+}
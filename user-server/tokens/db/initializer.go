@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"user-server/common"
+	"user-server/config"
+)
+
+// LoadDB indexes refresh tokens by hash, family and user, and revocations by
+// when they were made. Expired tokens and revocations are removed by TTL
+// indexes, a reused token that expired is invalid either way.
+func LoadDB(ctx *context.Context) {
+	tokenColl, err := config.Configuration.MongoConfig.GetCollection(common.RefreshTokenCollection)
+	if err != nil {
+		log.Panicf("failed to get collection %s , because of %s", common.RefreshTokenCollection, err.Error())
+	}
+	_, err = tokenColl.Indexes().CreateMany(*ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetName("tokenHash-index").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "familyId", Value: 1}},
+			Options: options.Index().SetName("familyId-index"),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "fingerPrint", Value: 1}},
+			Options: options.Index().SetName("userId-fingerPrint-index"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresOn", Value: 1}},
+			Options: options.Index().SetName("expiresOn-ttl-index").SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Panicf("failed to create index on %s, reason: %s", common.RefreshTokenCollection, err)
+	}
+
+	revocationColl, err := config.Configuration.MongoConfig.GetCollection(common.RevokedTokenCollection)
+	if err != nil {
+		log.Panicf("failed to get collection %s , because of %s", common.RevokedTokenCollection, err.Error())
+	}
+	_, err = revocationColl.Indexes().CreateMany(*ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "revokedOn", Value: 1}},
+			Options: options.Index().SetName("revokedOn-index"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresOn", Value: 1}},
+			Options: options.Index().SetName("expiresOn-ttl-index").SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Panicf("failed to create index on %s, reason: %s", common.RevokedTokenCollection, err)
+	}
+}
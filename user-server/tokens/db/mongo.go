@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+	"user-server/common"
+)
+
+type MongoRefreshTokenStore struct {
+	tokenColl *mongo.Collection
+}
+
+func NewMongoRefreshTokenStore(tokenColl *mongo.Collection) *MongoRefreshTokenStore {
+	return &MongoRefreshTokenStore{
+		tokenColl: tokenColl,
+	}
+}
+
+func (m *MongoRefreshTokenStore) Insert(ctx *context.Context, token *RefreshToken) error {
+	_, err := m.tokenColl.InsertOne(*ctx, token)
+	return err
+}
+
+func (m *MongoRefreshTokenStore) Get(ctx *context.Context, tokenHash string) (*RefreshToken, error) {
+	filter := bson.D{{Key: "tokenHash", Value: tokenHash}}
+	var token RefreshToken
+	err := m.tokenColl.FindOne(*ctx, filter).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, &common.NotFoundError{Message: "Refresh token not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (m *MongoRefreshTokenStore) MarkRotated(ctx *context.Context, tokenHash string,
+	rotatedOn time.Time) (bool, error) {
+	filter := bson.D{
+		{Key: "tokenHash", Value: tokenHash},
+		{Key: "rotatedOn", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "revokedOn", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "rotatedOn", Value: rotatedOn}}}}
+	result, err := m.tokenColl.UpdateOne(*ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (m *MongoRefreshTokenStore) RevokeFamily(ctx *context.Context, familyId string, revokedOn time.Time) error {
+	filter := bson.D{
+		{Key: "familyId", Value: familyId},
+		{Key: "revokedOn", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revokedOn", Value: revokedOn}}}}
+	_, err := m.tokenColl.UpdateMany(*ctx, filter, update)
+	return err
+}
+
+func (m *MongoRefreshTokenStore) RevokeSubject(ctx *context.Context, userId string, fingerPrint string,
+	revokedOn time.Time) error {
+	filter := bson.D{
+		{Key: "userId", Value: userId},
+		{Key: "revokedOn", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	if len(fingerPrint) > 0 {
+		filter = append(filter, bson.E{Key: "fingerPrint", Value: fingerPrint})
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revokedOn", Value: revokedOn}}}}
+	_, err := m.tokenColl.UpdateMany(*ctx, filter, update)
+	return err
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type MongoRevocationStore struct {
+	revocationColl *mongo.Collection
+}
+
+func NewMongoRevocationStore(revocationColl *mongo.Collection) *MongoRevocationStore {
+	return &MongoRevocationStore{
+		revocationColl: revocationColl,
+	}
+}
+
+func (m *MongoRevocationStore) Insert(ctx *context.Context, revocation *Revocation) error {
+	_, err := m.revocationColl.InsertOne(*ctx, revocation)
+	return err
+}
+
+func (m *MongoRevocationStore) ListSince(ctx *context.Context, since time.Time) ([]*Revocation, error) {
+	filter := bson.D{
+		{Key: "revokedOn", Value: bson.D{{Key: "$gte", Value: since}}},
+		{Key: "expiresOn", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+	cursor, err := m.revocationColl.Find(*ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	revocations := []*Revocation{}
+	if err := cursor.All(*ctx, &revocations); err != nil {
+		return nil, err
+	}
+	return revocations, nil
+}
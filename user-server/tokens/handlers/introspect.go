@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"user-server/common"
+	"user-server/tokens/service"
+)
+
+type IntrospectionHandler struct {
+	introspector *service.IntrospectionService
+}
+
+func NewIntrospectionHandler(introspector *service.IntrospectionService) *IntrospectionHandler {
+	return &IntrospectionHandler{introspector: introspector}
+}
+
+// IntrospectRequest is form encoded as in RFC 7662, TokenTypeHint is
+// accepted but not needed since only access tokens are introspected.
+type IntrospectRequest struct {
+	Token         string `form:"token" json:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint"`
+}
+
+// Introspect tells a service whether a token is active and what it grants.
+func (h *IntrospectionHandler) Introspect(c *gin.Context) {
+	var request IntrospectRequest
+	if err := c.ShouldBind(&request); err != nil {
+		common.BadRequest(c, "invalid_request", "Invalid request: token is required")
+		return
+	}
+	ctx := c.Request.Context()
+	introspection, err := h.introspector.Introspect(&ctx, request.Token)
+	if err != nil {
+		log.Printf("failed to introspect token, reason: %s", err.Error())
+		common.InternalError(c, "failed to introspect token, reason: "+err.Error())
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, introspection)
+}
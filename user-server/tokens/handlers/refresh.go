@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"user-server/common"
+	"user-server/tokens/service"
+	"user-server/validators"
+)
+
+type TokenHandler struct {
+	tokenService service.TokenService
+	revoker      service.TokenRevoker
+}
+
+func NewTokenHandler(tokenService service.TokenService, revoker service.TokenRevoker) *TokenHandler {
+	return &TokenHandler{tokenService: tokenService, revoker: revoker}
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+	FingerPrint  string `json:"fingerPrint" binding:"required"`
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token, the
+// presented refresh token can't be used again.
+func (t *TokenHandler) Refresh(c *gin.Context) {
+	var request RefreshRequest
+	if !validators.ParseAndValidate(c, &request) {
+		return
+	}
+	ctx := c.Request.Context()
+	tokens, err := t.tokenService.Refresh(&ctx, request.RefreshToken, request.FingerPrint)
+	if err != nil {
+		handleRefreshErrors(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func handleRefreshErrors(c *gin.Context, err error) {
+	var invalidErr *service.InvalidRefreshTokenError
+	var reuseErr *service.RefreshTokenReuseError
+	switch {
+	case errors.As(err, &invalidErr):
+		common.Unauthorized(c, "invalid-refresh-token", invalidErr.Message)
+	case errors.As(err, &reuseErr):
+		common.Unauthorized(c, "refresh-token-reused", reuseErr.Error())
+	default:
+		log.Printf("failed to refresh token, reason: %s", err.Error())
+		common.InternalError(c, "failed to refresh token, reason: "+err.Error())
+	}
+}
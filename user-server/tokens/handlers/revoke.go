@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"time"
+	token "token-manager"
+	"user-server/common"
+	"user-server/validators"
+)
+
+type RevokeSessionsRequest struct {
+	// FingerPrint is the device to sign out, all devices when it's empty
+	FingerPrint string `json:"fingerPrint"`
+}
+
+// Revoke revokes the token the request is authenticated with, e.g. on sign out.
+// Tokens issued before token ids were random carry their app as jti, revoking
+// that would revoke the app's tokens of every user, so they are revoked with
+// every other token of the device instead.
+func (t *TokenHandler) Revoke(c *gin.Context) {
+	claims := getClaims(c)
+	ctx := c.Request.Context()
+	var err error
+	if token.IsJTI(claims.JTI) && claims.JTI != claims.App {
+		expiresOn := time.Now()
+		if claims.EXP != nil {
+			expiresOn = *claims.EXP
+		}
+		err = t.revoker.RevokeToken(&ctx, claims.JTI, expiresOn)
+	} else if len(claims.UserId) > 0 {
+		err = t.revoker.RevokeDevice(&ctx, claims.UserId, claims.MachineId)
+	} else {
+		common.BadRequest(c, "missing-jti", "token has no id to revoke it by")
+		return
+	}
+	if err != nil {
+		log.Printf("failed to revoke token of user: %s, reason: %s", claims.UserId, err.Error())
+		common.InternalError(c, "failed to revoke token, reason: "+err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeSessions revokes every token of the user on one or all devices.
+func (t *TokenHandler) RevokeSessions(c *gin.Context) {
+	var request RevokeSessionsRequest
+	if !validators.ParseAndValidate(c, &request) {
+		return
+	}
+	claims := getClaims(c)
+	ctx := c.Request.Context()
+	if err := t.revoker.RevokeDevice(&ctx, claims.UserId, request.FingerPrint); err != nil {
+		log.Printf("failed to revoke tokens of user: %s, reason: %s", claims.UserId, err.Error())
+		common.InternalError(c, "failed to revoke tokens, reason: "+err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func getClaims(c *gin.Context) token.TokenClaims {
+	user, _ := c.Get("user")
+	claims, _ := user.(token.TokenClaims)
+	return claims
+}
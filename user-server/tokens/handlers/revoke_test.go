@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	token "token-manager"
+)
+
+type recordingRevoker struct {
+	jti         string
+	userId      string
+	fingerPrint string
+}
+
+func (r *recordingRevoker) RevokeToken(ctx *context.Context, jti string, expiresOn time.Time) error {
+	r.jti = jti
+	return nil
+}
+
+func (r *recordingRevoker) RevokeUser(ctx *context.Context, userId string) error {
+	return r.RevokeDevice(ctx, userId, "")
+}
+
+func (r *recordingRevoker) RevokeDevice(ctx *context.Context, userId string, fingerPrint string) error {
+	r.userId, r.fingerPrint = userId, fingerPrint
+	return nil
+}
+
+func (r *recordingRevoker) IsRevoked(ctx *context.Context, claims *token.TokenClaims) (bool, error) {
+	return false, nil
+}
+
+func TestTokenHandler_Revoke(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jti := "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name       string
+		claims     token.TokenClaims
+		want       recordingRevoker
+		wantStatus int
+	}{
+		{
+			name:       "random jti",
+			claims:     token.TokenClaims{JTI: jti, App: "app", UserId: "user-1", MachineId: "device-1"},
+			want:       recordingRevoker{jti: jti},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "legacy jti is the app",
+			claims:     token.TokenClaims{JTI: "app", App: "app", UserId: "user-1", MachineId: "device-1"},
+			want:       recordingRevoker{userId: "user-1", fingerPrint: "device-1"},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "legacy token without device",
+			claims:     token.TokenClaims{App: "app", UserId: "user-1"},
+			want:       recordingRevoker{userId: "user-1"},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "no jti and no user",
+			claims:     token.TokenClaims{App: "app"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoker := &recordingRevoker{}
+			handler := NewTokenHandler(nil, revoker)
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/auth/token/revoke", nil)
+			c.Set("user", tt.claims)
+			handler.Revoke(c)
+			if c.Writer.Status() != tt.wantStatus || *revoker != tt.want {
+				t.Errorf("Revoke() = %d, revoked %+v, want %d, %+v", c.Writer.Status(), *revoker, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package tokens
+
+import (
+	"github.com/gin-gonic/gin"
+	"sync"
+	"time"
+	"user-server/auth"
+	"user-server/common"
+	"user-server/config"
+	"user-server/jwks"
+	userDb "user-server/signup/db"
+	"user-server/tokens/db"
+	"user-server/tokens/handlers"
+	"user-server/tokens/service"
+)
+
+var tokenHandler *handlers.TokenHandler
+var introspectionHandler *handlers.IntrospectionHandler
+var authHandler *auth.AuthHandler
+var serviceAuthHandler *auth.AuthHandler
+
+// legacyTokenLifetime is that of the tokens signin and signup issued before
+// they issued short lived access tokens, revocations must outlive them.
+const legacyTokenLifetime = 7 * 24 * time.Hour
+
+var tokenService *service.TokenServiceImpl
+var loadTokenService sync.Once
+
+var revocationService *service.RevocationService
+var loadRevocationService sync.Once
+
+func LoadHandlers(router *gin.Engine) {
+	tokenHandler = handlers.NewTokenHandler(GetTokenService(), GetRevocationService())
+	introspectionHandler = handlers.NewIntrospectionHandler(service.NewIntrospectionService(
+		jwks.GetTokenManager(), GetRevocationService(), service.NewUserAccountChecker(getUserStore())))
+	authHandler = GetAuthHandler()
+	serviceAuthHandler = GetServiceAuthHandler()
+	loadRoutes(router)
+}
+
+// GetTokenService is shared by every flow that signs a user in, so they all
+// issue tokens with the same lifetimes.
+func GetTokenService() service.TokenService {
+	loadTokenService.Do(func() {
+		tokenConfig := config.Configuration.TokenConfig
+		tokenService = service.NewTokenService(jwks.GetTokenManager(), getRefreshTokenStore(),
+			service.NewUserScopeResolver(getUserStore()), service.NewUserAccountChecker(getUserStore()),
+			time.Duration(tokenConfig.AccessTokenTTL)*time.Minute,
+			time.Duration(tokenConfig.RefreshTokenTTL)*time.Hour)
+	})
+	return tokenService
+}
+
+// GetRevocationService is shared so that a revocation is seen by every
+// route of this instance right away.
+func GetRevocationService() *service.RevocationService {
+	loadRevocationService.Do(func() {
+		tokenConfig := config.Configuration.TokenConfig
+		revocationColl, _ := config.Configuration.MongoConfig.GetCollection(common.RevokedTokenCollection)
+		revocationService = service.NewRevocationService(db.NewMongoRevocationStore(revocationColl),
+			getRefreshTokenStore(),
+			max(time.Duration(tokenConfig.AccessTokenTTL)*time.Minute,
+				time.Duration(tokenConfig.ServiceTokenTTL)*time.Minute, legacyTokenLifetime),
+			time.Duration(tokenConfig.RevocationRefreshInterval)*time.Second)
+	})
+	return revocationService
+}
+
+// GetAuthHandler authenticates requests with tokens that weren't revoked.
+func GetAuthHandler() *auth.AuthHandler {
+	return auth.NewRevocationCheckingAuthHandler(jwks.GetTokenManager(), GetRevocationService())
+}
+
+// GetServiceAuthHandler authenticates requests to internal routes with
+// service tokens that weren't revoked.
+func GetServiceAuthHandler() *auth.AuthHandler {
+	return auth.NewServiceAuthHandler(jwks.GetTokenManager(), GetRevocationService())
+}
+
+func getRefreshTokenStore() db.RefreshTokenStore {
+	tokenColl, _ := config.Configuration.MongoConfig.GetCollection(common.RefreshTokenCollection)
+	return db.NewMongoRefreshTokenStore(tokenColl)
+}
+
+func getUserStore() userDb.UserStore {
+	userColl, _ := config.Configuration.MongoConfig.GetCollection(common.UserCollection)
+	return userDb.NewMongoUserStore(userColl)
+}
+
+func loadRoutes(router *gin.Engine) {
+	routes := router.Group("/api/v1/auth")
+	routes.POST("/token/refresh", tokenHandler.Refresh)
+
+	authenticated := router.Group("/api/v1/auth")
+	authenticated.Use(authHandler.Handle())
+	{
+		authenticated.POST("/token/revoke", tokenHandler.Revoke)
+		authenticated.POST("/token/revoke/sessions", tokenHandler.RevokeSessions)
+	}
+
+	internal := router.Group("/api/v1/auth")
+	internal.Use(serviceAuthHandler.Handle(), auth.RequireScopes(common.TokenIntrospectScope))
+	{
+		internal.POST("/introspect", introspectionHandler.Introspect)
+	}
+}
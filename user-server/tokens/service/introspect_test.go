@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	token "token-manager"
+	"user-server/common"
+	userDb "user-server/signup/db"
+)
+
+type memoryAccounts map[string]bool
+
+func (m memoryAccounts) IsActive(ctx *context.Context, userId string) (bool, error) {
+	return m[userId], nil
+}
+
+// memoryUserStore only implements Get, by user id.
+type memoryUserStore struct {
+	userDb.UserStore
+	users map[string]*userDb.User
+}
+
+func (m *memoryUserStore) Get(ctx *context.Context, filter userDb.Filter) (*userDb.User, error) {
+	user, ok := m.users[filter.Value]
+	if !ok {
+		return nil, &common.NotFoundError{Message: "user not found"}
+	}
+	return user, nil
+}
+
+func TestUserAccountChecker_IsActive(t *testing.T) {
+	ctx := context.Background()
+	disabledOn := time.Now()
+	checker := NewUserAccountChecker(&memoryUserStore{users: map[string]*userDb.User{
+		"active":   {UserId: "active"},
+		"disabled": {UserId: "disabled", DisabledOn: &disabledOn},
+	}})
+	s, tokenManager := newTestService(t, time.Hour)
+	introspector := NewIntrospectionService(tokenManager,
+		NewRevocationService(&memoryRevocationStore{}, s.tokenStore, time.Hour, time.Minute), checker)
+	for userId, want := range map[string]bool{"active": true, "disabled": false, "deleted": false} {
+		if got, err := checker.IsActive(&ctx, userId); err != nil || got != want {
+			t.Errorf("IsActive(%s) = %v, %v, want %v", userId, got, err, want)
+		}
+		issued, _ := s.Issue(&ctx, &Subject{UserId: userId, FingerPrint: "device-1"})
+		if got, err := introspector.Introspect(&ctx, issued.AccessToken); err != nil || got.Active != want {
+			t.Errorf("Introspect() of a token of %s = %+v, %v, want active %v", userId, got, err, want)
+		}
+	}
+}
+
+func TestIntrospectionService_Introspect(t *testing.T) {
+	ctx := context.Background()
+	s, tokenManager := newTestService(t, time.Hour)
+	s.scopes = memoryScopeResolver{"user-1": {common.EndpointsWriteScope}}
+	issue := func(userId string) string {
+		issued, err := s.Issue(&ctx, &Subject{UserId: userId, FingerPrint: "device-1", App: "app"})
+		if err != nil {
+			t.Fatalf("Issue() error = %v", err)
+		}
+		return issued.AccessToken
+	}
+	iat := time.Now()
+	exp := iat.Add(time.Minute)
+	serviceToken, _ := tokenManager.Generate(&token.TokenClaims{IAT: &iat, EXP: &exp, Kind: token.KindService,
+		Sub: "client-1"})
+
+	tests := []struct {
+		name       string
+		token      func(r *RevocationService) string
+		wantActive bool
+	}{
+		{name: "active user", token: func(r *RevocationService) string { return issue("user-1") }, wantActive: true},
+		{name: "disabled user", token: func(r *RevocationService) string { return issue("user-2") }},
+		{name: "revoked token", token: func(r *RevocationService) string {
+			apiToken := issue("user-1")
+			claims, _ := tokenManager.Verify(apiToken)
+			r.RevokeToken(&ctx, claims.JTI, *claims.EXP)
+			return apiToken
+		}},
+		{name: "revoked user", token: func(r *RevocationService) string {
+			apiToken := issue("user-1")
+			r.RevokeUser(&ctx, "user-1")
+			return apiToken
+		}},
+		{name: "invalid token", token: func(r *RevocationService) string { return "not-a-token" }},
+		{name: "service token", token: func(r *RevocationService) string { return serviceToken }, wantActive: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revocations := NewRevocationService(&memoryRevocationStore{}, s.tokenStore, time.Hour, time.Minute)
+			introspector := NewIntrospectionService(tokenManager, revocations, memoryAccounts{"user-1": true})
+			got, err := introspector.Introspect(&ctx, tt.token(revocations))
+			if err != nil {
+				t.Fatalf("Introspect() error = %v", err)
+			}
+			if got.Active != tt.wantActive {
+				t.Errorf("Introspect() active = %v, want %v", got.Active, tt.wantActive)
+			}
+			if !got.Active && (len(got.User) > 0 || got.ExpiresAt != 0) {
+				t.Errorf("Introspect() of an inactive token = %+v, want no claims", got)
+			}
+		})
+	}
+
+	got, _ := NewIntrospectionService(tokenManager,
+		NewRevocationService(&memoryRevocationStore{}, s.tokenStore, time.Hour, time.Minute),
+		memoryAccounts{"user-1": true}).Introspect(&ctx, issue("user-1"))
+	if got.User != "user-1" || got.Machine != "device-1" || got.App != "app" ||
+		got.Scope != common.EndpointsWriteScope || got.ExpiresAt == 0 || got.Kind != token.KindUser {
+		t.Errorf("Introspect() = %+v, want the token's claims", got)
+	}
+}
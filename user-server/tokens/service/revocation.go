@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+	token "token-manager"
+	"user-server/tokens/db"
+)
+
+// revocationClockSkew is how far back revocations are listed again, so that
+// one written by another instance with a slower clock isn't missed.
+const revocationClockSkew = time.Minute
+
+type TokenRevoker interface {
+	RevokeToken(ctx *context.Context, jti string, expiresOn time.Time) error
+	RevokeUser(ctx *context.Context, userId string) error
+	RevokeDevice(ctx *context.Context, userId string, fingerPrint string) error
+	IsRevoked(ctx *context.Context, claims *token.TokenClaims) (bool, error)
+}
+
+// RevocationService revokes access tokens before they expire. Revocations
+// are checked against an in-process cache, revocations made by other
+// instances are loaded every refreshInterval.
+type RevocationService struct {
+	store           db.RevocationStore
+	refreshTokens   db.RefreshTokenStore
+	tokenLifetime   time.Duration
+	refreshInterval time.Duration
+
+	mu          sync.Mutex
+	jtis        map[string]*db.Revocation
+	users       map[string]*db.Revocation
+	devices     map[string]*db.Revocation
+	loadedAt    time.Time
+	attemptedAt time.Time
+	loading     *revocationLoad
+}
+
+// revocationLoad is a load in flight, done is closed once err is set.
+type revocationLoad struct {
+	done chan struct{}
+	err  error
+}
+
+// NewRevocationService keeps revocations of a user or a device for
+// tokenLifetime, the lifetime of the longest lived token they revoke.
+func NewRevocationService(store db.RevocationStore, refreshTokens db.RefreshTokenStore,
+	tokenLifetime time.Duration, refreshInterval time.Duration) *RevocationService {
+	return &RevocationService{
+		store:           store,
+		refreshTokens:   refreshTokens,
+		tokenLifetime:   tokenLifetime,
+		refreshInterval: refreshInterval,
+		jtis:            map[string]*db.Revocation{},
+		users:           map[string]*db.Revocation{},
+		devices:         map[string]*db.Revocation{},
+	}
+}
+
+// RevokeToken revokes the token with jti until it expires.
+func (r *RevocationService) RevokeToken(ctx *context.Context, jti string, expiresOn time.Time) error {
+	return r.revoke(ctx, &db.Revocation{
+		Kind:      db.RevokedToken,
+		Jti:       jti,
+		RevokedOn: time.Now(),
+		ExpiresOn: expiresOn,
+	})
+}
+
+// RevokeUser revokes every access and refresh token issued to the user so far.
+func (r *RevocationService) RevokeUser(ctx *context.Context, userId string) error {
+	return r.RevokeDevice(ctx, userId, "")
+}
+
+// RevokeDevice revokes every access and refresh token issued to the user on
+// the device with fingerPrint so far, or on all devices when it's empty.
+func (r *RevocationService) RevokeDevice(ctx *context.Context, userId string, fingerPrint string) error {
+	now := time.Now()
+	revocation := &db.Revocation{
+		Kind:      db.RevokedDevice,
+		UserId:    userId,
+		RevokedOn: now,
+		ExpiresOn: now.Add(r.tokenLifetime),
+	}
+	if len(fingerPrint) == 0 {
+		revocation.Kind = db.RevokedUser
+	} else {
+		revocation.FingerPrint = fingerPrint
+	}
+	if err := r.refreshTokens.RevokeSubject(ctx, userId, fingerPrint, now); err != nil {
+		return err
+	}
+	return r.revoke(ctx, revocation)
+}
+
+// IsRevoked reports whether the token with claims was revoked. Tokens only
+// carry their issue time in seconds, so a token issued in the same second as
+// a revocation of its user or device is revoked too.
+func (r *RevocationService) IsRevoked(ctx *context.Context, claims *token.TokenClaims) (bool, error) {
+	if err := r.refresh(ctx); err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.jtis[claims.JTI]; ok && len(claims.JTI) > 0 {
+		return true, nil
+	}
+	for _, revocation := range []*db.Revocation{r.users[claims.UserId],
+		r.devices[deviceKey(claims.UserId, claims.MachineId)]} {
+		if revocation != nil && (claims.IAT == nil || !claims.IAT.After(revocation.RevokedOn)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *RevocationService) revoke(ctx *context.Context, revocation *db.Revocation) error {
+	if err := r.store.Insert(ctx, revocation); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(revocation)
+	return nil
+}
+
+// refresh loads the revocations every refreshInterval. One check loads them
+// outside the lock while the others are answered from the cache, and a failed
+// load is logged and retried with the next interval. Only checks before the
+// first load succeeded wait for it, and fail with it.
+func (r *RevocationService) refresh(ctx *context.Context) error {
+	r.mu.Lock()
+	loaded := !r.loadedAt.IsZero()
+	if loaded && time.Since(r.attemptedAt) < r.refreshInterval {
+		r.mu.Unlock()
+		return nil
+	}
+	load := r.loading
+	if load != nil {
+		r.mu.Unlock()
+		if loaded {
+			return nil
+		}
+		<-load.done
+		return load.err
+	}
+	load = &revocationLoad{done: make(chan struct{})}
+	r.loading, r.attemptedAt = load, time.Now()
+	since := time.Time{}
+	if loaded {
+		since = r.loadedAt.Add(-revocationClockSkew)
+	}
+	r.mu.Unlock()
+
+	err := r.load(ctx, load, since)
+	if err != nil && loaded {
+		log.Printf("failed to load token revocations, checking the cached ones, reason: %v", err)
+		return nil
+	}
+	return err
+}
+
+// load adds the revocations made since the previous load and drops the
+// expired ones.
+func (r *RevocationService) load(ctx *context.Context, load *revocationLoad, since time.Time) error {
+	now := time.Now()
+	revocations, err := r.store.ListSince(ctx, since)
+	r.mu.Lock()
+	if err == nil {
+		for _, revocation := range revocations {
+			r.add(revocation)
+		}
+		for _, cache := range []map[string]*db.Revocation{r.jtis, r.users, r.devices} {
+			for key, revocation := range cache {
+				if !now.Before(revocation.ExpiresOn) {
+					delete(cache, key)
+				}
+			}
+		}
+		r.loadedAt = now
+	}
+	r.loading = nil
+	r.mu.Unlock()
+	load.err = err
+	close(load.done)
+	return err
+}
+
+func (r *RevocationService) add(revocation *db.Revocation) {
+	var cache map[string]*db.Revocation
+	var key string
+	switch revocation.Kind {
+	case db.RevokedToken:
+		cache, key = r.jtis, revocation.Jti
+	case db.RevokedUser:
+		cache, key = r.users, revocation.UserId
+	case db.RevokedDevice:
+		cache, key = r.devices, deviceKey(revocation.UserId, revocation.FingerPrint)
+	default:
+		return
+	}
+	// the latest revocation of a user or device covers the earlier ones
+	if current, ok := cache[key]; !ok || revocation.RevokedOn.After(current.RevokedOn) {
+		cache[key] = revocation
+	}
+}
+
+func deviceKey(userId string, fingerPrint string) string {
+	return userId + "/" + fingerPrint
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	token "token-manager"
+	"user-server/tokens/db"
+)
+
+type memoryRevocationStore struct {
+	revocations []*db.Revocation
+}
+
+func (m *memoryRevocationStore) Insert(ctx *context.Context, revocation *db.Revocation) error {
+	m.revocations = append(m.revocations, revocation)
+	return nil
+}
+
+func (m *memoryRevocationStore) ListSince(ctx *context.Context, since time.Time) ([]*db.Revocation, error) {
+	var revocations []*db.Revocation
+	for _, revocation := range m.revocations {
+		if !revocation.RevokedOn.Before(since) && time.Now().Before(revocation.ExpiresOn) {
+			revocations = append(revocations, revocation)
+		}
+	}
+	return revocations, nil
+}
+
+// unavailableRevocationStore fails to list while err is set, and blocks
+// listing while block is.
+type unavailableRevocationStore struct {
+	memoryRevocationStore
+	err   error
+	block chan struct{}
+}
+
+func (u *unavailableRevocationStore) ListSince(ctx *context.Context, since time.Time) ([]*db.Revocation, error) {
+	if u.block != nil {
+		<-u.block
+	}
+	if u.err != nil {
+		return nil, u.err
+	}
+	return u.memoryRevocationStore.ListSince(ctx, since)
+}
+
+func TestRevocationService_Unavailable(t *testing.T) {
+	ctx := context.Background()
+	before := time.Now().Add(-time.Minute)
+	claims := &token.TokenClaims{JTI: "jti-1", UserId: "user-1", IAT: &before}
+	store := &unavailableRevocationStore{err: errors.New("no reachable servers")}
+	refreshTokens := &memoryTokenStore{tokens: map[string]*db.RefreshToken{}}
+	r := NewRevocationService(store, refreshTokens, time.Hour, time.Millisecond)
+	if _, err := r.IsRevoked(&ctx, claims); err == nil {
+		t.Errorf("IsRevoked() before the first load error = nil")
+	}
+
+	store.err = nil
+	if err := r.RevokeToken(&ctx, "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if got, err := r.IsRevoked(&ctx, claims); err != nil || !got {
+		t.Fatalf("IsRevoked() = %v, %v, want true", got, err)
+	}
+
+	// failed and hanging loads keep answering from the cache
+	store.err = errors.New("no reachable servers")
+	time.Sleep(2 * time.Millisecond)
+	if got, err := r.IsRevoked(&ctx, claims); err != nil || !got {
+		t.Errorf("IsRevoked() with a failing store = %v, %v, want the cached true", got, err)
+	}
+	store.block = make(chan struct{})
+	defer close(store.block)
+	time.Sleep(2 * time.Millisecond)
+	go r.IsRevoked(&ctx, claims)
+	checked := make(chan bool)
+	go func() {
+		time.Sleep(time.Millisecond)
+		got, _ := r.IsRevoked(&ctx, claims)
+		checked <- got
+	}()
+	select {
+	case got := <-checked:
+		if !got {
+			t.Errorf("IsRevoked() during a load = false, want the cached true")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("IsRevoked() waited for the load of another check")
+	}
+}
+
+func TestRevocationService_IsRevoked(t *testing.T) {
+	ctx := context.Background()
+	before := time.Now().Add(-time.Minute)
+	after := time.Now().Add(time.Minute)
+	tests := []struct {
+		name   string
+		revoke func(r *RevocationService) error
+		claims *token.TokenClaims
+		want   bool
+	}{
+		{
+			name: "revoked jti",
+			revoke: func(r *RevocationService) error {
+				return r.RevokeToken(&ctx, "jti-1", time.Now().Add(time.Hour))
+			},
+			claims: &token.TokenClaims{JTI: "jti-1", UserId: "user-1", IAT: &before},
+			want:   true,
+		},
+		{
+			name: "other jti",
+			revoke: func(r *RevocationService) error {
+				return r.RevokeToken(&ctx, "jti-1", time.Now().Add(time.Hour))
+			},
+			claims: &token.TokenClaims{JTI: "jti-2", UserId: "user-1", IAT: &before},
+		},
+		{
+			name: "expired jti revocation",
+			revoke: func(r *RevocationService) error {
+				return r.RevokeToken(&ctx, "jti-1", time.Now().Add(-time.Second))
+			},
+			claims: &token.TokenClaims{JTI: "jti-1", UserId: "user-1", IAT: &before},
+		},
+		{
+			name: "token issued before user revocation",
+			revoke: func(r *RevocationService) error {
+				return r.RevokeUser(&ctx, "user-1")
+			},
+			claims: &token.TokenClaims{JTI: "jti-1", UserId: "user-1", MachineId: "device-1", IAT: &before},
+			want:   true,
+		},
+		{
+			name: "token issued after user revocation",
+			revoke: func(r *RevocationService) error {
+				return r.RevokeUser(&ctx, "user-1")
+			},
+			claims: &token.TokenClaims{JTI: "jti-1", UserId: "user-1", IAT: &after},
+		},
+		{
+			name: "token on revoked device",
+			revoke: func(r *RevocationService) error {
+				return r.RevokeDevice(&ctx, "user-1", "device-1")
+			},
+			claims: &token.TokenClaims{JTI: "jti-1", UserId: "user-1", MachineId: "device-1", IAT: &before},
+			want:   true,
+		},
+		{
+			name: "token on other device",
+			revoke: func(r *RevocationService) error {
+				return r.RevokeDevice(&ctx, "user-1", "device-1")
+			},
+			claims: &token.TokenClaims{JTI: "jti-1", UserId: "user-1", MachineId: "device-2", IAT: &before},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryRevocationStore{}
+			refreshTokens := &memoryTokenStore{tokens: map[string]*db.RefreshToken{}}
+			revoking := NewRevocationService(store, refreshTokens, time.Hour, time.Minute)
+			if err := tt.revoke(revoking); err != nil {
+				t.Fatalf("revoke error = %v", err)
+			}
+			// another instance only sees the revocation through the store
+			other := NewRevocationService(store, refreshTokens, time.Hour, time.Minute)
+			for _, r := range []*RevocationService{revoking, other} {
+				got, err := r.IsRevoked(&ctx, tt.claims)
+				if err != nil || got != tt.want {
+					t.Errorf("IsRevoked() = %v, %v, want %v", got, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRevocationService_RevokeDevice(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, time.Hour)
+	revoked, _ := s.Issue(&ctx, &Subject{UserId: "user-1", FingerPrint: "device-1"})
+	kept, _ := s.Issue(&ctx, &Subject{UserId: "user-1", FingerPrint: "device-2"})
+
+	r := NewRevocationService(&memoryRevocationStore{}, s.tokenStore, time.Hour, time.Minute)
+	if err := r.RevokeDevice(&ctx, "user-1", "device-1"); err != nil {
+		t.Fatalf("RevokeDevice() error = %v", err)
+	}
+	if _, err := s.Refresh(&ctx, revoked.RefreshToken, "device-1"); err == nil {
+		t.Errorf("Refresh() on revoked device error = nil")
+	}
+	if _, err := s.Refresh(&ctx, kept.RefreshToken, "device-2"); err != nil {
+		t.Errorf("Refresh() on other device error = %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"user-server/common"
+	userDb "user-server/signup/db"
+)
+
+// ScopeResolver looks up the scopes granted to a user. They're resolved
+// whenever a token is issued, so a change applies from the next refresh.
+type ScopeResolver interface {
+	GetScopes(ctx *context.Context, userId string) ([]string, error)
+}
+
+// UserScopeResolver grants the scopes stored on the user's document.
+type UserScopeResolver struct {
+	userStore userDb.UserStore
+}
+
+func NewUserScopeResolver(userStore userDb.UserStore) *UserScopeResolver {
+	return &UserScopeResolver{
+		userStore: userStore,
+	}
+}
+
+func (r *UserScopeResolver) GetScopes(ctx *context.Context, userId string) ([]string, error) {
+	user, err := r.userStore.Get(ctx, userDb.Filter{Key: userDb.UserId, Value: userId})
+	var notFoundErr *common.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user.Scopes, nil
+}
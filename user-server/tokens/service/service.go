@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"time"
+	token "token-manager"
+	"user-server/common"
+	"user-server/tokens/db"
+)
+
+const refreshTokenSize = 32
+
+// Subject is who a token pair is issued to, FingerPrint is the device the
+// refresh token is bound to.
+type Subject struct {
+	UserId      string
+	EmailId     string
+	FingerPrint string
+	App         string
+}
+
+type Tokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+type InvalidRefreshTokenError struct {
+	Message string
+}
+
+func (e *InvalidRefreshTokenError) Error() string {
+	return e.Message
+}
+
+// RefreshTokenReuseError is returned for a refresh token that was rotated
+// already, its whole family is revoked since one of its holders is stolen.
+type RefreshTokenReuseError struct {
+	FamilyId string
+}
+
+func (e *RefreshTokenReuseError) Error() string {
+	return "refresh token was already used, its session is revoked"
+}
+
+type TokenService interface {
+	Issue(ctx *context.Context, subject *Subject) (*Tokens, error)
+	Refresh(ctx *context.Context, refreshToken string, fingerPrint string) (*Tokens, error)
+}
+
+// TokenServiceImpl issues short-lived access tokens with opaque refresh
+// tokens. Refresh tokens are stored hashed and rotated on every use.
+type TokenServiceImpl struct {
+	tokenManager    token.TokenManager
+	tokenStore      db.RefreshTokenStore
+	scopes          ScopeResolver
+	accounts        AccountChecker
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+// NewTokenService grants access tokens the scopes of their user, nil scopes
+// issues tokens without any. Refresh tokens of users whose account isn't
+// active can't be exchanged, nil accounts doesn't check.
+func NewTokenService(tokenManager token.TokenManager, tokenStore db.RefreshTokenStore, scopes ScopeResolver,
+	accounts AccountChecker, accessTokenTTL time.Duration, refreshTokenTTL time.Duration) *TokenServiceImpl {
+	return &TokenServiceImpl{
+		tokenManager:    tokenManager,
+		tokenStore:      tokenStore,
+		scopes:          scopes,
+		accounts:        accounts,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+	}
+}
+
+// Issue starts a new token family, e.g. on sign in. The subject must name
+// the device its refresh token is bound to.
+func (s *TokenServiceImpl) Issue(ctx *context.Context, subject *Subject) (*Tokens, error) {
+	if len(subject.FingerPrint) == 0 {
+		return nil, errors.New("tokens can't be issued without a device fingerprint")
+	}
+	return s.issue(ctx, subject, primitive.NewObjectID().Hex())
+}
+
+// Refresh exchanges a refresh token for a new token pair. The refresh token
+// must belong to the device it was issued to, and presenting one that was
+// exchanged already revokes its family.
+func (s *TokenServiceImpl) Refresh(ctx *context.Context, refreshToken string,
+	fingerPrint string) (*Tokens, error) {
+	if len(fingerPrint) == 0 {
+		return nil, &InvalidRefreshTokenError{Message: "refresh token needs the device it was issued to"}
+	}
+	stored, err := s.tokenStore.Get(ctx, hashToken(refreshToken))
+	var notFoundErr *common.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil, &InvalidRefreshTokenError{Message: "refresh token is not valid"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case stored.RevokedOn != nil:
+		return nil, &InvalidRefreshTokenError{Message: "refresh token is revoked"}
+	case stored.RotatedOn != nil:
+		return nil, s.revokeFamily(ctx, stored, now)
+	case !now.Before(stored.ExpiresOn):
+		return nil, &InvalidRefreshTokenError{Message: "refresh token is expired"}
+	case stored.FingerPrint != fingerPrint:
+		return nil, &InvalidRefreshTokenError{Message: "refresh token was issued to another device"}
+	}
+	if s.accounts != nil {
+		active, err := s.accounts.IsActive(ctx, stored.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, &InvalidRefreshTokenError{Message: "account of the refresh token is disabled"}
+		}
+	}
+
+	rotated, err := s.tokenStore.MarkRotated(ctx, stored.TokenHash, now)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// exchanged concurrently, one of the two requests is a replay
+		return nil, s.revokeFamily(ctx, stored, now)
+	}
+	return s.issue(ctx, &Subject{
+		UserId:      stored.UserId,
+		EmailId:     stored.EmailId,
+		FingerPrint: stored.FingerPrint,
+		App:         stored.App,
+	}, stored.FamilyId)
+}
+
+func (s *TokenServiceImpl) issue(ctx *context.Context, subject *Subject, familyId string) (*Tokens, error) {
+	now := time.Now()
+	claims := getClaims(subject, now, now.Add(s.accessTokenTTL))
+	if s.scopes != nil {
+		scopes, err := s.scopes.GetScopes(ctx, subject.UserId)
+		if err != nil {
+			return nil, err
+		}
+		claims.Scopes = scopes
+	}
+	accessToken, err := s.tokenManager.Generate(claims)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.tokenStore.Insert(ctx, &db.RefreshToken{
+		TokenHash:   hashToken(refreshToken),
+		FamilyId:    familyId,
+		UserId:      subject.UserId,
+		EmailId:     subject.EmailId,
+		FingerPrint: subject.FingerPrint,
+		App:         subject.App,
+		CreatedOn:   now,
+		ExpiresOn:   now.Add(s.refreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (s *TokenServiceImpl) revokeFamily(ctx *context.Context, stored *db.RefreshToken, now time.Time) error {
+	log.Printf("refresh token of family: %s for user: %s was reused, revoking the family",
+		stored.FamilyId, stored.UserId)
+	if err := s.tokenStore.RevokeFamily(ctx, stored.FamilyId, now); err != nil {
+		return err
+	}
+	return &RefreshTokenReuseError{FamilyId: stored.FamilyId}
+}
+
+func getClaims(subject *Subject, iat time.Time, exp time.Time) *token.TokenClaims {
+	return &token.TokenClaims{
+		UserId:    subject.UserId,
+		EmailId:   subject.EmailId,
+		MachineId: subject.FingerPrint,
+		App:       subject.App,
+		IAT:       &iat,
+		EXP:       &exp,
+		Kind:      token.KindUser,
+		Sub:       subject.UserId,
+	}
+}
+
+func newRefreshToken() (string, error) {
+	value := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
+
+func hashToken(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	token "token-manager"
+	"user-server/common"
+	"user-server/tokens/db"
+)
+
+type memoryTokenStore struct {
+	tokens map[string]*db.RefreshToken
+}
+
+func (m *memoryTokenStore) Insert(ctx *context.Context, refreshToken *db.RefreshToken) error {
+	stored := *refreshToken
+	m.tokens[refreshToken.TokenHash] = &stored
+	return nil
+}
+
+func (m *memoryTokenStore) Get(ctx *context.Context, tokenHash string) (*db.RefreshToken, error) {
+	stored, ok := m.tokens[tokenHash]
+	if !ok {
+		return nil, &common.NotFoundError{Message: "Refresh token not found"}
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (m *memoryTokenStore) MarkRotated(ctx *context.Context, tokenHash string, rotatedOn time.Time) (bool, error) {
+	stored, ok := m.tokens[tokenHash]
+	if !ok || stored.RotatedOn != nil || stored.RevokedOn != nil {
+		return false, nil
+	}
+	stored.RotatedOn = &rotatedOn
+	return true, nil
+}
+
+func (m *memoryTokenStore) RevokeSubject(ctx *context.Context, userId string, fingerPrint string,
+	revokedOn time.Time) error {
+	for _, stored := range m.tokens {
+		if stored.UserId == userId && (fingerPrint == "" || stored.FingerPrint == fingerPrint) &&
+			stored.RevokedOn == nil {
+			stored.RevokedOn = &revokedOn
+		}
+	}
+	return nil
+}
+
+func (m *memoryTokenStore) RevokeFamily(ctx *context.Context, familyId string, revokedOn time.Time) error {
+	for _, stored := range m.tokens {
+		if stored.FamilyId == familyId && stored.RevokedOn == nil {
+			stored.RevokedOn = &revokedOn
+		}
+	}
+	return nil
+}
+
+type memoryScopeResolver map[string][]string
+
+func (m memoryScopeResolver) GetScopes(ctx *context.Context, userId string) ([]string, error) {
+	return m[userId], nil
+}
+
+func newTestService(t *testing.T, refreshTokenTTL time.Duration) (*TokenServiceImpl, token.TokenManager) {
+	keySet, err := token.NewKeySet("hs-1", token.NewSecretKey("hs-1", "c2VjcmV0"))
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	tokenManager := token.NewKeySetTokenManager(keySet, nil)
+	store := &memoryTokenStore{tokens: map[string]*db.RefreshToken{}}
+	return NewTokenService(tokenManager, store, memoryScopeResolver{}, nil, 15*time.Minute, refreshTokenTTL),
+		tokenManager
+}
+
+func TestTokenService_Refresh(t *testing.T) {
+	ctx := context.Background()
+	subject := &Subject{UserId: "user-1", EmailId: "user@example.com", FingerPrint: "device-1", App: "app"}
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		refresh func(s *TokenServiceImpl, issued *Tokens) error
+		wantErr interface{}
+	}{
+		{
+			name: "rotates the refresh token",
+			ttl:  time.Hour,
+			refresh: func(s *TokenServiceImpl, issued *Tokens) error {
+				refreshed, err := s.Refresh(&ctx, issued.RefreshToken, "device-1")
+				if err != nil {
+					return err
+				}
+				if refreshed.RefreshToken == issued.RefreshToken {
+					t.Errorf("Refresh() returned the presented refresh token")
+				}
+				_, err = s.Refresh(&ctx, refreshed.RefreshToken, "device-1")
+				return err
+			},
+		},
+		{
+			name: "reuse revokes the family",
+			ttl:  time.Hour,
+			refresh: func(s *TokenServiceImpl, issued *Tokens) error {
+				refreshed, err := s.Refresh(&ctx, issued.RefreshToken, "device-1")
+				if err != nil {
+					return err
+				}
+				_, reuseErr := s.Refresh(&ctx, issued.RefreshToken, "device-1")
+				var want *RefreshTokenReuseError
+				if !errors.As(reuseErr, &want) {
+					t.Errorf("Refresh() of a rotated token error = %v, want RefreshTokenReuseError", reuseErr)
+				}
+				_, err = s.Refresh(&ctx, refreshed.RefreshToken, "device-1")
+				return err
+			},
+			wantErr: &InvalidRefreshTokenError{},
+		},
+		{
+			name: "other device",
+			ttl:  time.Hour,
+			refresh: func(s *TokenServiceImpl, issued *Tokens) error {
+				_, err := s.Refresh(&ctx, issued.RefreshToken, "device-2")
+				return err
+			},
+			wantErr: &InvalidRefreshTokenError{},
+		},
+		{
+			name: "without device",
+			ttl:  time.Hour,
+			refresh: func(s *TokenServiceImpl, issued *Tokens) error {
+				_, err := s.Refresh(&ctx, issued.RefreshToken, "")
+				return err
+			},
+			wantErr: &InvalidRefreshTokenError{},
+		},
+		{
+			name: "expired",
+			ttl:  -time.Minute,
+			refresh: func(s *TokenServiceImpl, issued *Tokens) error {
+				_, err := s.Refresh(&ctx, issued.RefreshToken, "device-1")
+				return err
+			},
+			wantErr: &InvalidRefreshTokenError{},
+		},
+		{
+			name: "unknown",
+			ttl:  time.Hour,
+			refresh: func(s *TokenServiceImpl, issued *Tokens) error {
+				_, err := s.Refresh(&ctx, "unknown", "device-1")
+				return err
+			},
+			wantErr: &InvalidRefreshTokenError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t, tt.ttl)
+			issued, err := s.Issue(&ctx, subject)
+			if err != nil {
+				t.Fatalf("Issue() error = %v", err)
+			}
+			err = tt.refresh(s, issued)
+			var invalidErr *InvalidRefreshTokenError
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Refresh() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.As(err, &invalidErr) {
+				t.Errorf("Refresh() error = %v, want InvalidRefreshTokenError", err)
+			}
+		})
+	}
+}
+
+func TestTokenService_RefreshDisabledAccount(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, time.Hour)
+	accounts := memoryAccounts{"user-1": true}
+	s.accounts = accounts
+	issued, err := s.Issue(&ctx, &Subject{UserId: "user-1", FingerPrint: "device-1"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	refreshed, err := s.Refresh(&ctx, issued.RefreshToken, "device-1")
+	if err != nil {
+		t.Fatalf("Refresh() of an active account error = %v", err)
+	}
+
+	accounts["user-1"] = false
+	var invalidErr *InvalidRefreshTokenError
+	if _, err := s.Refresh(&ctx, refreshed.RefreshToken, "device-1"); !errors.As(err, &invalidErr) {
+		t.Errorf("Refresh() of a disabled account error = %v, want InvalidRefreshTokenError", err)
+	}
+}
+
+func TestTokenService_Issue(t *testing.T) {
+	ctx := context.Background()
+	s, tokenManager := newTestService(t, time.Hour)
+	issued, err := s.Issue(&ctx, &Subject{UserId: "user-1", FingerPrint: "device-1"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	claims, err := tokenManager.Verify(issued.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.UserId != "user-1" || issued.ExpiresIn != 15*60 {
+		t.Errorf("Issue() = %v for user %s, want a 15 minute token for user-1", issued, claims.UserId)
+	}
+	stored := s.tokenStore.(*memoryTokenStore).tokens
+	if _, ok := stored[issued.RefreshToken]; ok || len(stored) != 1 {
+		t.Errorf("refresh token is stored in plain text")
+	}
+	if _, err := s.Issue(&ctx, &Subject{UserId: "user-1"}); err == nil {
+		t.Errorf("Issue() without a device fingerprint error = nil")
+	}
+}
+
+func TestTokenService_Scopes(t *testing.T) {
+	ctx := context.Background()
+	s, tokenManager := newTestService(t, time.Hour)
+	scopes := memoryScopeResolver{"user-1": {common.EndpointsWriteScope}}
+	s.scopes = scopes
+	issued, err := s.Issue(&ctx, &Subject{UserId: "user-1", FingerPrint: "device-1"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	claims, _ := tokenManager.Verify(issued.AccessToken)
+	if !claims.HasScopes(common.EndpointsWriteScope) {
+		t.Errorf("Issue() scopes = %v, want %s", claims.Scopes, common.EndpointsWriteScope)
+	}
+
+	// scopes taken away apply from the next refresh
+	delete(scopes, "user-1")
+	refreshed, err := s.Refresh(&ctx, issued.RefreshToken, "device-1")
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	claims, _ = tokenManager.Verify(refreshed.AccessToken)
+	if len(claims.Scopes) != 0 {
+		t.Errorf("Refresh() scopes = %v, want none", claims.Scopes)
+	}
+}